@@ -0,0 +1,455 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error codes
+var (
+	ErrAddrBookUnknown  = fmt.Errorf("Unknown address or label")
+	ErrAddrBookNoFresh  = fmt.Errorf("No fresh funding address available")
+	ErrAddrBookPurpose  = fmt.Errorf("Address assigned to other purpose")
+	ErrAddrBookLabel    = fmt.Errorf("Label already used")
+	ErrAddrBookAddress  = fmt.Errorf("Invalid address")
+	ErrAddrBookExternal = fmt.Errorf("Address is a wallet address")
+	ErrAddrBookAsset    = fmt.Errorf("Destination is for other asset")
+)
+
+// AddressLabel is an entry of the address book: either an address of the
+// Bisq wallet (with purpose) or an external destination.
+type AddressLabel struct {
+	Address       string     `json:"address"`           // BTC or BSQ address
+	Asset         string     `json:"asset"`             // AssetBTC or AssetBSQ
+	Purpose       string     `json:"purpose,omitempty"` // purpose of wallet address
+	Label         string     `json:"label"`             // human-readable label
+	Created       time.Time  `json:"created"`           // time of entry
+	Used          *time.Time `json:"used,omitempty"`    // first seen used (wallet addresses; nil if unused)
+	Confirmations int64      `json:"confirmations"`     // last seen confirmations
+	Reused        bool       `json:"reused"`            // address received funds again
+}
+
+// FundingAddress is a funding address of the wallet with its label.
+type FundingAddress struct {
+	Address       string `json:"address"`           // wallet address
+	Balance       int64  `json:"balance"`           // balance (satoshis)
+	Confirmations int64  `json:"confirmations"`     // confirmations of last tx
+	Unused        bool   `json:"unused"`            // address never used
+	Purpose       string `json:"purpose,omitempty"` // purpose (if labeled)
+	Label         string `json:"label,omitempty"`   // label (if labeled)
+	Reused        bool   `json:"reused"`            // address reuse detected
+}
+
+// addressBookFile is the persistent state of the address book
+type addressBookFile struct {
+	Wallet   []*AddressLabel `json:"wallet"`   // labeled wallet addresses
+	External []*AddressLabel `json:"external"` // external destinations
+}
+
+// AddressBook labels the addresses of the Bisq wallet by purpose and keeps
+// a list of labeled external destinations. Wallet addresses are handed out
+// per purpose and watched for reuse: the confirmations reported for an
+// address refer to its most recent transaction, so a drop means that the
+// address was used again. The book is stored in a JSON file.
+type AddressBook struct {
+	client *Client                  // client for API calls
+	path   string                   // path to address book file
+	wallet map[string]*AddressLabel // labeled wallet addresses
+	ext    map[string]*AddressLabel // external destinations
+	mtx    sync.Mutex               // serialize access
+}
+
+// NewAddressBook opens an address book file (created on first change).
+// An empty path keeps the book in memory.
+func NewAddressBook(c *Client, path string) (*AddressBook, error) {
+	b := &AddressBook{
+		client: c,
+		path:   path,
+		wallet: make(map[string]*AddressLabel),
+		ext:    make(map[string]*AddressLabel),
+	}
+	if len(path) == 0 {
+		return b, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return nil, err
+	}
+	var f addressBookFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	for _, e := range f.Wallet {
+		// older files have a zero time for unused addresses
+		if e.Used != nil && e.Used.IsZero() {
+			e.Used = nil
+		}
+		b.wallet[e.Address] = e
+	}
+	for _, e := range f.External {
+		b.ext[e.Address] = e
+	}
+	return b, nil
+}
+
+// save the address book (unlocked)
+func (b *AddressBook) save() error {
+	if len(b.path) == 0 {
+		return nil
+	}
+	f := &addressBookFile{
+		Wallet:   sortedLabels(b.wallet),
+		External: sortedLabels(b.ext),
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// sortedLabels returns entries sorted by purpose, label and address
+func sortedLabels(m map[string]*AddressLabel) []*AddressLabel {
+	list := make([]*AddressLabel, 0, len(m))
+	for _, e := range m {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Purpose != b.Purpose {
+			return a.Purpose < b.Purpose
+		}
+		if a.Label != b.Label {
+			return a.Label < b.Label
+		}
+		return a.Address < b.Address
+	})
+	return list
+}
+
+// checkAddress rejects empty addresses and addresses with whitespace
+func checkAddress(addr string) error {
+	if len(addr) == 0 || strings.ContainsAny(addr, " \t\r\n") {
+		return fmt.Errorf("%w '%s'", ErrAddrBookAddress, addr)
+	}
+	return nil
+}
+
+//----------------------------------------------------------------------
+// Wallet addresses
+//----------------------------------------------------------------------
+
+// Label assigns a purpose and label to an address of the wallet.
+func (b *AddressBook) Label(addr, asset, purpose, label string) error {
+	if err := checkAddress(addr); err != nil {
+		return err
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.ext[addr]; ok {
+		return fmt.Errorf("%w: '%s' is an external destination", ErrAddrBookPurpose, addr)
+	}
+	e, ok := b.wallet[addr]
+	if !ok {
+		e = &AddressLabel{Address: addr, Created: time.Now().UTC()}
+		b.wallet[addr] = e
+	}
+	e.Asset, e.Purpose, e.Label = strings.ToUpper(asset), purpose, label
+	return b.save()
+}
+
+// Addresses returns the labeled wallet addresses for a purpose (all if
+// purpose is empty).
+func (b *AddressBook) Addresses(purpose string) (list []*AddressLabel) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, e := range sortedLabels(b.wallet) {
+		if len(purpose) == 0 || e.Purpose == purpose {
+			list = append(list, e)
+		}
+	}
+	return
+}
+
+// Lookup returns the entry for an address (wallet or external).
+func (b *AddressBook) Lookup(addr string) (*AddressLabel, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if e, ok := b.wallet[addr]; ok {
+		return e, true
+	}
+	e, ok := b.ext[addr]
+	return e, ok
+}
+
+// Fresh returns an unused BTC receive address for a purpose. An unused
+// address already handed out for the purpose is returned again; otherwise
+// the next unused and unlabeled funding address is assigned. Bisq keeps
+// at least one unused funding address available.
+func (b *AddressBook) Fresh(ctx context.Context, purpose, label string) (*AddressLabel, error) {
+	list, err := b.client.GetFundingAddresses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.update(list, time.Now().UTC())
+
+	var fresh *AddressBalanceInfo
+	for _, a := range list {
+		if !a.IsAddressUnused || a.Balance != 0 {
+			continue
+		}
+		e, ok := b.wallet[a.Address]
+		if !ok {
+			if fresh == nil {
+				fresh = a
+			}
+			continue
+		}
+		if e.Purpose == purpose && e.Used == nil {
+			if len(label) > 0 && e.Label != label {
+				e.Label = label
+				if err = b.save(); err != nil {
+					return nil, err
+				}
+			}
+			return e, nil
+		}
+	}
+	if fresh == nil {
+		return nil, ErrAddrBookNoFresh
+	}
+	e := &AddressLabel{
+		Address: fresh.Address,
+		Asset:   AssetBTC,
+		Purpose: purpose,
+		Label:   label,
+		Created: time.Now().UTC(),
+	}
+	b.wallet[e.Address] = e
+	return e, b.save()
+}
+
+// FreshBsq returns an unused BSQ receive address for a purpose.
+func (b *AddressBook) FreshBsq(ctx context.Context, purpose, label string) (*AddressLabel, error) {
+	addr, err := b.client.GetUnusedBsqAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	e, ok := b.wallet[addr]
+	if ok && e.Purpose != purpose {
+		return nil, fmt.Errorf("%w '%s'", ErrAddrBookPurpose, e.Purpose)
+	}
+	if !ok {
+		e = &AddressLabel{
+			Address: addr,
+			Asset:   AssetBSQ,
+			Purpose: purpose,
+			Created: time.Now().UTC(),
+		}
+		b.wallet[addr] = e
+	}
+	if len(label) > 0 {
+		e.Label = label
+	}
+	return e, b.save()
+}
+
+// update the usage of labeled addresses from funding addresses (unlocked).
+// Returns true if an entry has changed.
+func (b *AddressBook) update(list []*AddressBalanceInfo, now time.Time) (changed bool) {
+	for _, a := range list {
+		e, ok := b.wallet[a.Address]
+		if !ok || a.IsAddressUnused {
+			continue
+		}
+		if e.Used == nil {
+			used := now
+			e.Used = &used
+			changed = true
+		} else if a.NumConfirmations < e.Confirmations && !e.Reused {
+			e.Reused = true
+			changed = true
+		}
+		if e.Confirmations != a.NumConfirmations {
+			e.Confirmations = a.NumConfirmations
+			changed = true
+		}
+	}
+	return
+}
+
+// Funding returns the funding addresses of the wallet with their labels
+// and updates the usage of the labeled addresses.
+func (b *AddressBook) Funding(ctx context.Context) ([]*FundingAddress, error) {
+	list, err := b.client.GetFundingAddresses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.update(list, time.Now().UTC()) {
+		if err = b.save(); err != nil {
+			return nil, err
+		}
+	}
+	res := make([]*FundingAddress, len(list))
+	for i, a := range list {
+		fa := &FundingAddress{
+			Address:       a.Address,
+			Balance:       a.Balance,
+			Confirmations: a.NumConfirmations,
+			Unused:        a.IsAddressUnused,
+		}
+		if e, ok := b.wallet[a.Address]; ok {
+			fa.Purpose, fa.Label, fa.Reused = e.Purpose, e.Label, e.Reused
+		}
+		res[i] = fa
+	}
+	return res, nil
+}
+
+//----------------------------------------------------------------------
+// External destinations
+//----------------------------------------------------------------------
+
+// AddDestination adds (or relabels) an external destination. Labels are
+// unique (case-insensitive) and can be used instead of the address.
+func (b *AddressBook) AddDestination(addr, asset, label string) error {
+	if err := checkAddress(addr); err != nil {
+		return err
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.wallet[addr]; ok {
+		return fmt.Errorf("%w '%s'", ErrAddrBookExternal, addr)
+	}
+	for _, e := range b.ext {
+		if e.Address != addr && len(label) > 0 && strings.EqualFold(e.Label, label) {
+			return fmt.Errorf("%w '%s'", ErrAddrBookLabel, label)
+		}
+	}
+	e, ok := b.ext[addr]
+	if !ok {
+		e = &AddressLabel{Address: addr, Created: time.Now().UTC()}
+		b.ext[addr] = e
+	}
+	e.Asset, e.Label = strings.ToUpper(asset), label
+	return b.save()
+}
+
+// RemoveDestination removes an external destination (by address or label).
+func (b *AddressBook) RemoveDestination(name string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	e, err := b.destination(name)
+	if err != nil {
+		return err
+	}
+	delete(b.ext, e.Address)
+	return b.save()
+}
+
+// Destination returns an external destination by address or label.
+func (b *AddressBook) Destination(name string) (*AddressLabel, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.destination(name)
+}
+
+// destination by address or label (unlocked)
+func (b *AddressBook) destination(name string) (*AddressLabel, error) {
+	if e, ok := b.ext[name]; ok {
+		return e, nil
+	}
+	for _, e := range b.ext {
+		if strings.EqualFold(e.Label, name) {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w '%s'", ErrAddrBookUnknown, name)
+}
+
+// Destinations returns all external destinations sorted by label.
+func (b *AddressBook) Destinations() []*AddressLabel {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return sortedLabels(b.ext)
+}
+
+// DestinationFor returns an external destination (by address or label)
+// for an asset.
+func (b *AddressBook) DestinationFor(name, asset string) (*AddressLabel, error) {
+	e, err := b.Destination(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Asset) > 0 && e.Asset != asset {
+		return nil, fmt.Errorf("%w: '%s' is a %s address", ErrAddrBookAsset, name, e.Asset)
+	}
+	return e, nil
+}
+
+// SendBtc sends BTC to an external destination (address or label).
+func (b *AddressBook) SendBtc(ctx context.Context, dest, amount, txFeeRate, memo string) (*TxInfo, error) {
+	e, err := b.DestinationFor(dest, AssetBTC)
+	if err != nil {
+		return nil, err
+	}
+	return b.client.SendBtc(ctx, e.Address, amount, txFeeRate, memo)
+}
+
+// SendBsq sends BSQ to an external destination (address or label).
+func (b *AddressBook) SendBsq(ctx context.Context, dest, amount, txFeeRate string) (*TxInfo, error) {
+	e, err := b.DestinationFor(dest, AssetBSQ)
+	if err != nil {
+		return nil, err
+	}
+	return b.client.SendBsq(ctx, e.Address, amount, txFeeRate)
+}
+
+// WithdrawFunds withdraws the funds of a trade to an external destination
+// (address or label).
+func (b *AddressBook) WithdrawFunds(ctx context.Context, tradeID, dest, memo string) error {
+	e, err := b.DestinationFor(dest, AssetBTC)
+	if err != nil {
+		return err
+	}
+	return b.client.WithdrawFunds(ctx, tradeID, e.Address, memo)
+}
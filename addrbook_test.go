@@ -0,0 +1,180 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddressBookWallet(t *testing.T) {
+	needDaemon(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "addressbook.json")
+	b, err := NewAddressBook(testClient, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fake daemon: bc1qaaa unused, bc1qbbb used
+	e, err := b.Fresh(ctx, "deposit:kraken", "Kraken withdrawals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Address != "bc1qaaa" || e.Asset != AssetBTC {
+		t.Fatalf("unexpected fresh address: %v", e)
+	}
+	// unused address is handed out again for the same purpose only
+	if e, err = b.Fresh(ctx, "deposit:kraken", ""); err != nil || e.Address != "bc1qaaa" || e.Label != "Kraken withdrawals" {
+		t.Fatalf("unexpected fresh address: %v (%v)", e, err)
+	}
+	if _, err = b.Fresh(ctx, "refund", ""); !errors.Is(err, ErrAddrBookNoFresh) {
+		t.Fatalf("expected no fresh address: %v", err)
+	}
+	if e, err = b.FreshBsq(ctx, "bsq", "BSQ income"); err != nil || e.Asset != AssetBSQ {
+		t.Fatalf("unexpected BSQ address: %v (%v)", e, err)
+	}
+	if err = b.Label("bc1qbbb", "btc", "refund", "trade refunds"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := b.Funding(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Purpose != "deposit:kraken" || list[1].Label != "trade refunds" {
+		t.Fatalf("unexpected funding addresses: %v", list)
+	}
+	// reload
+	if b, err = NewAddressBook(testClient, path); err != nil {
+		t.Fatal(err)
+	}
+	if l := b.Addresses(""); len(l) != 3 {
+		t.Fatalf("expected 3 labeled addresses, got %d", len(l))
+	}
+	if l := b.Addresses("refund"); len(l) != 1 || l[0].Used == nil || l[0].Confirmations != 3 {
+		t.Fatalf("unexpected refund addresses: %v", l)
+	}
+}
+
+func TestAddressBookReuse(t *testing.T) {
+	b, err := NewAddressBook(testClient, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Label("bc1q1", AssetBTC, "deposit", ""); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, tc := range []struct {
+		info   *AddressBalanceInfo
+		reused bool
+	}{
+		{&AddressBalanceInfo{Address: "bc1q1", IsAddressUnused: true}, false},
+		{&AddressBalanceInfo{Address: "bc1q1", Balance: 1000, NumConfirmations: 1}, false},
+		{&AddressBalanceInfo{Address: "bc1q1", Balance: 1000, NumConfirmations: 6}, false},
+		{&AddressBalanceInfo{Address: "bc1q1", Balance: 3000, NumConfirmations: 0}, true},
+		{&AddressBalanceInfo{Address: "bc1q1", Balance: 3000, NumConfirmations: 2}, true},
+	} {
+		b.update([]*AddressBalanceInfo{tc.info}, now)
+		e, _ := b.Lookup("bc1q1")
+		if e.Reused != tc.reused {
+			t.Fatalf("step %d: expected reused=%v", i, tc.reused)
+		}
+	}
+}
+
+func TestAddressBookUsed(t *testing.T) {
+	// unused addresses in older files have a zero time
+	path := filepath.Join(t.TempDir(), "addressbook.json")
+	old := `{"wallet":[{"address":"bc1q1","asset":"BTC","purpose":"deposit","label":"",` +
+		`"created":"2024-03-01T12:00:00Z","used":"0001-01-01T00:00:00Z","confirmations":0,"reused":false}],"external":[]}`
+	if err := os.WriteFile(path, []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewAddressBook(testClient, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := b.Lookup("bc1q1"); e == nil || e.Used != nil {
+		t.Fatalf("unexpected entry: %v", e)
+	}
+	// unused addresses are stored without time of use
+	if err = b.Label("bc1q1", AssetBTC, "deposit", "exchange"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"used"`) {
+		t.Fatalf("time of use stored for unused address:\n%s", data)
+	}
+	b.update([]*AddressBalanceInfo{{Address: "bc1q1", NumConfirmations: 1}}, time.Now())
+	if e, _ := b.Lookup("bc1q1"); e.Used == nil {
+		t.Fatal("time of use not set")
+	}
+}
+
+func TestAddressBookDestinations(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewAddressBook(testClient, filepath.Join(t.TempDir(), "addressbook.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddDestination("bc1qcold", AssetBTC, "Cold storage"); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddDestination("Bbc1qdao", "bsq", "DAO"); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddDestination("bc1qother", AssetBTC, "cold STORAGE"); !errors.Is(err, ErrAddrBookLabel) {
+		t.Fatalf("duplicate label accepted: %v", err)
+	}
+	if err = b.AddDestination("bc1q bad", AssetBTC, "bad"); !errors.Is(err, ErrAddrBookAddress) {
+		t.Fatalf("invalid address accepted: %v", err)
+	}
+	if err = b.Label("bc1qaaa", AssetBTC, "deposit", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddDestination("bc1qaaa", AssetBTC, "own"); !errors.Is(err, ErrAddrBookExternal) {
+		t.Fatalf("wallet address accepted as destination: %v", err)
+	}
+	e, err := b.Destination("cold storage")
+	if err != nil || e.Address != "bc1qcold" {
+		t.Fatalf("unexpected destination: %v (%v)", e, err)
+	}
+	if _, err = b.SendBtc(ctx, "DAO", "0.1", "", ""); !errors.Is(err, ErrAddrBookAsset) {
+		t.Fatalf("BTC sent to BSQ destination: %v", err)
+	}
+	if err = b.WithdrawFunds(ctx, "t1", "unknown", ""); !errors.Is(err, ErrAddrBookUnknown) {
+		t.Fatalf("withdrawal to unknown destination: %v", err)
+	}
+	if err = b.RemoveDestination("bc1qcold"); err != nil {
+		t.Fatal(err)
+	}
+	if list := b.Destinations(); len(list) != 1 || list[0].Label != "DAO" {
+		t.Fatalf("unexpected destinations: %v", list)
+	}
+}
@@ -0,0 +1,287 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+// Package analytics evaluates the public trade history of the Bisq network
+// (TradeStatistics3 entries): price candles, volume by payment method and
+// volume-weighted average prices. It also computes the market structure
+// of the current offer book (spread, depth and premiums).
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"github.com/bfix/bisquit/store"
+)
+
+// Error codes
+var (
+	ErrNoTrades  = fmt.Errorf("No trades in period")
+	ErrInterval  = fmt.Errorf("Invalid candle interval")
+	ErrNoHistory = fmt.Errorf("No trade history")
+)
+
+// ISO 4217 codes of fiat currencies; all other currencies are cryptos.
+const fiatCodes = "AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF " +
+	"BMD BND BOB BRL BSD BTN BWP BYN BZD CAD CDF CHF CLP CNY COP CRC CUP CVE " +
+	"CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ " +
+	"GYD HKD HNL HRK HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR " +
+	"KMF KPW KRW KWD KYD KZT LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT " +
+	"MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK " +
+	"PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SLL " +
+	"SOS SRD SSP STN SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX " +
+	"USD UYU UZS VES VND VUV WST XAF XAG XAU XCD XOF XPF YER ZAR ZMW ZWL"
+
+// set of fiat currencies
+var fiat = make(map[string]bool)
+
+func init() {
+	for _, code := range strings.Fields(fiatCodes) {
+		fiat[code] = true
+	}
+}
+
+// IsFiat returns true for fiat currencies.
+func IsFiat(curr string) bool {
+	return fiat[strings.ToUpper(curr)]
+}
+
+// Precision returns the number of decimals of prices in trade statistics:
+// fiat prices (per BTC) have 4 decimals, crypto prices (in BTC) have 8.
+func Precision(curr string) int {
+	if IsFiat(curr) {
+		return 4
+	}
+	return 8
+}
+
+//----------------------------------------------------------------------
+// Normalized trades
+//----------------------------------------------------------------------
+
+// Trade is a normalized trade statistics entry. Prices follow the Bisq
+// convention: fiat per BTC for fiat markets, BTC per coin for cryptos.
+type Trade struct {
+	Time          time.Time `json:"time"`          // trade date
+	Currency      string    `json:"currency"`      // counter currency
+	Price         float64   `json:"price"`         // trade price
+	Amount        uint64    `json:"amount"`        // BTC amount (sats)
+	Volume        float64   `json:"volume"`        // counter currency volume
+	PaymentMethod string    `json:"paymentMethod"` // payment method ID
+}
+
+// Normalize a trade statistics entry.
+func Normalize(ts *bisquit.TradeStatistics3) *Trade {
+	t := &Trade{
+		Time:          time.UnixMilli(ts.Date).UTC(),
+		Currency:      strings.ToUpper(ts.Currency),
+		Price:         float64(ts.Price) / math.Pow10(Precision(ts.Currency)),
+		Amount:        uint64(ts.Amount),
+		PaymentMethod: ts.PaymentMethod,
+	}
+	btc := float64(t.Amount) / 1e8
+	if IsFiat(t.Currency) {
+		t.Volume = btc * t.Price
+	} else if t.Price > 0 {
+		t.Volume = btc / t.Price
+	}
+	return t
+}
+
+// NormalizeAll normalizes a list of entries; the result is sorted by time.
+func NormalizeAll(list []*bisquit.TradeStatistics3) []*Trade {
+	trades := make([]*Trade, 0, len(list))
+	for _, ts := range list {
+		if ts.Price <= 0 || ts.Amount <= 0 {
+			continue
+		}
+		trades = append(trades, Normalize(ts))
+	}
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Time.Before(trades[j].Time)
+	})
+	return trades
+}
+
+// Load the trade history from the Bisq data directory (see store.Open).
+func Load(path string) ([]*Trade, error) {
+	s, err := store.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.TradeStatistics()
+	if err != nil {
+		return nil, err
+	}
+	trades := NormalizeAll(list)
+	if len(trades) == 0 {
+		return nil, ErrNoHistory
+	}
+	return trades, nil
+}
+
+// Filter returns the trades for a currency in the period [from,to); zero
+// times leave the period open.
+func Filter(trades []*Trade, curr string, from, to time.Time) (list []*Trade) {
+	curr = strings.ToUpper(curr)
+	for _, t := range trades {
+		if len(curr) > 0 && t.Currency != curr {
+			continue
+		}
+		if (!from.IsZero() && t.Time.Before(from)) || (!to.IsZero() && !t.Time.Before(to)) {
+			continue
+		}
+		list = append(list, t)
+	}
+	return
+}
+
+//----------------------------------------------------------------------
+// Candles
+//----------------------------------------------------------------------
+
+// Candle summarizes the trades in an interval (OHLCV).
+type Candle struct {
+	Start  time.Time `json:"start"`  // begin of interval
+	Open   float64   `json:"open"`   // price of first trade
+	High   float64   `json:"high"`   // highest price
+	Low    float64   `json:"low"`    // lowest price
+	Close  float64   `json:"close"`  // price of last trade
+	Amount uint64    `json:"amount"` // BTC volume (sats)
+	Volume float64   `json:"volume"` // counter currency volume
+	Trades int       `json:"trades"` // number of trades
+}
+
+// align returns the start of the interval containing t; intervals are
+// aligned to the Unix epoch (unlike time.Truncate).
+func align(t time.Time, interval time.Duration) time.Time {
+	ns := t.UnixNano()
+	rem := ns % int64(interval)
+	if rem < 0 {
+		rem += int64(interval)
+	}
+	return time.Unix(0, ns-rem).UTC()
+}
+
+// Candles returns the candles of a currency for intervals of given
+// length (aligned to the Unix epoch, UTC). Intervals without trades are
+// skipped.
+func Candles(trades []*Trade, curr string, interval time.Duration) ([]*Candle, error) {
+	if interval <= 0 {
+		return nil, ErrInterval
+	}
+	list := Filter(trades, curr, time.Time{}, time.Time{})
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+	var (
+		candles []*Candle
+		c       *Candle
+	)
+	for _, t := range list {
+		start := align(t.Time, interval)
+		if c == nil || !c.Start.Equal(start) {
+			c = &Candle{
+				Start: start,
+				Open:  t.Price,
+				High:  t.Price,
+				Low:   t.Price,
+			}
+			candles = append(candles, c)
+		}
+		c.High = math.Max(c.High, t.Price)
+		c.Low = math.Min(c.Low, t.Price)
+		c.Close = t.Price
+		c.Amount += t.Amount
+		c.Volume += t.Volume
+		c.Trades++
+	}
+	return candles, nil
+}
+
+//----------------------------------------------------------------------
+// Volume by payment method
+//----------------------------------------------------------------------
+
+// MethodVolume is the trade volume of a payment method.
+type MethodVolume struct {
+	PaymentMethod string  `json:"paymentMethod"` // payment method ID
+	Amount        uint64  `json:"amount"`        // BTC volume (sats)
+	Volume        float64 `json:"volume"`        // counter currency volume
+	Trades        int     `json:"trades"`        // number of trades
+	Share         float64 `json:"share"`         // share of BTC volume
+}
+
+// VolumeByPaymentMethod returns the volume per payment method for a
+// currency ("" for all currencies; the counter volume is then meaningless)
+// in the period [from,to), sorted by descending BTC volume.
+func VolumeByPaymentMethod(trades []*Trade, curr string, from, to time.Time) []*MethodVolume {
+	methods := make(map[string]*MethodVolume)
+	var total uint64
+	for _, t := range Filter(trades, curr, from, to) {
+		mv, ok := methods[t.PaymentMethod]
+		if !ok {
+			mv = &MethodVolume{PaymentMethod: t.PaymentMethod}
+			methods[t.PaymentMethod] = mv
+		}
+		mv.Amount += t.Amount
+		mv.Volume += t.Volume
+		mv.Trades++
+		total += t.Amount
+	}
+	list := make([]*MethodVolume, 0, len(methods))
+	for _, mv := range methods {
+		mv.Share = float64(mv.Amount) / float64(total)
+		list = append(list, mv)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Amount == list[j].Amount {
+			return list[i].PaymentMethod < list[j].PaymentMethod
+		}
+		return list[i].Amount > list[j].Amount
+	})
+	return list
+}
+
+//----------------------------------------------------------------------
+// Volume-weighted average price
+//----------------------------------------------------------------------
+
+// VWAP returns the volume-weighted average price of a currency over the
+// last days before now.
+func VWAP(trades []*Trade, curr string, days int, now time.Time) (float64, error) {
+	from := now.Add(-time.Duration(days) * 24 * time.Hour)
+	var (
+		amount uint64
+		sum    float64
+	)
+	for _, t := range Filter(trades, curr, from, now) {
+		amount += t.Amount
+		sum += t.Price * float64(t.Amount)
+	}
+	if amount == 0 {
+		return 0, ErrNoTrades
+	}
+	return sum / float64(amount), nil
+}
@@ -0,0 +1,171 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"github.com/bfix/bisquit/store"
+)
+
+// base time of test trades
+var t0 = time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+
+// entry creates a trade statistics entry
+func entry(curr string, price, amount int64, method string, offset time.Duration) *bisquit.TradeStatistics3 {
+	return &bisquit.TradeStatistics3{
+		Currency:      curr,
+		Price:         price,
+		Amount:        amount,
+		PaymentMethod: method,
+		Date:          t0.Add(offset).UnixMilli(),
+		Hash:          []byte(curr + method + offset.String()),
+	}
+}
+
+// test history
+var history = []*bisquit.TradeStatistics3{
+	entry("EUR", 300000000, 1000000, "SEPA", 3*time.Hour),
+	entry("EUR", 250000000, 2000000, "SEPA", time.Hour),
+	entry("EUR", 310000000, 1000000, "REVOLUT", 2*time.Hour),
+	entry("EUR", 260000000, 1000000, "SEPA", 30*time.Minute),
+	entry("XMR", 600000, 10000000, "BLOCK_CHAINS", time.Hour),
+	entry("EUR", 0, 1000000, "SEPA", time.Hour), // invalid
+}
+
+func TestNormalize(t *testing.T) {
+	eur := Normalize(history[0])
+	if eur.Price != 30000 || math.Abs(eur.Volume-300) > 1e-9 {
+		t.Fatalf("wrong EUR trade: %v", eur)
+	}
+	xmr := Normalize(history[4])
+	if xmr.Price != 0.006 || math.Abs(xmr.Volume-16.6666666) > 1e-6 {
+		t.Fatalf("wrong XMR trade: %v", xmr)
+	}
+	if Precision("eur") != 4 || Precision("XMR") != 8 {
+		t.Fatal("wrong precision")
+	}
+	trades := NormalizeAll(history)
+	if len(trades) != 5 || !trades[0].Time.Equal(t0.Add(30*time.Minute)) {
+		t.Fatalf("wrong trades: %v", trades)
+	}
+}
+
+func TestCandles(t *testing.T) {
+	trades := NormalizeAll(history)
+	if _, err := Candles(trades, "EUR", 0); err != ErrInterval {
+		t.Fatal("invalid interval accepted")
+	}
+	candles, err := Candles(trades, "EUR", 2*time.Hour)
+	if err != nil || len(candles) != 2 {
+		t.Fatalf("wrong candles: %v (%v)", candles, err)
+	}
+	c := candles[0]
+	if !c.Start.Equal(t0) || c.Open != 26000 || c.High != 26000 || c.Low != 25000 || c.Close != 25000 ||
+		c.Amount != 3000000 || c.Trades != 2 || math.Abs(c.Volume-760) > 1e-9 {
+		t.Fatalf("wrong candle: %v", c)
+	}
+	c = candles[1]
+	if !c.Start.Equal(t0.Add(2*time.Hour)) || c.Open != 31000 || c.Close != 30000 || c.Trades != 2 {
+		t.Fatalf("wrong candle: %v", c)
+	}
+	// weeks start on Thursdays (like the Unix epoch)
+	weeks, err := Candles(trades, "EUR", 7*24*time.Hour)
+	if err != nil || len(weeks) != 1 || !weeks[0].Start.Equal(time.Date(2023, 4, 27, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("wrong weekly candles: %v (%v)", weeks, err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = WriteCandlesCSV(buf, "EUR", candles); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || lines[1] != "2023-05-01T00:00:00Z,26000.0000,26000.0000,25000.0000,25000.0000,0.03000000,760.00,2" {
+		t.Fatalf("wrong CSV: %s", buf.String())
+	}
+	buf.Reset()
+	if err = WriteJSON(buf, candles); err != nil {
+		t.Fatal(err)
+	}
+	var res []*Candle
+	if err = json.Unmarshal(buf.Bytes(), &res); err != nil || len(res) != 2 || res[1].High != 31000 {
+		t.Fatalf("wrong JSON: %s", buf.String())
+	}
+}
+
+func TestVolume(t *testing.T) {
+	trades := NormalizeAll(history)
+	list := VolumeByPaymentMethod(trades, "EUR", time.Time{}, time.Time{})
+	if len(list) != 2 || list[0].PaymentMethod != "SEPA" || list[0].Amount != 4000000 || list[0].Share != 0.8 {
+		t.Fatalf("wrong volumes: %v", list[0])
+	}
+	list = VolumeByPaymentMethod(trades, "EUR", t0.Add(2*time.Hour), time.Time{})
+	if len(list) != 2 || list[0].Share != 0.5 || list[0].PaymentMethod != "REVOLUT" {
+		t.Fatalf("wrong volumes: %v", list[0])
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteMethodsCSV(buf, "EUR", list); err != nil || !strings.Contains(buf.String(), "SEPA,0.01000000,300.00,1,0.5000") {
+		t.Fatalf("wrong CSV: %s", buf.String())
+	}
+
+	now := t0.Add(24 * time.Hour)
+	vwap, err := VWAP(trades, "EUR", 1, now)
+	if err != nil || math.Abs(vwap-27400) > 1e-9 {
+		t.Fatalf("wrong VWAP: %f (%v)", vwap, err)
+	}
+	if _, err = VWAP(trades, "USD", 1, now); err != ErrNoTrades {
+		t.Fatal("VWAP without trades")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "db")
+	if err := os.Mkdir(db, 0700); err != nil {
+		t.Fatal(err)
+	}
+	data, err := store.Encode(&bisquit.PersistableEnvelope{
+		Message: &bisquit.PersistableEnvelope_TradeStatistics3Store{
+			TradeStatistics3Store: &bisquit.TradeStatistics3Store{Items: history},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(db, store.FileTradeStatistics), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	trades, err := Load(db)
+	if err != nil || len(trades) != 5 {
+		t.Fatalf("wrong trades: %v (%v)", trades, err)
+	}
+	buf := new(bytes.Buffer)
+	if err = WriteTradesCSV(buf, trades); err != nil || !strings.Contains(buf.String(), "XMR,0.00600000,0.10000000,16.66666667,BLOCK_CHAINS") {
+		t.Fatalf("wrong CSV: %s", buf.String())
+	}
+}
@@ -0,0 +1,349 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bfix/bisquit"
+)
+
+// Error codes
+var (
+	ErrBookOneSided = fmt.Errorf("Offer book has no bids or no asks")
+	ErrBookSide     = fmt.Errorf("Invalid offer book side")
+)
+
+// Sides of the offer book (from the view of the offer makers)
+const (
+	SideBid = "bid" // maker buys BTC
+	SideAsk = "ask" // maker sells BTC
+)
+
+// BookEntry is an offer in the offer book. Prices are always in units of
+// the currency per BTC: prices of crypto offers (BTC per coin in Bisq) are
+// inverted.
+type BookEntry struct {
+	Offer       *bisquit.OfferInfo `json:"-"`           // offer information
+	ID          string             `json:"id"`          // offer identifier
+	Side        string             `json:"side"`        // book side (bid or ask)
+	Method      string             `json:"method"`      // payment method ID
+	Price       float64            `json:"price"`       // effective price
+	Premium     float64            `json:"premium"`     // price above market price (percent)
+	MarketBased bool               `json:"marketBased"` // price follows market price
+	Margin      float64            `json:"margin"`      // market price margin (percent)
+	Amount      uint64             `json:"amount"`      // max. BTC amount (sats)
+	MinAmount   uint64             `json:"minAmount"`   // min. BTC amount (sats)
+}
+
+// OfferBook is a snapshot of the offers for a currency.
+type OfferBook struct {
+	Currency string       `json:"currency"` // currency code
+	Market   float64      `json:"market"`   // market price (currency per BTC)
+	Time     time.Time    `json:"time"`     // time of snapshot
+	Bids     []*BookEntry `json:"bids"`     // buy offers (best first)
+	Asks     []*BookEntry `json:"asks"`     // sell offers (best first)
+}
+
+// perBTC converts a price in Bisq convention to currency per BTC.
+func perBTC(p float64, curr string) float64 {
+	if IsFiat(curr) || p == 0 {
+		return p
+	}
+	return 1 / p
+}
+
+// NewOfferBook builds an offer book from a list of offers for a currency
+// and the market price (in Bisq convention as returned by GetMarketPrice).
+// Offers without a valid price are skipped; offers without a price but
+// with a market price margin are priced at the market price plus/minus
+// the margin.
+func NewOfferBook(curr string, offers []*bisquit.OfferInfo, market float64) *OfferBook {
+	curr = strings.ToUpper(curr)
+	b := &OfferBook{
+		Currency: curr,
+		Market:   perBTC(market, curr),
+		Time:     time.Now().UTC(),
+	}
+	for _, o := range offers {
+		e := &BookEntry{
+			Offer:       o,
+			ID:          o.Id,
+			Side:        SideAsk,
+			Method:      o.PaymentMethodId,
+			MarketBased: o.UseMarketBasedPrice,
+			Amount:      o.Amount,
+			MinAmount:   o.MinAmount,
+		}
+		if strings.EqualFold(o.Direction, "BUY") {
+			e.Side = SideBid
+		}
+		if e.MarketBased {
+			e.Margin = o.MarketPriceMarginPct
+		}
+		p, err := strconv.ParseFloat(o.Price, 64)
+		if err == nil && p > 0 {
+			e.Price = perBTC(p, curr)
+		} else if e.MarketBased && b.Market > 0 {
+			// sellers ask for more, buyers bid less than market price
+			if e.Side == SideAsk {
+				e.Price = b.Market * (1 + e.Margin/100)
+			} else {
+				e.Price = b.Market * (1 - e.Margin/100)
+			}
+		} else {
+			continue
+		}
+		if b.Market > 0 {
+			e.Premium = 100 * (e.Price - b.Market) / b.Market
+		}
+		if e.Side == SideBid {
+			b.Bids = append(b.Bids, e)
+		} else {
+			b.Asks = append(b.Asks, e)
+		}
+	}
+	// best prices first (larger amount first for equal prices)
+	sort.SliceStable(b.Bids, func(i, j int) bool {
+		if b.Bids[i].Price != b.Bids[j].Price {
+			return b.Bids[i].Price > b.Bids[j].Price
+		}
+		return b.Bids[i].Amount > b.Bids[j].Amount
+	})
+	sort.SliceStable(b.Asks, func(i, j int) bool {
+		if b.Asks[i].Price != b.Asks[j].Price {
+			return b.Asks[i].Price < b.Asks[j].Price
+		}
+		return b.Asks[i].Amount > b.Asks[j].Amount
+	})
+	return b
+}
+
+// LoadOfferBook requests the current offers and market price for a
+// currency from the daemon.
+func LoadOfferBook(ctx context.Context, c *bisquit.Client, curr string) (*OfferBook, error) {
+	market, err := c.GetMarketPrice(ctx, curr)
+	if err != nil {
+		return nil, err
+	}
+	var offers []*bisquit.OfferInfo
+	for _, dir := range []string{"BUY", "SELL"} {
+		list, err := c.GetOffers(ctx, dir, curr)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, list...)
+	}
+	return NewOfferBook(curr, offers, market), nil
+}
+
+// BestBid returns the bid with the highest price (or nil).
+func (b *OfferBook) BestBid() *BookEntry {
+	if len(b.Bids) == 0 {
+		return nil
+	}
+	return b.Bids[0]
+}
+
+// BestAsk returns the ask with the lowest price (or nil).
+func (b *OfferBook) BestAsk() *BookEntry {
+	if len(b.Asks) == 0 {
+		return nil
+	}
+	return b.Asks[0]
+}
+
+// Mid returns the price between best bid and best ask.
+func (b *OfferBook) Mid() (float64, error) {
+	bid, ask := b.BestBid(), b.BestAsk()
+	if bid == nil || ask == nil {
+		return 0, ErrBookOneSided
+	}
+	return (bid.Price + ask.Price) / 2, nil
+}
+
+// Spread returns the difference between best ask and best bid, absolute
+// and in percent of the mid price. The spread is negative for a crossed
+// book.
+func (b *OfferBook) Spread() (spread, pct float64, err error) {
+	var mid float64
+	if mid, err = b.Mid(); err != nil {
+		return
+	}
+	spread = b.BestAsk().Price - b.BestBid().Price
+	pct = 100 * spread / mid
+	return
+}
+
+// side returns the entries of a book side
+func (b *OfferBook) side(side string) ([]*BookEntry, error) {
+	switch side {
+	case SideBid:
+		return b.Bids, nil
+	case SideAsk:
+		return b.Asks, nil
+	}
+	return nil, ErrBookSide
+}
+
+// DepthLevel is an aggregated price level of the offer book.
+type DepthLevel struct {
+	Price      float64 `json:"price"`      // level price
+	Amount     uint64  `json:"amount"`     // BTC amount at level (sats)
+	Offers     int     `json:"offers"`     // number of offers at level
+	Cumulative uint64  `json:"cumulative"` // BTC amount up to this level (sats)
+}
+
+// Depth aggregates a side of the book into price levels (best first) of
+// the given step size (zero uses the exact offer prices). Bid prices are
+// rounded down and ask prices up to the step size.
+func (b *OfferBook) Depth(side string, step float64) ([]*DepthLevel, error) {
+	entries, err := b.side(side)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		list []*DepthLevel
+		cum  uint64
+	)
+	for _, e := range entries {
+		p := e.Price
+		if step > 0 {
+			if side == SideBid {
+				p = math.Floor(p/step) * step
+			} else {
+				p = math.Ceil(p/step) * step
+			}
+		}
+		if n := len(list); n == 0 || list[n-1].Price != p {
+			list = append(list, &DepthLevel{Price: p})
+		}
+		lvl := list[len(list)-1]
+		cum += e.Amount
+		lvl.Amount += e.Amount
+		lvl.Offers++
+		lvl.Cumulative = cum
+	}
+	return list, nil
+}
+
+// DepthWithin returns the BTC amount (sats) offered on a side of the book
+// at prices within pct percent of the market price.
+func (b *OfferBook) DepthWithin(side string, pct float64) (uint64, error) {
+	entries, err := b.side(side)
+	if err != nil {
+		return 0, err
+	}
+	var sum uint64
+	for _, e := range entries {
+		if math.Abs(e.Premium) <= pct {
+			sum += e.Amount
+		}
+	}
+	return sum, nil
+}
+
+// Filter returns a book with the offers for a payment method.
+func (b *OfferBook) Filter(method string) *OfferBook {
+	fb := &OfferBook{
+		Currency: b.Currency,
+		Market:   b.Market,
+		Time:     b.Time,
+	}
+	for _, e := range b.Bids {
+		if e.Method == method {
+			fb.Bids = append(fb.Bids, e)
+		}
+	}
+	for _, e := range b.Asks {
+		if e.Method == method {
+			fb.Asks = append(fb.Asks, e)
+		}
+	}
+	return fb
+}
+
+// MethodBook summarizes the offers for a payment method.
+type MethodBook struct {
+	Method     string  `json:"method"`     // payment method ID
+	Bids       int     `json:"bids"`       // number of bids
+	Asks       int     `json:"asks"`       // number of asks
+	BidAmount  uint64  `json:"bidAmount"`  // BTC amount of bids (sats)
+	AskAmount  uint64  `json:"askAmount"`  // BTC amount of asks (sats)
+	BestBid    float64 `json:"bestBid"`    // highest bid price (or 0)
+	BestAsk    float64 `json:"bestAsk"`    // lowest ask price (or 0)
+	BidPremium float64 `json:"bidPremium"` // amount-weighted premium of bids
+	AskPremium float64 `json:"askPremium"` // amount-weighted premium of asks
+}
+
+// weighted premium of entries
+func premium(entries []*BookEntry) (amount uint64, prem float64) {
+	var sum float64
+	for _, e := range entries {
+		amount += e.Amount
+		sum += e.Premium * float64(e.Amount)
+	}
+	if amount > 0 {
+		prem = sum / float64(amount)
+	}
+	return
+}
+
+// Methods returns the offer book summary per payment method (sorted by
+// total amount, largest first).
+func (b *OfferBook) Methods() []*MethodBook {
+	methods := make(map[string]bool)
+	for _, e := range append(append([]*BookEntry{}, b.Bids...), b.Asks...) {
+		methods[e.Method] = true
+	}
+	var list []*MethodBook
+	for method := range methods {
+		fb := b.Filter(method)
+		mb := &MethodBook{
+			Method: method,
+			Bids:   len(fb.Bids),
+			Asks:   len(fb.Asks),
+		}
+		mb.BidAmount, mb.BidPremium = premium(fb.Bids)
+		mb.AskAmount, mb.AskPremium = premium(fb.Asks)
+		if e := fb.BestBid(); e != nil {
+			mb.BestBid = e.Price
+		}
+		if e := fb.BestAsk(); e != nil {
+			mb.BestAsk = e.Price
+		}
+		list = append(list, mb)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ai, aj := list[i].BidAmount+list[i].AskAmount, list[j].BidAmount+list[j].AskAmount
+		if ai != aj {
+			return ai > aj
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list
+}
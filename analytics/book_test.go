@@ -0,0 +1,113 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package analytics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/bfix/bisquit"
+)
+
+// test offers (market price 30000 EUR)
+var offers = []*bisquit.OfferInfo{
+	{Id: "b1", Direction: "BUY", Price: "29700.0000", Amount: 1000000, MinAmount: 500000, PaymentMethodId: "SEPA"},
+	{Id: "b2", Direction: "BUY", UseMarketBasedPrice: true, MarketPriceMarginPct: 2, Amount: 2000000, PaymentMethodId: "REVOLUT"},
+	{Id: "b3", Direction: "BUY", Price: "29750.0000", Amount: 3000000, PaymentMethodId: "SEPA"},
+	{Id: "a1", Direction: "SELL", Price: "30300.0000", Amount: 1000000, PaymentMethodId: "SEPA"},
+	{Id: "a2", Direction: "SELL", Price: "30900.0000", UseMarketBasedPrice: true, MarketPriceMarginPct: 3, Amount: 4000000, PaymentMethodId: "SEPA"},
+	{Id: "x", Direction: "SELL", Price: "invalid", Amount: 1000000, PaymentMethodId: "SEPA"},
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestOfferBook(t *testing.T) {
+	b := NewOfferBook("eur", offers, 30000)
+	if len(b.Bids) != 3 || len(b.Asks) != 2 {
+		t.Fatalf("wrong book: %d bids, %d asks", len(b.Bids), len(b.Asks))
+	}
+	// order and effective prices
+	if b.Bids[0].ID != "b3" || b.Bids[1].ID != "b1" || b.Bids[2].ID != "b2" || !near(b.Bids[2].Price, 29400) {
+		t.Fatalf("wrong bids: %v %v %v", b.Bids[0], b.Bids[1], b.Bids[2])
+	}
+	if !near(b.Bids[2].Premium, -2) || !near(b.Asks[1].Premium, 3) || !b.Asks[1].MarketBased {
+		t.Fatalf("wrong premiums: %v %v", b.Bids[2], b.Asks[1])
+	}
+	spread, pct, err := b.Spread()
+	if err != nil || !near(spread, 550) || !near(pct, 100*550/30025.0) {
+		t.Fatalf("wrong spread: %f %f (%v)", spread, pct, err)
+	}
+
+	// depth
+	levels, err := b.Depth(SideBid, 100)
+	if err != nil || len(levels) != 2 {
+		t.Fatalf("wrong depth: %v (%v)", levels, err)
+	}
+	if levels[0].Price != 29700 || levels[0].Offers != 2 || levels[0].Amount != 4000000 || levels[1].Cumulative != 6000000 {
+		t.Fatalf("wrong levels: %v %v", levels[0], levels[1])
+	}
+	if levels, _ = b.Depth(SideAsk, 0); len(levels) != 2 || levels[1].Cumulative != 5000000 {
+		t.Fatalf("wrong ask levels: %v", levels)
+	}
+	if _, err = b.Depth("both", 0); err != ErrBookSide {
+		t.Fatal("invalid side accepted")
+	}
+	if d, _ := b.DepthWithin(SideBid, 1); d != 4000000 {
+		t.Fatalf("wrong depth within 1%%: %d", d)
+	}
+
+	// payment methods
+	methods := b.Methods()
+	if len(methods) != 2 || methods[0].Method != "SEPA" {
+		t.Fatalf("wrong methods: %v", methods)
+	}
+	if m := methods[0]; m.Bids != 2 || m.Asks != 2 || m.BestBid != 29750 || m.BestAsk != 30300 || !near(m.AskPremium, (1+4*3)/5.0) {
+		t.Fatalf("wrong SEPA summary: %+v", *m)
+	}
+	if _, _, err = b.Filter("REVOLUT").Spread(); err != ErrBookOneSided {
+		t.Fatal("one-sided book has spread")
+	}
+
+	// export
+	buf := new(bytes.Buffer)
+	if err = WriteBookCSV(buf, b); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 6 || lines[1] != "b3,bid,SEPA,29750.0000,-0.83,,0.00000000,0.03000000" {
+		t.Fatalf("wrong CSV:\n%s", buf.String())
+	}
+}
+
+func TestOfferBookCrypto(t *testing.T) {
+	// crypto prices are BTC per coin
+	list := []*bisquit.OfferInfo{
+		{Id: "b", Direction: "BUY", Price: "0.00400000", Amount: 1000000},
+		{Id: "a", Direction: "SELL", Price: "0.00390000", Amount: 1000000},
+	}
+	b := NewOfferBook("XMR", list, 0.004)
+	if !near(b.Market, 250) || !near(b.BestBid().Price, 250) || b.BestAsk().Premium <= 0 {
+		t.Fatalf("wrong crypto book: %v %v", b.BestBid(), b.BestAsk())
+	}
+}
@@ -0,0 +1,142 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// formatting helpers
+func price(p float64, curr string) string {
+	return strconv.FormatFloat(p, 'f', Precision(curr), 64)
+}
+
+func volume(v float64, curr string) string {
+	// crypto volumes in coins, fiat volumes in cents
+	prec := 8
+	if IsFiat(curr) {
+		prec = 2
+	}
+	return strconv.FormatFloat(v, 'f', prec, 64)
+}
+
+func btc(sats uint64) string {
+	return strconv.FormatFloat(float64(sats)/1e8, 'f', 8, 64)
+}
+
+// writeCSV writes header and rows
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	wrt := csv.NewWriter(w)
+	if err := wrt.Write(header); err != nil {
+		return err
+	}
+	if err := wrt.WriteAll(rows); err != nil {
+		return err
+	}
+	wrt.Flush()
+	return wrt.Error()
+}
+
+// WriteCandlesCSV exports candles of a currency in CSV format.
+func WriteCandlesCSV(w io.Writer, curr string, candles []*Candle) error {
+	rows := make([][]string, len(candles))
+	for i, c := range candles {
+		rows[i] = []string{
+			c.Start.UTC().Format(time.RFC3339),
+			price(c.Open, curr), price(c.High, curr), price(c.Low, curr), price(c.Close, curr),
+			btc(c.Amount), volume(c.Volume, curr), strconv.Itoa(c.Trades),
+		}
+	}
+	return writeCSV(w, []string{"start", "open", "high", "low", "close", "amount", "volume", "trades"}, rows)
+}
+
+// WriteMethodsCSV exports the volume by payment method of a currency in
+// CSV format.
+func WriteMethodsCSV(w io.Writer, curr string, list []*MethodVolume) error {
+	rows := make([][]string, len(list))
+	for i, mv := range list {
+		rows[i] = []string{
+			mv.PaymentMethod, btc(mv.Amount), volume(mv.Volume, curr),
+			strconv.Itoa(mv.Trades), strconv.FormatFloat(mv.Share, 'f', 4, 64),
+		}
+	}
+	return writeCSV(w, []string{"method", "amount", "volume", "trades", "share"}, rows)
+}
+
+// WriteTradesCSV exports normalized trades in CSV format.
+func WriteTradesCSV(w io.Writer, trades []*Trade) error {
+	rows := make([][]string, len(trades))
+	for i, t := range trades {
+		rows[i] = []string{
+			t.Time.UTC().Format(time.RFC3339), t.Currency, price(t.Price, t.Currency),
+			btc(t.Amount), volume(t.Volume, t.Currency), t.PaymentMethod,
+		}
+	}
+	return writeCSV(w, []string{"time", "currency", "price", "amount", "volume", "method"}, rows)
+}
+
+// percentage formatting
+func percent(p float64) string {
+	return strconv.FormatFloat(p, 'f', 2, 64)
+}
+
+// WriteBookCSV exports the offers of an offer book (bids first) in CSV
+// format.
+func WriteBookCSV(w io.Writer, b *OfferBook) error {
+	var rows [][]string
+	for _, list := range [][]*BookEntry{b.Bids, b.Asks} {
+		for _, e := range list {
+			margin := ""
+			if e.MarketBased {
+				margin = percent(e.Margin)
+			}
+			rows = append(rows, []string{
+				e.ID, e.Side, e.Method, price(e.Price, b.Currency), percent(e.Premium),
+				margin, btc(e.MinAmount), btc(e.Amount),
+			})
+		}
+	}
+	return writeCSV(w, []string{"id", "side", "method", "price", "premium", "margin", "minAmount", "amount"}, rows)
+}
+
+// WriteDepthCSV exports the price levels of an offer book side in CSV
+// format.
+func WriteDepthCSV(w io.Writer, curr string, levels []*DepthLevel) error {
+	rows := make([][]string, len(levels))
+	for i, l := range levels {
+		rows[i] = []string{
+			price(l.Price, curr), btc(l.Amount), strconv.Itoa(l.Offers), btc(l.Cumulative),
+		}
+	}
+	return writeCSV(w, []string{"price", "amount", "offers", "cumulative"}, rows)
+}
+
+// WriteJSON exports candles, method volumes, trades or offer books in
+// JSON format.
+func WriteJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -21,7 +21,18 @@
 package bisquit
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Error codes
+var (
+	ErrCredentialEmpty = fmt.Errorf("Empty API password")
 )
 
 // PasswordCredential for Bisq API authentication:
@@ -39,3 +50,244 @@ func (c PasswordCredential) GetRequestMetadata(ctx context.Context, uri ...strin
 func (c PasswordCredential) RequireTransportSecurity() bool {
 	return false
 }
+
+// Credential returns the password (CredentialProvider interface)
+func (c PasswordCredential) Credential(ctx context.Context) ([]byte, error) {
+	return []byte(c), nil
+}
+
+//----------------------------------------------------------------------
+// Secret buffer
+//----------------------------------------------------------------------
+
+// SecretBuffer holds a secret in memory that can be wiped. It never
+// reveals the secret when printed.
+type SecretBuffer struct {
+	buf []byte     // secret bytes
+	mtx sync.Mutex // serialize access
+}
+
+// NewSecretBuffer creates a buffer with a copy of the secret.
+func NewSecretBuffer(secret []byte) *SecretBuffer {
+	b := new(SecretBuffer)
+	b.Set(secret)
+	return b
+}
+
+// Set a new secret (a copy is stored); the old secret is wiped.
+func (b *SecretBuffer) Set(secret []byte) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	Wipe(b.buf)
+	b.buf = append([]byte(nil), secret...)
+}
+
+// Copy returns a copy of the secret (nil if empty or wiped). The caller
+// should wipe the copy after use.
+func (b *SecretBuffer) Copy() []byte {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if len(b.buf) == 0 {
+		return nil
+	}
+	return append([]byte(nil), b.buf...)
+}
+
+// Empty returns true if no secret is stored.
+func (b *SecretBuffer) Empty() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return len(b.buf) == 0
+}
+
+// Wipe the secret.
+func (b *SecretBuffer) Wipe() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	Wipe(b.buf)
+	b.buf = nil
+}
+
+// String hides the secret.
+func (b *SecretBuffer) String() string {
+	return "[redacted]"
+}
+
+//----------------------------------------------------------------------
+// Credential providers
+//----------------------------------------------------------------------
+
+// CredentialProvider provides the API password for a request. The caller
+// wipes the returned buffer after use.
+type CredentialProvider interface {
+	Credential(ctx context.Context) ([]byte, error)
+}
+
+// WithCredentials uses a credential provider for the API password (the
+// password argument of NewClient is ignored).
+func WithCredentials(p CredentialProvider) Option {
+	return func(c *Client) {
+		c.creds = &providerCredential{p}
+	}
+}
+
+// providerCredential adapts a provider to gRPC per-RPC credentials.
+type providerCredential struct {
+	p CredentialProvider
+}
+
+// GetRequestMetadata for API password authentication. The metadata is
+// passed as string to gRPC, so the password is copied once per request.
+func (c *providerCredential) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	passwd, err := c.p.Credential(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(passwd)
+	if len(passwd) == 0 {
+		return nil, ErrCredentialEmpty
+	}
+	return map[string]string{
+		"password": string(passwd),
+	}, nil
+}
+
+// RequireTransportSecurity signals that insecure (local) connections are fine
+func (c *providerCredential) RequireTransportSecurity() bool {
+	return false
+}
+
+// StaticCredential is a fixed API password kept in a secret buffer.
+type StaticCredential struct {
+	SecretBuffer
+}
+
+// NewStaticCredential creates a provider for a fixed password.
+func NewStaticCredential(passwd []byte) *StaticCredential {
+	c := new(StaticCredential)
+	c.Set(passwd)
+	return c
+}
+
+// Credential returns the password
+func (c *StaticCredential) Credential(ctx context.Context) ([]byte, error) {
+	return c.Copy(), nil
+}
+
+// EnvCredential reads the password from the named environment variable
+// on every request.
+type EnvCredential string
+
+// Credential returns the value of the environment variable
+func (c EnvCredential) Credential(ctx context.Context) ([]byte, error) {
+	return EnvSecret(c).Secret(ctx)
+}
+
+// CredentialFunc is a callback function implementing the CredentialProvider
+// interface.
+type CredentialFunc func(ctx context.Context) ([]byte, error)
+
+// Credential returns the result of the callback
+func (f CredentialFunc) Credential(ctx context.Context) ([]byte, error) {
+	return f(ctx)
+}
+
+// FileCredential reads the password from a file (trailing line breaks are
+// removed). The file is read again if it changed, so the password can be
+// rotated without restarting the client.
+type FileCredential struct {
+	path string       // path to password file
+	buf  SecretBuffer // current password
+	mod  time.Time    // modification time of file
+	size int64        // size of file
+	mtx  sync.Mutex   // serialize access
+}
+
+// NewFileCredential creates a provider reading the password from a file.
+func NewFileCredential(path string) *FileCredential {
+	return &FileCredential{
+		path: path,
+	}
+}
+
+// Credential returns the (current) password from the file.
+func (c *FileCredential) Credential(ctx context.Context) ([]byte, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		return nil, err
+	}
+	if c.buf.Empty() || !fi.ModTime().Equal(c.mod) || fi.Size() != c.size {
+		secret, err := FileSecret(c.path).Secret(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.buf.Set(secret)
+		Wipe(secret)
+		c.mod, c.size = fi.ModTime(), fi.Size()
+	}
+	return c.buf.Copy(), nil
+}
+
+// Wipe the cached password.
+func (c *FileCredential) Wipe() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.buf.Wipe()
+}
+
+// CommandCredential runs an external command (like "pass show bisq/api"
+// or "secret-tool lookup service bisq") that prints the password on
+// stdout. The password is cached for the given period (zero runs the
+// command on every request, negative caches until wiped).
+type CommandCredential struct {
+	name    string        // command name
+	args    []string      // command arguments
+	ttl     time.Duration // cache period
+	buf     SecretBuffer  // cached password
+	fetched time.Time     // time of last command run
+	mtx     sync.Mutex    // serialize access
+}
+
+// NewCommandCredential creates a provider running a command.
+func NewCommandCredential(ttl time.Duration, name string, args ...string) *CommandCredential {
+	return &CommandCredential{
+		name: name,
+		args: args,
+		ttl:  ttl,
+	}
+}
+
+// Credential returns the (cached) output of the command.
+func (c *CommandCredential) Credential(ctx context.Context) ([]byte, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if !c.buf.Empty() && (c.ttl < 0 || (c.ttl > 0 && time.Since(c.fetched) < c.ttl)) {
+		return c.buf.Copy(), nil
+	}
+	cmd := exec.CommandContext(ctx, c.name, c.args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		Wipe(out)
+		return nil, err
+	}
+	defer Wipe(out)
+	secret := bytes.TrimRight(out, "\r\n")
+	if len(secret) == 0 {
+		return nil, ErrCredentialEmpty
+	}
+	if c.ttl != 0 {
+		c.buf.Set(secret)
+		c.fetched = time.Now()
+	}
+	return append([]byte(nil), secret...), nil
+}
+
+// Wipe the cached password.
+func (c *CommandCredential) Wipe() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.buf.Wipe()
+}
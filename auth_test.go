@@ -0,0 +1,126 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSecretBuffer(t *testing.T) {
+	b := NewSecretBuffer([]byte("secret"))
+	if fmt.Sprintf("%v %s", b, b) != "[redacted] [redacted]" {
+		t.Fatal("secret revealed")
+	}
+	cp := b.Copy()
+	if string(cp) != "secret" {
+		t.Fatalf("wrong secret '%s'", string(cp))
+	}
+	Wipe(cp)
+	if string(b.Copy()) != "secret" {
+		t.Fatal("copy not independent")
+	}
+	b.Wipe()
+	if !b.Empty() || b.Copy() != nil {
+		t.Fatal("secret not wiped")
+	}
+}
+
+func TestFileCredential(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "passwd")
+	if err := os.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := NewFileCredential(path)
+	pw, err := c.Credential(ctx)
+	if err != nil || string(pw) != "first" {
+		t.Fatalf("wrong password '%s' (%v)", string(pw), err)
+	}
+	// rotate password
+	os.WriteFile(path, []byte("second\n"), 0600)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	if pw, err = c.Credential(ctx); err != nil || string(pw) != "second" {
+		t.Fatalf("wrong password '%s' (%v)", string(pw), err)
+	}
+	os.Remove(path)
+	if _, err = c.Credential(ctx); err == nil {
+		t.Fatal("missing file accepted")
+	}
+}
+
+func TestCommandCredential(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "count")
+	// command returns a different password on every run
+	script := fmt.Sprintf("echo x >> %s; wc -l < %s", path, path)
+	c := NewCommandCredential(time.Hour, "sh", "-c", script)
+	for i := 0; i < 2; i++ {
+		pw, err := c.Credential(ctx)
+		if err != nil || string(pw) != "1" {
+			t.Fatalf("wrong password '%s' (%v)", string(pw), err)
+		}
+	}
+	c.Wipe()
+	if pw, _ := c.Credential(ctx); string(pw) != "2" {
+		t.Fatalf("wrong password '%s'", string(pw))
+	}
+	c = NewCommandCredential(0, "sh", "-c", script)
+	if pw, _ := c.Credential(ctx); string(pw) != "3" {
+		t.Fatalf("wrong password '%s'", string(pw))
+	}
+	if pw, _ := c.Credential(ctx); string(pw) != "4" {
+		t.Fatalf("wrong password '%s'", string(pw))
+	}
+	if _, err := NewCommandCredential(0, "true").Credential(ctx); !errors.Is(err, ErrCredentialEmpty) {
+		t.Fatalf("empty password accepted: %v", err)
+	}
+}
+
+func TestWithCredentials(t *testing.T) {
+	needDaemon(t)
+	ctx := context.Background()
+	calls := 0
+	p := CredentialFunc(func(ctx context.Context) ([]byte, error) {
+		calls++
+		return EnvCredential("BISQ_API_PASSWORD").Credential(ctx)
+	})
+	c := NewClient(testClient.rpcHost, "", 10*time.Second, WithCredentials(p))
+	if err := c.Connect(ctx, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.GetVersion(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("provider called %d times", calls)
+	}
+	md, err := c.creds.GetRequestMetadata(ctx)
+	if err != nil || md["password"] != os.Getenv("BISQ_API_PASSWORD") {
+		t.Fatalf("wrong metadata: %v (%v)", md, err)
+	}
+}
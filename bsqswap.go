@@ -0,0 +1,342 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Error codes
+var (
+	ErrSwapDirection = fmt.Errorf("Invalid swap direction (BUY or SELL)")
+	ErrSwapPrice     = fmt.Errorf("Invalid swap price (BTC per BSQ, max. 8 decimals)")
+	ErrSwapAmount    = fmt.Errorf("Invalid swap amount")
+	ErrSwapFunds     = fmt.Errorf("Insufficient funds for swap")
+	ErrSwapNoInfo    = fmt.Errorf("Trade is not a BSQ swap")
+	ErrSwapFailed    = fmt.Errorf("BSQ swap failed")
+	ErrSwapCurrency  = fmt.Errorf("Invalid swap currency (BSQ or BTC)")
+)
+
+// DefaultSwapConfirmations is the number of confirmations of the swap
+// transaction after which a swap is considered final.
+const DefaultSwapConfirmations = 6
+
+// BsqVolume returns the BSQ amount (in units of 0.01 BSQ) for a BTC amount
+// (sats) at a price in sats per BSQ.
+func BsqVolume(amount, price uint64) uint64 {
+	if price == 0 {
+		return 0
+	}
+	return (amount*100 + price/2) / price
+}
+
+// parseSwapPrice parses a price in BTC per BSQ (returns sats per BSQ)
+func parseSwapPrice(s string) (uint64, error) {
+	price, err := ParseUnits(s, 8)
+	if err != nil || price == 0 {
+		return 0, ErrSwapPrice
+	}
+	return price, nil
+}
+
+// checkSwapFunds checks if the wallet has enough BTC (sats) and BSQ (units)
+// available for a swap. Trade and mining fees are not included.
+func (c *Client) checkSwapFunds(ctx context.Context, btc, bsq uint64) error {
+	bal, err := c.GetBalances(ctx, "")
+	if err != nil {
+		return err
+	}
+	if avail := bal.Btc.GetAvailableBalance(); btc > avail {
+		return fmt.Errorf("%w: %d sats BTC needed, %d available", ErrSwapFunds, btc, avail)
+	}
+	if avail := bal.Bsq.GetAvailableConfirmedBalance(); bsq > avail {
+		return fmt.Errorf("%w: %d units BSQ needed, %d available", ErrSwapFunds, bsq, avail)
+	}
+	return nil
+}
+
+//----------------------------------------------------------------------
+// Swap offers
+//----------------------------------------------------------------------
+
+// BsqSwapOffer builds a validated request for a new BSQ swap offer. The
+// direction refers to BTC: a "BUY" offer buys BTC for BSQ.
+type BsqSwapOffer struct {
+	req   *CreateBsqSwapOfferRequest // request to build
+	price uint64                     // price in sats per BSQ
+	err   error                      // first error in builder chain
+}
+
+// NewBsqSwapOffer starts a new swap offer for given direction.
+func NewBsqSwapOffer(direction string) *BsqSwapOffer {
+	o := &BsqSwapOffer{
+		req: &CreateBsqSwapOfferRequest{
+			Direction: strings.ToUpper(direction),
+		},
+	}
+	if o.req.Direction != "BUY" && o.req.Direction != "SELL" {
+		o.err = ErrSwapDirection
+	}
+	return o
+}
+
+// Amount sets the BTC amount range (sats) of the offer. If min is zero,
+// the offer can only be taken for the full amount.
+func (o *BsqSwapOffer) Amount(min, max uint64) *BsqSwapOffer {
+	if min == 0 {
+		min = max
+	}
+	o.req.Amount, o.req.MinAmount = max, min
+	return o
+}
+
+// Price sets the price in BTC per BSQ (like "0.00005").
+func (o *BsqSwapOffer) Price(price string) *BsqSwapOffer {
+	p, err := parseSwapPrice(price)
+	if err != nil && o.err == nil {
+		o.err = err
+	}
+	o.req.Price, o.price = strings.TrimSpace(price), p
+	return o
+}
+
+// Request returns the validated request.
+func (o *BsqSwapOffer) Request() (*CreateBsqSwapOfferRequest, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	if o.price == 0 {
+		return nil, ErrSwapPrice
+	}
+	if o.req.Amount == 0 || o.req.MinAmount > o.req.Amount {
+		return nil, fmt.Errorf("%w: min. %d sats, max. %d sats", ErrSwapAmount, o.req.MinAmount, o.req.Amount)
+	}
+	return o.req, nil
+}
+
+// Funds returns the BTC (sats) and BSQ (units) the maker needs for the
+// full offer amount (excluding fees).
+func (o *BsqSwapOffer) Funds() (btc, bsq uint64, err error) {
+	if _, err = o.Request(); err != nil {
+		return
+	}
+	if o.req.Direction == "BUY" {
+		bsq = BsqVolume(o.req.Amount, o.price)
+	} else {
+		btc = o.req.Amount
+	}
+	return
+}
+
+// Create validates the offer, checks the available balances and creates
+// the offer.
+func (o *BsqSwapOffer) Create(ctx context.Context, c *Client) (*OfferInfo, error) {
+	btc, bsq, err := o.Funds()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.checkSwapFunds(ctx, btc, bsq); err != nil {
+		return nil, err
+	}
+	return c.CreateBsqSwapOffer(ctx, o.req)
+}
+
+// TakeBsqSwapOffer takes a BSQ swap offer for a BTC amount (sats; zero
+// takes the full offer amount). The amount and the available balances
+// are checked before the offer is taken.
+func (c *Client) TakeBsqSwapOffer(ctx context.Context, offerID string, amount uint64) (*TradeInfo, error) {
+	offer, err := c.GetBsqSwapOffer(ctx, offerID)
+	if err != nil {
+		return nil, err
+	}
+	if amount == 0 {
+		amount = offer.Amount
+	}
+	if amount < offer.MinAmount || amount > offer.Amount {
+		return nil, fmt.Errorf("%w: %d sats not in range %d-%d", ErrSwapAmount, amount, offer.MinAmount, offer.Amount)
+	}
+	price, err := parseSwapPrice(offer.Price)
+	if err != nil {
+		return nil, err
+	}
+	// the taker is on the other side of the offer
+	var btc, bsq uint64
+	if strings.EqualFold(offer.Direction, "BUY") {
+		btc = amount
+	} else {
+		bsq = BsqVolume(amount, price)
+	}
+	if err = c.checkSwapFunds(ctx, btc, bsq); err != nil {
+		return nil, err
+	}
+	return c.TakeOffer(ctx, int64(amount), offerID, "", "")
+}
+
+//----------------------------------------------------------------------
+// Swap tracking
+//----------------------------------------------------------------------
+
+// WaitBsqSwap polls a swap trade until its transaction has the required
+// number of confirmations (DefaultSwapConfirmations if zero). The callback
+// (if not nil) is called whenever the number of confirmations changes.
+func (c *Client) WaitBsqSwap(ctx context.Context, tradeID string, confirmations uint64, interval time.Duration, cb func(*TradeInfo)) (*TradeInfo, error) {
+	if confirmations == 0 {
+		confirmations = DefaultSwapConfirmations
+	}
+	last := int64(-1)
+	for {
+		trade, err := c.GetTrade(ctx, tradeID)
+		if err != nil {
+			return nil, err
+		}
+		info := trade.BsqSwapTradeInfo
+		if info == nil {
+			return nil, ErrSwapNoInfo
+		}
+		if len(info.ErrorMessage) > 0 {
+			return trade, fmt.Errorf("%w: %s", ErrSwapFailed, info.ErrorMessage)
+		}
+		if int64(info.NumConfirmations) != last {
+			last = int64(info.NumConfirmations)
+			if cb != nil {
+				cb(trade)
+			}
+		}
+		if info.NumConfirmations >= confirmations {
+			return trade, nil
+		}
+		select {
+		case <-ctx.Done():
+			return trade, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+//----------------------------------------------------------------------
+// Swap reports
+//----------------------------------------------------------------------
+
+// BsqSwapReport summarizes a BSQ swap from our point of view.
+type BsqSwapReport struct {
+	Time          time.Time `json:"time"`            // date of swap
+	TradeID       string    `json:"tradeId"`         // trade identifier
+	ShortID       string    `json:"shortId"`         // short trade identifier
+	Maker         bool      `json:"maker"`           // we made the offer
+	BuyBtc        bool      `json:"buyBtc"`          // we bought BTC (for BSQ)
+	Price         string    `json:"price"`           // price (BTC per BSQ)
+	BtcAmount     uint64    `json:"btcAmount"`       // swapped BTC (sats)
+	BsqAmount     uint64    `json:"bsqAmount"`       // swapped BSQ (units)
+	Payout        uint64    `json:"payout"`          // our payout (in units of the received asset)
+	PeerPayout    uint64    `json:"peerPayout"`      // peer payout (in units of the received asset)
+	BsqFee        uint64    `json:"bsqFee"`          // our trade fee (BSQ units)
+	TxFeeRate     uint64    `json:"txFeeRate"`       // mining fee rate (sats/vbyte)
+	TxID          string    `json:"txId"`            // swap transaction
+	Confirmations uint64    `json:"confirmations"`   // confirmations of swap transaction
+	Error         string    `json:"error,omitempty"` // failure reason
+}
+
+// NewBsqSwapReport creates a report for a swap trade.
+func NewBsqSwapReport(trade *TradeInfo) (*BsqSwapReport, error) {
+	info := trade.BsqSwapTradeInfo
+	if info == nil {
+		return nil, ErrSwapNoInfo
+	}
+	r := &BsqSwapReport{
+		Time:          time.UnixMilli(int64(trade.Date)).UTC(),
+		TradeID:       trade.TradeId,
+		ShortID:       trade.ShortId,
+		Maker:         IsMaker(trade),
+		Price:         trade.TradePrice,
+		BtcAmount:     info.BtcTradeAmount,
+		BsqAmount:     info.BsqTradeAmount,
+		Payout:        info.Payout,
+		PeerPayout:    info.SwapPeerPayout,
+		TxFeeRate:     info.TxFeePerVbyte,
+		TxID:          info.TxId,
+		Confirmations: info.NumConfirmations,
+		Error:         info.ErrorMessage,
+	}
+	// offer direction refers to the maker
+	r.BuyBtc = strings.EqualFold(trade.Offer.GetDirection(), "BUY") == r.Maker
+	if r.Maker {
+		r.BsqFee = info.BsqMakerTradeFee
+	} else {
+		r.BsqFee = info.BsqTakerTradeFee
+	}
+	return r, nil
+}
+
+// GetBsqSwapReports returns the reports of all completed swaps.
+func (c *Client) GetBsqSwapReports(ctx context.Context) ([]*BsqSwapReport, error) {
+	trades, err := c.GetTrades(ctx, int(GetTradesRequest_CLOSED))
+	if err != nil {
+		return nil, err
+	}
+	var list []*BsqSwapReport
+	for _, t := range trades {
+		if r, err := NewBsqSwapReport(t); err == nil {
+			list = append(list, r)
+		}
+	}
+	return list, nil
+}
+
+// BsqSwapTotals are the sums over a list of swap reports.
+type BsqSwapTotals struct {
+	Swaps      int    `json:"swaps"`      // number of swaps
+	BtcBought  uint64 `json:"btcBought"`  // BTC received (sats)
+	BtcSold    uint64 `json:"btcSold"`    // BTC paid (sats)
+	BsqBought  uint64 `json:"bsqBought"`  // BSQ received (units)
+	BsqSold    uint64 `json:"bsqSold"`    // BSQ paid (units)
+	BsqFees    uint64 `json:"bsqFees"`    // trade fees paid (BSQ units)
+	BtcPayouts uint64 `json:"btcPayouts"` // sum of our BTC payouts (sats)
+	BsqPayouts uint64 `json:"bsqPayouts"` // sum of our BSQ payouts (units)
+}
+
+// SumBsqSwaps computes the totals of swap reports (failed swaps are
+// skipped).
+func SumBsqSwaps(list []*BsqSwapReport) *BsqSwapTotals {
+	t := new(BsqSwapTotals)
+	for _, r := range list {
+		if len(r.Error) > 0 {
+			continue
+		}
+		t.Swaps++
+		if r.BuyBtc {
+			t.BtcBought += r.BtcAmount
+			t.BsqSold += r.BsqAmount
+		} else {
+			t.BtcSold += r.BtcAmount
+			t.BsqBought += r.BsqAmount
+		}
+		t.BsqFees += r.BsqFee
+		if r.BuyBtc {
+			t.BtcPayouts += r.Payout
+		} else {
+			t.BsqPayouts += r.Payout
+		}
+	}
+	return t
+}
@@ -0,0 +1,122 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBsqSwapOffer(t *testing.T) {
+	if v := BsqVolume(1000000, 5000); v != 20000 {
+		t.Fatalf("wrong BSQ volume %d", v)
+	}
+	for _, o := range []*BsqSwapOffer{
+		NewBsqSwapOffer("hold").Amount(0, 1000000).Price("0.00005"),
+		NewBsqSwapOffer("buy").Amount(0, 1000000).Price("0.000000001"),
+		NewBsqSwapOffer("buy").Amount(0, 1000000).Price("0"),
+		NewBsqSwapOffer("buy").Amount(0, 1000000),
+		NewBsqSwapOffer("buy").Amount(2000000, 1000000).Price("0.00005"),
+		NewBsqSwapOffer("sell").Price("0.00005"),
+	} {
+		if _, err := o.Request(); err == nil {
+			t.Fatalf("invalid offer accepted: %v", o.req)
+		}
+	}
+	o := NewBsqSwapOffer("buy").Amount(0, 1000000).Price("0.00005")
+	req, err := o.Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Direction != "BUY" || req.MinAmount != 1000000 || req.Price != "0.00005" {
+		t.Fatalf("wrong request: %v", req)
+	}
+	if btc, bsq, _ := o.Funds(); btc != 0 || bsq != 20000 {
+		t.Fatalf("wrong funds: %d sats, %d BSQ units", btc, bsq)
+	}
+	if btc, bsq, _ := NewBsqSwapOffer("sell").Amount(500000, 1000000).Price("0.00005").Funds(); btc != 1000000 || bsq != 0 {
+		t.Fatalf("wrong funds: %d sats, %d BSQ units", btc, bsq)
+	}
+	needDaemon(t)
+	// offer exceeding the wallet balance is not created
+	_, err = NewBsqSwapOffer("sell").Amount(0, 2100000000000000).Price("0.00005").Create(context.Background(), testClient)
+	if !errors.Is(err, ErrSwapFunds) {
+		t.Fatalf("unfunded offer created: %v", err)
+	}
+}
+
+func TestBsqSwapReport(t *testing.T) {
+	trade := &TradeInfo{
+		TradeId:    "t1",
+		Role:       "BTC buyer as taker",
+		TradePrice: "0.00005",
+		Offer:      &OfferInfo{Direction: "SELL"},
+		BsqSwapTradeInfo: &BsqSwapTradeInfo{
+			BtcTradeAmount:   1000000,
+			BsqTradeAmount:   20000,
+			BsqMakerTradeFee: 50,
+			BsqTakerTradeFee: 75,
+			Payout:           990000,
+			NumConfirmations: 2,
+		},
+	}
+	r, err := NewBsqSwapReport(trade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Maker || !r.BuyBtc || r.BsqFee != 75 || r.Payout != 990000 {
+		t.Fatalf("wrong report: %+v", r)
+	}
+	failed := &BsqSwapReport{BtcAmount: 5, Error: "failed"}
+	tot := SumBsqSwaps([]*BsqSwapReport{r, failed})
+	if tot.Swaps != 1 || tot.BtcBought != 1000000 || tot.BsqSold != 20000 || tot.BsqFees != 75 ||
+		tot.BtcPayouts != 990000 || tot.BsqPayouts != 0 {
+		t.Fatalf("wrong totals: %+v", tot)
+	}
+	if _, err = NewBsqSwapReport(&TradeInfo{}); !errors.Is(err, ErrSwapNoInfo) {
+		t.Fatal("non-swap trade accepted")
+	}
+}
+
+func TestFilterCurrency(t *testing.T) {
+	list := []*OfferInfo{
+		{Id: "1", BaseCurrencyCode: "BSQ", CounterCurrencyCode: "BTC"},
+		{Id: "2", BaseCurrencyCode: "BTC", CounterCurrencyCode: "EUR"},
+	}
+	if res := filterCurrency(list, "bsq"); len(res) != 1 || res[0].Id != "1" {
+		t.Fatalf("wrong result: %v", res)
+	}
+	if res := filterCurrency(list, ""); len(res) != 2 {
+		t.Fatalf("wrong result: %v", res)
+	}
+	if res := filterCurrency(list, "XMR"); len(res) != 0 {
+		t.Fatalf("wrong result: %v", res)
+	}
+	for _, curr := range []string{"", "bsq", "BTC"} {
+		if err := swapCurrency(curr); err != nil {
+			t.Fatalf("currency '%s': %v", curr, err)
+		}
+	}
+	if err := swapCurrency("EUR"); !errors.Is(err, ErrSwapCurrency) {
+		t.Fatal("invalid swap currency accepted")
+	}
+}
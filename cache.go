@@ -0,0 +1,301 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultCacheTTL lists the cached methods (full gRPC method names) and
+// their default time-to-live.
+var DefaultCacheTTL = map[string]time.Duration{
+	GetVersion_GetVersion_FullMethodName:                           time.Hour,
+	PaymentAccounts_GetPaymentMethods_FullMethodName:               time.Hour,
+	PaymentAccounts_GetCryptoCurrencyPaymentMethods_FullMethodName: time.Hour,
+	PaymentAccounts_GetPaymentAccountForm_FullMethodName:           time.Hour,
+	PaymentAccounts_GetPaymentAccounts_FullMethodName:              10 * time.Minute,
+	Wallets_GetTxFeeRate_FullMethodName:                            time.Minute,
+	Price_GetMarketPrice_FullMethodName:                            30 * time.Second,
+}
+
+// cacheInvalidations lists the cached methods that are invalidated by a
+// (successful) mutating call.
+var cacheInvalidations = map[string][]string{
+	PaymentAccounts_CreatePaymentAccount_FullMethodName: {
+		PaymentAccounts_GetPaymentAccounts_FullMethodName,
+	},
+	PaymentAccounts_CreateCryptoCurrencyPaymentAccount_FullMethodName: {
+		PaymentAccounts_GetPaymentAccounts_FullMethodName,
+	},
+	Wallets_SetTxFeeRatePreference_FullMethodName: {
+		Wallets_GetTxFeeRate_FullMethodName,
+	},
+	Wallets_UnsetTxFeeRatePreference_FullMethodName: {
+		Wallets_GetTxFeeRate_FullMethodName,
+	},
+}
+
+// CacheStats are the statistics of a cached method.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`   // replies served from cache
+	Misses uint64 `json:"misses"` // calls to the daemon
+	Shared uint64 `json:"shared"` // replies shared with a concurrent call
+}
+
+// cacheSweep is the min. time between removals of stale entries
+const cacheSweep = time.Minute
+
+// cacheEntry is a cached reply
+type cacheEntry struct {
+	reply   proto.Message    // cached reply
+	expires time.Time        // expiration time
+	conn    *grpc.ClientConn // connection of reply
+}
+
+// cacheCall is an active call to the daemon
+type cacheCall struct {
+	done  chan struct{} // closed when call finished
+	reply proto.Message // reply of call
+	err   error         // error of call
+	gen   uint64        // cache generation at start of call
+	ended bool          // context of caller was done
+}
+
+// Cache is a read-through cache for replies of slow-changing daemon data.
+// Concurrent identical requests are coalesced into a single call to the
+// daemon. Replies of mutating calls that change cached data invalidate the
+// affected entries. Replies are cached per connection, so a cache can be
+// shared by the clients of several daemons.
+type Cache struct {
+	ttl     map[string]time.Duration // time-to-live per method
+	entries map[string]*cacheEntry   // cached replies per request
+	calls   map[string]*cacheCall    // active calls per request
+	stats   map[string]*CacheStats   // statistics per method
+	gen     uint64                   // generation (incremented on invalidation)
+	swept   time.Time                // time of last removal of stale entries
+	mtx     sync.Mutex               // serialize access
+}
+
+// NewCache creates a cache with default TTLs.
+func NewCache() *Cache {
+	c := &Cache{
+		ttl:     make(map[string]time.Duration),
+		entries: make(map[string]*cacheEntry),
+		calls:   make(map[string]*cacheCall),
+		stats:   make(map[string]*CacheStats),
+	}
+	for method, ttl := range DefaultCacheTTL {
+		c.ttl[method] = ttl
+	}
+	return c
+}
+
+// WithCache serves slow-changing daemon data from a cache.
+func WithCache(cache *Cache) Option {
+	return WithInterceptor(cache.Interceptor())
+}
+
+// SetTTL sets the time-to-live for replies of a method (full gRPC method
+// name like Price_GetMarketPrice_FullMethodName). A TTL of zero disables
+// caching for the method. Cached replies of the method are invalidated.
+func (c *Cache) SetTTL(method string, ttl time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.invalidate(method)
+	if ttl <= 0 {
+		delete(c.ttl, method)
+		return
+	}
+	c.ttl[method] = ttl
+}
+
+// Invalidate all cached replies of the given methods.
+func (c *Cache) Invalidate(methods ...string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, method := range methods {
+		c.invalidate(method)
+	}
+}
+
+// invalidate cached replies of a method (locked)
+func (c *Cache) invalidate(method string) {
+	c.invalidatePrefix(method + "\x00")
+}
+
+// invalidatePrefix removes cached replies with keys starting with prefix
+// (locked)
+func (c *Cache) invalidatePrefix(prefix string) {
+	c.gen++
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// sweep removes expired entries and entries of closed connections (locked)
+func (c *Cache) sweep(now time.Time) {
+	c.swept = now
+	for key, e := range c.entries {
+		if !now.Before(e.expires) || (e.conn != nil && e.conn.GetState() == connectivity.Shutdown) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// connID identifies a connection in cache keys. The address alone is not
+// unique (e.g. the same local address through different tunnels).
+func connID(cc *grpc.ClientConn) string {
+	if cc == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s@%p", cc.Target(), cc)
+}
+
+// Purge all cached replies.
+func (c *Cache) Purge() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.entries = make(map[string]*cacheEntry)
+	c.gen++
+}
+
+// Stats returns the statistics per method.
+func (c *Cache) Stats() map[string]CacheStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	stats := make(map[string]CacheStats)
+	for method, s := range c.stats {
+		stats[method] = *s
+	}
+	return stats
+}
+
+// count a cache event for a method (locked)
+func (c *Cache) count(method string, fcn func(s *CacheStats)) {
+	s, ok := c.stats[method]
+	if !ok {
+		s = new(CacheStats)
+		c.stats[method] = s
+	}
+	fcn(s)
+}
+
+// Interceptor returns a gRPC client interceptor serving cached replies.
+func (c *Cache) Interceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		reqMsg, ok1 := req.(proto.Message)
+		replyMsg, ok2 := reply.(proto.Message)
+		c.mtx.Lock()
+		ttl, cached := c.ttl[method]
+		c.mtx.Unlock()
+		if !cached || !ok1 || !ok2 {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if affected, ok := cacheInvalidations[method]; ok && err == nil {
+				c.mtx.Lock()
+				for _, m := range affected {
+					c.invalidatePrefix(m + "\x00" + connID(cc) + "\x00")
+				}
+				c.mtx.Unlock()
+			}
+			return err
+		}
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(reqMsg)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		key := method + "\x00" + connID(cc) + "\x00" + string(data)
+
+		for {
+			c.mtx.Lock()
+			// serve from cache
+			if e, ok := c.entries[key]; ok {
+				if time.Now().Before(e.expires) {
+					c.count(method, func(s *CacheStats) { s.Hits++ })
+					c.mtx.Unlock()
+					proto.Merge(replyMsg, e.reply)
+					return nil
+				}
+				delete(c.entries, key)
+			}
+			// share reply of an active call
+			if call, ok := c.calls[key]; ok {
+				c.count(method, func(s *CacheStats) { s.Shared++ })
+				c.mtx.Unlock()
+				select {
+				case <-call.done:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				if call.err != nil {
+					// the call was ended by its caller: try again
+					if call.ended && ctx.Err() == nil {
+						continue
+					}
+					return call.err
+				}
+				proto.Merge(replyMsg, call.reply)
+				return nil
+			}
+			call := &cacheCall{
+				done: make(chan struct{}),
+				gen:  c.gen,
+			}
+			c.calls[key] = call
+			c.count(method, func(s *CacheStats) { s.Misses++ })
+			c.mtx.Unlock()
+
+			// call daemon
+			call.err = invoker(ctx, method, req, reply, cc, opts...)
+			if call.err == nil {
+				call.reply = proto.Clone(replyMsg)
+			}
+			call.ended = ctx.Err() != nil
+			c.mtx.Lock()
+			delete(c.calls, key)
+			// don't cache replies that might be outdated by an invalidation
+			now := time.Now()
+			if call.err == nil && call.gen == c.gen {
+				c.entries[key] = &cacheEntry{
+					reply:   call.reply,
+					expires: now.Add(ttl),
+					conn:    cc,
+				}
+			}
+			if now.Sub(c.swept) >= cacheSweep {
+				c.sweep(now)
+			}
+			c.mtx.Unlock()
+			close(call.done)
+			return call.err
+		}
+	}
+}
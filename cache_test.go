@@ -0,0 +1,262 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestCacheInterceptor(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+	icpt := cache.Interceptor()
+	var (
+		calls   = make(map[string]int)
+		mtx     sync.Mutex
+		release = make(chan struct{})
+	)
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		mtx.Lock()
+		calls[method]++
+		mtx.Unlock()
+		switch r := reply.(type) {
+		case *MarketPriceReply:
+			<-release
+			r.Price = 30000
+		case *GetPaymentAccountsReply:
+			r.PaymentAccounts = []*PaymentAccount{{Id: "acc1"}}
+		}
+		return nil
+	}
+	price := func() float64 {
+		reply := new(MarketPriceReply)
+		if err := icpt(ctx, Price_GetMarketPrice_FullMethodName, &MarketPriceRequest{CurrencyCode: "EUR"}, reply, nil, invoker); err != nil {
+			t.Error(err)
+		}
+		return reply.Price
+	}
+
+	// concurrent requests are coalesced
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p := price(); p != 30000 {
+				t.Errorf("wrong price %f", p)
+			}
+		}()
+	}
+	for {
+		if cache.Stats()[Price_GetMarketPrice_FullMethodName].Shared == 4 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if p := price(); p != 30000 {
+		t.Fatalf("wrong price %f", p)
+	}
+	stats := cache.Stats()[Price_GetMarketPrice_FullMethodName]
+	if calls[Price_GetMarketPrice_FullMethodName] != 1 || stats.Misses != 1 || stats.Hits != 1 {
+		t.Fatalf("wrong stats: %+v (%d calls)", stats, calls[Price_GetMarketPrice_FullMethodName])
+	}
+	// other request parameters are cached separately
+	icpt(ctx, Price_GetMarketPrice_FullMethodName, &MarketPriceRequest{CurrencyCode: "USD"}, new(MarketPriceReply), nil, invoker)
+	if calls[Price_GetMarketPrice_FullMethodName] != 2 {
+		t.Fatal("different request served from cache")
+	}
+
+	// invalidation by mutating call
+	accounts := func() {
+		reply := new(GetPaymentAccountsReply)
+		if err := icpt(ctx, PaymentAccounts_GetPaymentAccounts_FullMethodName, &GetPaymentAccountsRequest{}, reply, nil, invoker); err != nil {
+			t.Fatal(err)
+		}
+		if len(reply.PaymentAccounts) != 1 {
+			t.Fatalf("wrong reply: %v", reply)
+		}
+	}
+	accounts()
+	accounts()
+	icpt(ctx, PaymentAccounts_CreatePaymentAccount_FullMethodName, &CreatePaymentAccountRequest{}, new(CreatePaymentAccountReply), nil, invoker)
+	accounts()
+	if calls[PaymentAccounts_GetPaymentAccounts_FullMethodName] != 2 {
+		t.Fatalf("wrong number of calls: %d", calls[PaymentAccounts_GetPaymentAccounts_FullMethodName])
+	}
+
+	// expiration and uncached methods
+	cache.SetTTL(PaymentAccounts_GetPaymentAccounts_FullMethodName, time.Millisecond)
+	accounts()
+	time.Sleep(2 * time.Millisecond)
+	accounts()
+	cache.SetTTL(PaymentAccounts_GetPaymentAccounts_FullMethodName, 0)
+	accounts()
+	accounts()
+	if calls[PaymentAccounts_GetPaymentAccounts_FullMethodName] != 6 {
+		t.Fatalf("wrong number of calls: %d", calls[PaymentAccounts_GetPaymentAccounts_FullMethodName])
+	}
+}
+
+func TestWithCache(t *testing.T) {
+	needDaemon(t)
+	ctx := context.Background()
+	cache := NewCache()
+	c := NewClient(testClient.rpcHost, "", 10*time.Second,
+		WithCredentials(EnvCredential("BISQ_API_PASSWORD")), WithCache(cache))
+	if err := c.Connect(ctx, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetVersion(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := cache.Stats()[GetVersion_GetVersion_FullMethodName]
+	if stats.Misses != 1 || stats.Hits != 2 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+	cache.Invalidate(GetVersion_GetVersion_FullMethodName)
+	if _, err := c.GetVersion(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats = cache.Stats()[GetVersion_GetVersion_FullMethodName]; stats.Misses != 2 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestCacheConnections(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+	icpt := cache.Interceptor()
+	// connections are never used by the invoker
+	conn := func(target string) *grpc.ClientConn {
+		cc, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { cc.Close() })
+		return cc
+	}
+	ccA, ccB, ccC := conn("node-a:9998"), conn("node-b:9998"), conn("node-a:9998")
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		reply.(*GetVersionReply).Version = fmt.Sprintf("%s/%p", cc.Target(), cc)
+		return nil
+	}
+	version := func(cc *grpc.ClientConn) string {
+		reply := new(GetVersionReply)
+		if err := icpt(ctx, GetVersion_GetVersion_FullMethodName, &GetVersionRequest{}, reply, cc, invoker); err != nil {
+			t.Fatal(err)
+		}
+		return reply.Version
+	}
+	// replies of one daemon are never served to another
+	for _, cc := range []*grpc.ClientConn{ccA, ccB, ccC, ccA, ccB, ccC} {
+		if v := version(cc); v != fmt.Sprintf("%s/%p", cc.Target(), cc) {
+			t.Fatalf("reply of other connection: %s", v)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("wrong number of calls: %d", calls)
+	}
+	// entries of closed connections and expired entries are removed
+	ccB.Close()
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	cache.sweep(time.Now())
+	if n := len(cache.entries); n != 2 {
+		t.Fatalf("%d entries after closing connection", n)
+	}
+	cache.sweep(time.Now().Add(2 * time.Hour))
+	if n := len(cache.entries); n != 0 {
+		t.Fatalf("%d entries after expiration", n)
+	}
+}
+
+func TestCacheSharedCancel(t *testing.T) {
+	cache := NewCache()
+	icpt := cache.Interceptor()
+	var (
+		calls   int
+		mtx     sync.Mutex
+		started = make(chan struct{}, 2)
+	)
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		mtx.Lock()
+		calls++
+		n := calls
+		mtx.Unlock()
+		started <- struct{}{}
+		if n == 1 {
+			// first call is cancelled by its caller
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		reply.(*MarketPriceReply).Price = 30000
+		return nil
+	}
+	price := func(ctx context.Context) (float64, error) {
+		reply := new(MarketPriceReply)
+		err := icpt(ctx, Price_GetMarketPrice_FullMethodName, &MarketPriceRequest{CurrencyCode: "EUR"}, reply, nil, invoker)
+		return reply.Price, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := price(ctx)
+		leader <- err
+	}()
+	<-started
+	waiter := make(chan float64, 1)
+	go func() {
+		p, err := price(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		waiter <- p
+	}()
+	for cache.Stats()[Price_GetMarketPrice_FullMethodName].Shared != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected leader error: %v", err)
+	}
+	// waiter with live context retries the call
+	if p := <-waiter; p != 30000 {
+		t.Fatalf("wrong price %f", p)
+	}
+	if calls != 2 {
+		t.Fatalf("wrong number of calls: %d", calls)
+	}
+}
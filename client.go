@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
@@ -37,10 +38,15 @@ var (
 
 // Client for Bisq API calls
 type Client struct {
-	conn    *grpc.ClientConn   // active connection (close on exit)
-	rpcHost string             // host:port spec for Bisq gRPC daemon
-	creds   PasswordCredential // credential used in RPC call
-	timeout time.Duration      // RPC timeout deadline in seconds
+	conn    *grpc.ClientConn              // active connection (close on exit)
+	rpcHost string                        // host:port spec for Bisq gRPC daemon
+	creds   credentials.PerRPCCredentials // credential used in RPC call
+	timeout time.Duration                 // RPC timeout deadline in seconds
+	policy  *Policy                       // spending policy for wallet operations
+	dialer  Dialer                        // custom dialer (optional)
+
+	// interceptors for RPC calls
+	interceptors []grpc.UnaryClientInterceptor
 
 	// list of supported clients
 	dac DisputeAgentsClient
@@ -52,15 +58,35 @@ type Client struct {
 	wc  WalletsClient
 }
 
+// Option for a Bisq client
+type Option func(*Client)
+
+// WithPolicy guards wallet operations with a spending policy
+func WithPolicy(p *Policy) Option {
+	return func(c *Client) {
+		c.policy = p
+	}
+}
+
+// WithInterceptor adds an interceptor for (unary) RPC calls
+func WithInterceptor(i grpc.UnaryClientInterceptor) Option {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, i)
+	}
+}
+
 // NewClient instaniates a new Bisq client
-func NewClient(host, passwd string, timeout time.Duration) *Client {
-	return &Client{
+func NewClient(host, passwd string, timeout time.Duration, opts ...Option) *Client {
+	c := &Client{
 		conn:    nil,
 		rpcHost: host,
-		creds:   PasswordCredential(passwd),
+		creds:   &providerCredential{NewStaticCredential([]byte(passwd))},
 		timeout: timeout,
 	}
-
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // SetTimeout for RPC requests
@@ -81,10 +107,16 @@ func (c *Client) Connect(ctx context.Context, timeout time.Duration) (err error)
 	// dial gRPC server with given credentials
 	xctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	c.conn, err = grpc.DialContext(xctx, c.rpcHost,
+	opts := []grpc.DialOption{
 		grpc.WithPerRPCCredentials(c.creds),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock())
+		grpc.WithChainUnaryInterceptor(c.interceptors...),
+		grpc.WithBlock(),
+	}
+	if c.dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(c.dialer))
+	}
+	c.conn, err = grpc.DialContext(xctx, c.rpcHost, opts...)
 	if err == nil {
 		// instantiate all supported sub-clients
 		c.dac = NewDisputeAgentsClient(c.conn)
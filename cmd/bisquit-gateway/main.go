@@ -0,0 +1,151 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"github.com/bfix/bisquit/gateway"
+)
+
+// readTokens reads access tokens (one per line) from a file
+func readTokens(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var tokens []string
+	rdr := bufio.NewScanner(f)
+	for rdr.Scan() {
+		line := strings.TrimSpace(rdr.Text())
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	return tokens, rdr.Err()
+}
+
+func main() {
+	var (
+		listen    string
+		host      string
+		timeout   int
+		tokenFile string
+		certFile  string
+		keyFile   string
+		poll      int
+	)
+	flag.StringVar(&listen, "listen", "127.0.0.1:8080", "listen address of the gateway")
+	flag.StringVar(&host, "host", "localhost:9998", "host:port of Bisq gRPC daemon")
+	flag.IntVar(&timeout, "timeout", 30, "RPC timeout in seconds")
+	flag.StringVar(&tokenFile, "tokens", "", "file with access tokens (one per line)")
+	flag.StringVar(&certFile, "cert", "", "TLS certificate file")
+	flag.StringVar(&keyFile, "key", "", "TLS key file")
+	flag.IntVar(&poll, "poll", 10, "polling interval of event feed in seconds (0 = no feed)")
+	flag.Parse()
+
+	// get daemon address (an explicit -host flag takes precedence over
+	// the environment), password and access tokens
+	hostSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "host" {
+			hostSet = true
+		}
+	})
+	if h := os.Getenv("BISQ_API_HOST"); len(h) > 0 && !hostSet {
+		host = h
+	}
+	passwd := os.Getenv("BISQ_API_PASSWORD")
+	if len(passwd) == 0 {
+		log.Fatal("no API password defined (use BISQ_API_PASSWORD)")
+	}
+	var tokens []string
+	if len(tokenFile) > 0 {
+		var err error
+		if tokens, err = readTokens(tokenFile); err != nil {
+			log.Fatalf("tokens: %s", err.Error())
+		}
+	}
+	if t := os.Getenv("BISQUIT_GATEWAY_TOKEN"); len(t) > 0 {
+		tokens = append(tokens, t)
+	}
+	if len(tokens) == 0 {
+		log.Fatal("no access tokens defined (use -tokens or BISQUIT_GATEWAY_TOKEN)")
+	}
+
+	// connect to daemon
+	ctx := context.Background()
+	to := time.Duration(timeout) * time.Second
+	client := bisquit.NewClient(host, passwd, to)
+	if err := client.Connect(ctx, to); err != nil {
+		log.Fatalf("connect: %s", err.Error())
+	}
+	defer client.Close()
+
+	// run gateway
+	gw := gateway.New(client, tokens)
+	if poll > 0 {
+		feed := gateway.NewFeed(client, time.Duration(poll)*time.Second)
+		fctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go feed.Run(fctx)
+		gw.SetFeed(feed)
+	}
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           gw,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		var err error
+		if len(certFile) > 0 {
+			err = srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("gateway: %s", err.Error())
+		}
+	}()
+	log.Printf("gateway listening on %s", listen)
+
+	// wait for termination
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	fmt.Println()
+	log.Println("shutting down...")
+	sctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	srv.Shutdown(sctx)
+}
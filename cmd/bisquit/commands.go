@@ -0,0 +1,980 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"golang.org/x/term"
+)
+
+// handler executes a command and returns a printable result
+type handler func(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error)
+
+// command definition
+type command struct {
+	help string  // short description with arguments
+	run  handler // command handler
+}
+
+// list of commands (mirroring the client methods)
+var commands = map[string]*command{
+	// general
+	"getversion": {"get version of Bisq daemon", getVersion},
+
+	// offers
+	"getoffercategory":   {"<offer-id>: get category of offer", getOfferCategory},
+	"getoffer":           {"<offer-id>: get offer", getOffer},
+	"getmyoffer":         {"<offer-id>: get own offer", getMyOffer},
+	"getoffers":          {"<direction> <currency>: list offers", getOffers},
+	"getmyoffers":        {"<direction> <currency>: list own offers", getMyOffers},
+	"createoffer":        {"[flags]: create a new offer", createOffer},
+	"editoffer":          {"[flags]: edit an open offer", editOffer},
+	"canceloffer":        {"<offer-id>: cancel an open offer", cancelOffer},
+	"getbsqswapoffer":    {"<offer-id>: get BSQ swap offer", getBsqSwapOffer},
+	"getmybsqswapoffer":  {"<offer-id>: get own BSQ swap offer", getMyBsqSwapOffer},
+	"getbsqswapoffers":   {"<direction>: list BSQ swap offers", getBsqSwapOffers},
+	"getmybsqswapoffers": {"<direction>: list own BSQ swap offers", getMyBsqSwapOffers},
+	"createbsqswapoffer": {"[flags]: create a new BSQ swap offer", createBsqSwapOffer},
+	"takebsqswapoffer":   {"[flags]: take a BSQ swap offer", takeBsqSwapOffer},
+	"getbsqswaps":        {"list completed BSQ swaps", getBsqSwaps},
+
+	// trades
+	"getmarketprice":         {"<currency>: get market price of BTC", getMarketPrice},
+	"gettrade":               {"<trade-id>: get trade", getTrade},
+	"gettrades":              {"[open|closed|failed]: list trades", getTrades},
+	"getdeadlines":           {"[<trade-id>]: list trade period deadlines of open trades", getDeadlines},
+	"exportdeadlines":        {"<file>: export trade deadlines as iCalendar", exportDeadlines},
+	"takeoffer":              {"[flags]: take an offer", takeOffer},
+	"confirmpaymentstarted":  {"<trade-id>: confirm payment started", tradeOp("payment started confirmed", (*bisquit.Client).ConfirmPaymentStarted)},
+	"confirmpaymentreceived": {"<trade-id>: confirm payment received", tradeOp("payment received confirmed", (*bisquit.Client).ConfirmPaymentReceived)},
+	"failtrade":              {"<trade-id>: fail a trade", tradeOp("trade failed", (*bisquit.Client).FailTrade)},
+	"unfailtrade":            {"<trade-id>: revive a failed trade", tradeOp("trade revived", (*bisquit.Client).UnFailTrade)},
+	"closetrade":             {"<trade-id>: close a trade", tradeOp("trade closed", (*bisquit.Client).CloseTrade)},
+	"withdrawfunds":          {"<trade-id> <address|@label> [<memo>]: withdraw trade funds", withdrawFunds},
+
+	// wallet
+	"getbalances":            {"[BTC|BSQ]: get wallet balances", getBalances},
+	"getaddressbalance":      {"<address>: get balance of address", getAddressBalance},
+	"getunusedbsqaddress":    {"get unused BSQ address", getUnusedBsqAddress},
+	"sendbsq":                {"<address|@label> <amount> [<fee-rate>]: send BSQ", sendBsq},
+	"sendbtc":                {"<address|@label> <amount> [<fee-rate> [<memo>]]: send BTC", sendBtc},
+	"verifybsqsenttoaddress": {"<address> <amount>: verify BSQ was received", verifyBsqSentToAddress},
+	"gettxfeerate":           {"get transaction fee rate", getTxFeeRate},
+	"settxfeerate":           {"<sats/vbyte>: set preferred fee rate", setTxFeeRate},
+	"unsettxfeerate":         {"unset preferred fee rate", unsetTxFeeRate},
+	"managetxfeerate":        {"[flags]: set or unset preferred fee rate by policy", manageTxFeeRate},
+	"gettransaction":         {"<tx-id>: get transaction", getTransaction},
+	"gettransactions":        {"list wallet transactions", getTransactions},
+	"getfundingaddresses":    {"list funding addresses", getFundingAddresses},
+	"setwalletpassword":      {"[flags]: set or change wallet password", setWalletPassword},
+	"removewalletpassword":   {"[flags]: remove wallet password", removeWalletPassword},
+	"lockwallet":             {"lock wallet", lockWallet},
+	"unlockwallet":           {"[flags] <timeout>: unlock wallet for timeout seconds", unlockWallet},
+
+	// address book
+	"getaddressbook":    {"[<purpose>]: list funding addresses with labels", getAddressBook},
+	"freshaddress":      {"<purpose> [<label>]: get unused BTC address for purpose", freshAddress},
+	"freshbsqaddress":   {"<purpose> [<label>]: get unused BSQ address for purpose", freshBsqAddress},
+	"labeladdress":      {"<address> <purpose> [<label>]: label a wallet address", labelAddress},
+	"getdestinations":   {"list external destinations", getDestinations},
+	"adddestination":    {"<address> <label> [BTC|BSQ]: add external destination", addDestination},
+	"removedestination": {"<address|label>: remove external destination", removeDestination},
+
+	// payment accounts
+	"createpaymentaccount": {"<form-file>: create payment account from form", createPaymentAccount},
+	"getpaymentaccounts":   {"list payment accounts", getPaymentAccounts},
+	"getpaymentmethods":    {"list payment methods", getPaymentMethods},
+	"getpaymentacctform":   {"<method-id>: get payment account form", getPaymentAccountForm},
+}
+
+//----------------------------------------------------------------------
+// Helper functions
+//----------------------------------------------------------------------
+
+// checkArgs returns an error if not enough arguments are given
+func checkArgs(args []string, n int, usage string) error {
+	if len(args) < n {
+		return fmt.Errorf("missing arguments: %s", usage)
+	}
+	return nil
+}
+
+// optArg returns the optional argument at index (or an empty string)
+func optArg(args []string, i int) string {
+	if len(args) > i {
+		return args[i]
+	}
+	return ""
+}
+
+// parseBTC converts a BTC amount string ("0.01") into satoshis
+func parseBTC(s string) (int64, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	v, err := bisquit.ParseUnits(s, 8)
+	return int64(v), err
+}
+
+// newFlags creates a flag set for a command
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// stdin is shared by all password prompts (several passwords can be piped)
+var stdin = bufio.NewReader(os.Stdin)
+
+// secretFlags select the source of a password: environment variable, file
+// or prompt (default). Passwords are never passed as arguments.
+type secretFlags struct {
+	env  string // name of environment variable
+	file string // path to file
+}
+
+// register the flags with given prefix (like "new-") in a flag set
+func (f *secretFlags) register(fs *flag.FlagSet, prefix, what string) {
+	fs.StringVar(&f.env, prefix+"password-env", "", "read "+what+" from environment variable")
+	fs.StringVar(&f.file, prefix+"password-file", "", "read "+what+" from file")
+}
+
+// source returns the selected secret source
+func (f *secretFlags) source(prompt string) bisquit.SecretSource {
+	switch {
+	case len(f.env) > 0:
+		return bisquit.EnvSecret(f.env)
+	case len(f.file) > 0:
+		return bisquit.FileSecret(f.file)
+	}
+	return promptSecret(prompt)
+}
+
+// promptSecret reads a secret from the terminal (without echo) or a line
+// from standard input.
+func promptSecret(prompt string) bisquit.SecretSource {
+	return bisquit.SecretFunc(func(ctx context.Context) ([]byte, error) {
+		fd := int(os.Stdin.Fd())
+		if term.IsTerminal(fd) {
+			fmt.Fprint(os.Stderr, prompt+": ")
+			defer fmt.Fprintln(os.Stderr)
+			return term.ReadPassword(fd)
+		}
+		line, err := stdin.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, err
+		}
+		secret := bytes.TrimRight(line, "\r\n")
+		if len(secret) == 0 {
+			return nil, bisquit.ErrSecretEmpty
+		}
+		return secret, nil
+	})
+}
+
+// readSecret reads a password from a source as string.
+func readSecret(ctx context.Context, src bisquit.SecretSource) (string, error) {
+	secret, err := src.Secret(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer bisquit.Wipe(secret)
+	return string(secret), nil
+}
+
+// tradeOp wraps client methods taking a trade identifier
+func tradeOp(msg string, op func(*bisquit.Client, context.Context, string) error) handler {
+	return func(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+		if err := checkArgs(args, 1, "<trade-id>"); err != nil {
+			return nil, err
+		}
+		if err := op(c, ctx, args[0]); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+}
+
+//----------------------------------------------------------------------
+// General commands
+//----------------------------------------------------------------------
+
+func getVersion(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.GetVersion(ctx)
+}
+
+//----------------------------------------------------------------------
+// Offer commands
+//----------------------------------------------------------------------
+
+func getOfferCategory(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<offer-id>"); err != nil {
+		return nil, err
+	}
+	cat, err := c.GetOfferCategory(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return cat.String(), nil
+}
+
+func getOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<offer-id>"); err != nil {
+		return nil, err
+	}
+	return c.GetOffer(ctx, args[0])
+}
+
+func getMyOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<offer-id>"); err != nil {
+		return nil, err
+	}
+	return c.GetMyOffer(ctx, args[0])
+}
+
+func getOffers(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 2, "<direction> <currency>"); err != nil {
+		return nil, err
+	}
+	return c.GetOffers(ctx, strings.ToUpper(args[0]), strings.ToUpper(args[1]))
+}
+
+func getMyOffers(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 2, "<direction> <currency>"); err != nil {
+		return nil, err
+	}
+	return c.GetMyOffers(ctx, strings.ToUpper(args[0]), strings.ToUpper(args[1]))
+}
+
+func createOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	var (
+		dir, curr, price, trigger, accnt, fee string
+		amount, minAmount                     string
+		margin, deposit                       float64
+		estimate                              bool
+	)
+	fs := newFlags("createoffer")
+	fs.StringVar(&dir, "direction", "", "offer direction (BUY or SELL)")
+	fs.StringVar(&curr, "currency", "", "fiat or altcoin currency code")
+	fs.StringVar(&amount, "amount", "", "amount of BTC")
+	fs.StringVar(&minAmount, "min-amount", "", "minimum amount of BTC (default: amount)")
+	fs.StringVar(&price, "price", "", "fixed price")
+	fs.Float64Var(&margin, "margin", 0, "market price margin in percent (instead of fixed price)")
+	fs.Float64Var(&deposit, "deposit", 15, "buyer security deposit in percent")
+	fs.StringVar(&trigger, "trigger", "", "trigger price (market price based offers only)")
+	fs.StringVar(&accnt, "account", "", "payment account identifier")
+	fs.StringVar(&fee, "fee-currency", "BTC", "maker fee currency (BTC or BSQ)")
+	fs.BoolVar(&estimate, "estimate", false, "only check offer and estimate required funds")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	amnt, err := parseBTC(amount)
+	if err != nil {
+		return nil, err
+	}
+	minAmnt, err := parseBTC(minAmount)
+	if err != nil {
+		return nil, err
+	}
+	spec := bisquit.NewOfferSpec(dir, curr).
+		Amount(uint64(minAmnt), uint64(amnt)).
+		SecurityDeposit(deposit).
+		TriggerPrice(trigger).
+		PaymentAccount(accnt).
+		MakerFeeCurrency(fee)
+	if len(price) > 0 {
+		spec.FixedPrice(price)
+	} else {
+		spec.MarketPrice(margin)
+	}
+	if estimate {
+		if _, err = spec.Request(ctx, c); err != nil {
+			return nil, err
+		}
+		return spec.Funds(ctx, c)
+	}
+	return spec.Create(ctx, c)
+}
+
+func editOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	var (
+		id, price, trigger string
+		margin             float64
+		enable             bool
+	)
+	fs := newFlags("editoffer")
+	fs.StringVar(&id, "id", "", "offer identifier")
+	fs.StringVar(&price, "price", "", "new fixed price")
+	fs.Float64Var(&margin, "margin", 0, "new market price margin in percent")
+	fs.StringVar(&trigger, "trigger", "", "new trigger price")
+	fs.BoolVar(&enable, "enable", true, "enable (or disable) the offer")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	// derive edit type from given flags
+	var et bisquit.EditOfferRequest_EditType
+	switch {
+	case set["price"] && (set["margin"] || set["trigger"]):
+		return nil, fmt.Errorf("fixed price can't be combined with margin or trigger price")
+	case set["price"] && set["enable"]:
+		et = bisquit.EditOfferRequest_FIXED_PRICE_AND_ACTIVATION_STATE
+	case set["price"]:
+		et = bisquit.EditOfferRequest_FIXED_PRICE_ONLY
+	case set["margin"] && set["trigger"] && set["enable"]:
+		et = bisquit.EditOfferRequest_MKT_PRICE_MARGIN_AND_TRIGGER_PRICE_AND_ACTIVATION_STATE
+	case set["margin"] && set["trigger"]:
+		et = bisquit.EditOfferRequest_MKT_PRICE_MARGIN_AND_TRIGGER_PRICE
+	case set["margin"] && set["enable"]:
+		et = bisquit.EditOfferRequest_MKT_PRICE_MARGIN_AND_ACTIVATION_STATE
+	case set["margin"]:
+		et = bisquit.EditOfferRequest_MKT_PRICE_MARGIN_ONLY
+	case set["trigger"] && set["enable"]:
+		et = bisquit.EditOfferRequest_TRIGGER_PRICE_AND_ACTIVATION_STATE
+	case set["trigger"]:
+		et = bisquit.EditOfferRequest_TRIGGER_PRICE_ONLY
+	case set["enable"]:
+		et = bisquit.EditOfferRequest_ACTIVATION_STATE_ONLY
+	default:
+		return nil, fmt.Errorf("nothing to edit")
+	}
+	state := int32(-1)
+	if set["enable"] {
+		state = 0
+		if enable {
+			state = 1
+		}
+	}
+	req := &bisquit.EditOfferRequest{
+		Id:                   id,
+		Price:                price,
+		UseMarketBasedPrice:  set["margin"],
+		MarketPriceMarginPct: margin,
+		TriggerPrice:         trigger,
+		Enable:               state,
+		EditType:             et,
+	}
+	if err := c.EditOffer(ctx, req); err != nil {
+		return nil, err
+	}
+	return "offer changed", nil
+}
+
+func cancelOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<offer-id>"); err != nil {
+		return nil, err
+	}
+	if err := c.CancelOffer(ctx, args[0]); err != nil {
+		return nil, err
+	}
+	return "offer cancelled", nil
+}
+
+func getBsqSwapOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<offer-id>"); err != nil {
+		return nil, err
+	}
+	return c.GetBsqSwapOffer(ctx, args[0])
+}
+
+func getMyBsqSwapOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<offer-id>"); err != nil {
+		return nil, err
+	}
+	return c.GetMyBsqSwapOffer(ctx, args[0])
+}
+
+func getBsqSwapOffers(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<direction>"); err != nil {
+		return nil, err
+	}
+	return c.GetBsqSwapOffers(ctx, strings.ToUpper(args[0]), "BSQ")
+}
+
+func getMyBsqSwapOffers(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<direction>"); err != nil {
+		return nil, err
+	}
+	return c.GetMyBsqSwapOffers(ctx, strings.ToUpper(args[0]), "BSQ")
+}
+
+func createBsqSwapOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	var dir, amount, minAmount, price string
+	fs := newFlags("createbsqswapoffer")
+	fs.StringVar(&dir, "direction", "", "offer direction (BUY or SELL)")
+	fs.StringVar(&amount, "amount", "", "amount of BTC")
+	fs.StringVar(&minAmount, "min-amount", "", "minimum amount of BTC (default: amount)")
+	fs.StringVar(&price, "price", "", "fixed price in BTC per BSQ")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	amnt, err := parseBTC(amount)
+	if err != nil {
+		return nil, err
+	}
+	minAmnt, err := parseBTC(minAmount)
+	if err != nil {
+		return nil, err
+	}
+	return bisquit.NewBsqSwapOffer(dir).Amount(uint64(minAmnt), uint64(amnt)).Price(price).Create(ctx, c)
+}
+
+func takeBsqSwapOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	var offer, amount string
+	fs := newFlags("takebsqswapoffer")
+	fs.StringVar(&offer, "offer", "", "offer identifier")
+	fs.StringVar(&amount, "amount", "", "amount of BTC (default: offer amount)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	amnt, err := parseBTC(amount)
+	if err != nil {
+		return nil, err
+	}
+	return c.TakeBsqSwapOffer(ctx, offer, uint64(amnt))
+}
+
+func getBsqSwaps(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.GetBsqSwapReports(ctx)
+}
+
+//----------------------------------------------------------------------
+// Trade commands
+//----------------------------------------------------------------------
+
+func getMarketPrice(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<currency>"); err != nil {
+		return nil, err
+	}
+	return c.GetMarketPrice(ctx, strings.ToUpper(args[0]))
+}
+
+func getTrade(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<trade-id>"); err != nil {
+		return nil, err
+	}
+	trade, err := c.GetTrade(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	list, err := tradeViews(ctx, c, []*bisquit.TradeInfo{trade})
+	if err != nil {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+func getTrades(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	cat := strings.ToUpper(optArg(args, 0))
+	if len(cat) == 0 {
+		cat = "OPEN"
+	}
+	mode, ok := bisquit.GetTradesRequest_Category_value[cat]
+	if !ok {
+		return nil, fmt.Errorf("unknown trade category '%s'", args[0])
+	}
+	trades, err := c.GetTrades(ctx, int(mode))
+	if err != nil {
+		return nil, err
+	}
+	return tradeViews(ctx, c, trades)
+}
+
+// tradeViews adds the deadlines of open trades to a list of trades.
+// Trades without deadlines are shown without them.
+func tradeViews(ctx context.Context, c *bisquit.Client, trades []*bisquit.TradeInfo) ([]*tradeView, error) {
+	s, err := bisquit.NewDeadlineService(c, "")
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.DeadlinesOf(ctx, trades)
+	if _, ok := err.(bisquit.TradeErrors); err != nil && !ok {
+		return nil, err
+	}
+	deadlines := make(map[string]*bisquit.TradeDeadline)
+	for _, d := range list {
+		deadlines[d.TradeID] = d
+	}
+	views := make([]*tradeView, len(trades))
+	for i, t := range trades {
+		views[i] = &tradeView{trade: t, deadline: deadlines[t.TradeId]}
+	}
+	return views, nil
+}
+
+// skipped reports trades without deadlines on stderr; other errors are
+// returned.
+func skipped(err error) error {
+	errs, ok := err.(bisquit.TradeErrors)
+	if !ok {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "skipped trades: %s\n", errs.Error())
+	return nil
+}
+
+func getDeadlines(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	s, err := bisquit.NewDeadlineService(c, "")
+	if err != nil {
+		return nil, err
+	}
+	if id := optArg(args, 0); len(id) > 0 {
+		d, err := s.Deadline(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return []*bisquit.TradeDeadline{d}, nil
+	}
+	list, err := s.Deadlines(ctx)
+	if err = skipped(err); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func exportDeadlines(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<file>"); err != nil {
+		return nil, err
+	}
+	s, err := bisquit.NewDeadlineService(c, "")
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.Deadlines(ctx)
+	if err = skipped(err); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(args[0])
+	if err != nil {
+		return nil, err
+	}
+	err = bisquit.WriteDeadlinesICal(f, list, bisquit.DefaultDeadlineLeads, time.Now())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("%d trade deadlines exported", len(list)), nil
+}
+
+func takeOffer(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	var offer, accnt, fee, amount string
+	fs := newFlags("takeoffer")
+	fs.StringVar(&offer, "offer", "", "offer identifier")
+	fs.StringVar(&accnt, "account", "", "payment account identifier")
+	fs.StringVar(&fee, "fee-currency", "BTC", "taker fee currency (BTC or BSQ)")
+	fs.StringVar(&amount, "amount", "", "amount of BTC (default: offer amount)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	amnt, err := parseBTC(amount)
+	if err != nil {
+		return nil, err
+	}
+	return c.TakeOffer(ctx, amnt, offer, accnt, strings.ToUpper(fee))
+}
+
+func withdrawFunds(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 2, "<trade-id> <address|@label> [<memo>]"); err != nil {
+		return nil, err
+	}
+	addr, err := destination(c, args[1], bisquit.AssetBTC)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.WithdrawFunds(ctx, args[0], addr, optArg(args, 2)); err != nil {
+		return nil, err
+	}
+	return "funds withdrawn", nil
+}
+
+//----------------------------------------------------------------------
+// Wallet commands
+//----------------------------------------------------------------------
+
+// destination resolves "@label" to the address of an external destination
+// in the address book; other arguments are addresses.
+func destination(c *bisquit.Client, arg, asset string) (string, error) {
+	if !strings.HasPrefix(arg, "@") {
+		return arg, nil
+	}
+	b, err := bisquit.NewAddressBook(c, addressBook)
+	if err != nil {
+		return "", err
+	}
+	e, err := b.DestinationFor(arg[1:], asset)
+	if err != nil {
+		return "", err
+	}
+	return e.Address, nil
+}
+
+func getBalances(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.GetBalances(ctx, strings.ToUpper(optArg(args, 0)))
+}
+
+func getAddressBalance(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<address>"); err != nil {
+		return nil, err
+	}
+	return c.GetAddressBalance(ctx, args[0])
+}
+
+func getUnusedBsqAddress(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.GetUnusedBsqAddress(ctx)
+}
+
+func sendBsq(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 2, "<address|@label> <amount> [<fee-rate>]"); err != nil {
+		return nil, err
+	}
+	addr, err := destination(c, args[0], bisquit.AssetBSQ)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendBsq(ctx, addr, args[1], optArg(args, 2))
+}
+
+func sendBtc(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 2, "<address|@label> <amount> [<fee-rate> [<memo>]]"); err != nil {
+		return nil, err
+	}
+	addr, err := destination(c, args[0], bisquit.AssetBTC)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendBtc(ctx, addr, args[1], optArg(args, 2), optArg(args, 3))
+}
+
+func verifyBsqSentToAddress(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 2, "<address> <amount>"); err != nil {
+		return nil, err
+	}
+	return c.VerifyBsqSentToAddress(ctx, args[0], args[1])
+}
+
+func getTxFeeRate(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.GetTxFeeRate(ctx)
+}
+
+func setTxFeeRate(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<sats/vbyte>"); err != nil {
+		return nil, err
+	}
+	rate, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return c.SetTxFeeRatePreference(ctx, rate)
+}
+
+func unsetTxFeeRate(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.UnsetTxFeeRatePreference(ctx)
+}
+
+func manageTxFeeRate(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	var policyFile, journal string
+	fs := newFlags("managetxfeerate")
+	fs.StringVar(&policyFile, "policy", "", "fee policy file (JSON; default policy if empty)")
+	fs.StringVar(&journal, "journal", "", "journal file for fee rate changes")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	policy := bisquit.DefaultFeePolicy()
+	if len(policyFile) > 0 {
+		data, err := os.ReadFile(policyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, policy); err != nil {
+			return nil, err
+		}
+	}
+	m, err := bisquit.NewFeeManager(c, policy, journal)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := m.Apply(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return "fee rate preference unchanged", nil
+	}
+	return ch, nil
+}
+
+func getTransaction(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<tx-id>"); err != nil {
+		return nil, err
+	}
+	return c.GetTransaction(ctx, args[0])
+}
+
+func getTransactions(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.GetTransactions(ctx)
+}
+
+func getFundingAddresses(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.GetFundingAddresses(ctx)
+}
+
+func setWalletPassword(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	var (
+		cur, next secretFlags
+		change    bool
+	)
+	fs := newFlags("setwalletpassword")
+	fs.BoolVar(&change, "change", false, "change an existing password (current password required)")
+	cur.register(fs, "", "current password")
+	next.register(fs, "new-", "new password")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	var passwd, newPasswd string
+	if change {
+		var err error
+		if passwd, err = readSecret(ctx, cur.source("Current wallet password")); err != nil {
+			return nil, err
+		}
+		if newPasswd, err = readSecret(ctx, next.source("New wallet password")); err != nil {
+			return nil, err
+		}
+	} else {
+		// without a current password the new one is passed as password
+		var err error
+		if passwd, err = readSecret(ctx, next.source("New wallet password")); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.SetWalletPassword(ctx, passwd, newPasswd); err != nil {
+		return nil, err
+	}
+	return "wallet password set", nil
+}
+
+func removeWalletPassword(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	var cur secretFlags
+	fs := newFlags("removewalletpassword")
+	cur.register(fs, "", "wallet password")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	passwd, err := readSecret(ctx, cur.source("Wallet password"))
+	if err != nil {
+		return nil, err
+	}
+	if err = c.RemoveWalletPassword(ctx, passwd); err != nil {
+		return nil, err
+	}
+	return "wallet password removed", nil
+}
+
+func lockWallet(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := c.LockWallet(ctx); err != nil {
+		return nil, err
+	}
+	return "wallet locked", nil
+}
+
+func unlockWallet(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	var cur secretFlags
+	fs := newFlags("unlockwallet")
+	cur.register(fs, "", "wallet password")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := checkArgs(fs.Args(), 1, "[flags] <timeout>"); err != nil {
+		return nil, err
+	}
+	timeout, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	passwd, err := readSecret(ctx, cur.source("Wallet password"))
+	if err != nil {
+		return nil, err
+	}
+	if err = c.UnlockWallet(ctx, passwd, timeout); err != nil {
+		return nil, err
+	}
+	return "wallet unlocked", nil
+}
+
+//----------------------------------------------------------------------
+// Address book commands
+//----------------------------------------------------------------------
+
+func getAddressBook(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	b, err := bisquit.NewAddressBook(c, addressBook)
+	if err != nil {
+		return nil, err
+	}
+	list, err := b.Funding(ctx)
+	if err != nil {
+		return nil, err
+	}
+	purpose := optArg(args, 0)
+	if len(purpose) == 0 {
+		return list, nil
+	}
+	var res []*bisquit.FundingAddress
+	for _, fa := range list {
+		if fa.Purpose == purpose {
+			res = append(res, fa)
+		}
+	}
+	return res, nil
+}
+
+func freshAddress(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<purpose> [<label>]"); err != nil {
+		return nil, err
+	}
+	b, err := bisquit.NewAddressBook(c, addressBook)
+	if err != nil {
+		return nil, err
+	}
+	return b.Fresh(ctx, args[0], optArg(args, 1))
+}
+
+func freshBsqAddress(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<purpose> [<label>]"); err != nil {
+		return nil, err
+	}
+	b, err := bisquit.NewAddressBook(c, addressBook)
+	if err != nil {
+		return nil, err
+	}
+	return b.FreshBsq(ctx, args[0], optArg(args, 1))
+}
+
+func labelAddress(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 2, "<address> <purpose> [<label>]"); err != nil {
+		return nil, err
+	}
+	b, err := bisquit.NewAddressBook(c, addressBook)
+	if err != nil {
+		return nil, err
+	}
+	// BSQ addresses are BTC addresses prefixed with 'B'
+	asset := bisquit.AssetBTC
+	if strings.HasPrefix(args[0], "B") {
+		asset = bisquit.AssetBSQ
+	}
+	if err = b.Label(args[0], asset, args[1], optArg(args, 2)); err != nil {
+		return nil, err
+	}
+	return "address labeled", nil
+}
+
+func getDestinations(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	b, err := bisquit.NewAddressBook(c, addressBook)
+	if err != nil {
+		return nil, err
+	}
+	return b.Destinations(), nil
+}
+
+func addDestination(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 2, "<address> <label> [BTC|BSQ]"); err != nil {
+		return nil, err
+	}
+	b, err := bisquit.NewAddressBook(c, addressBook)
+	if err != nil {
+		return nil, err
+	}
+	asset := optArg(args, 2)
+	if len(asset) == 0 {
+		asset = bisquit.AssetBTC
+	}
+	if err = b.AddDestination(args[0], asset, args[1]); err != nil {
+		return nil, err
+	}
+	return "destination added", nil
+}
+
+func removeDestination(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<address|label>"); err != nil {
+		return nil, err
+	}
+	b, err := bisquit.NewAddressBook(c, addressBook)
+	if err != nil {
+		return nil, err
+	}
+	if err = b.RemoveDestination(args[0]); err != nil {
+		return nil, err
+	}
+	return "destination removed", nil
+}
+
+//----------------------------------------------------------------------
+// Payment account commands
+//----------------------------------------------------------------------
+
+func createPaymentAccount(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<form-file>"); err != nil {
+		return nil, err
+	}
+	var (
+		form []byte
+		err  error
+	)
+	if args[0] == "-" {
+		form, err = io.ReadAll(os.Stdin)
+	} else {
+		form, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.CreatePaymentAccount(ctx, string(form))
+}
+
+func getPaymentAccounts(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.GetPaymentAccounts(ctx)
+}
+
+func getPaymentMethods(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	return c.GetPaymentMethods(ctx)
+}
+
+func getPaymentAccountForm(ctx context.Context, c *bisquit.Client, args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "<method-id>"); err != nil {
+		return nil, err
+	}
+	return c.GetPaymentAccountForm(ctx, args[0])
+}
@@ -0,0 +1,248 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bfix/bisquit"
+)
+
+// Error codes
+var (
+	ErrConfigProfile = fmt.Errorf("Unknown profile")
+)
+
+// Config for the command-line tool
+type Config struct {
+	Host     string `json:"host"`              // host:port of Bisq gRPC daemon
+	Password string `json:"password"`          // API password
+	Timeout  int    `json:"timeout"`           // RPC timeout in seconds
+	DataDir  string `json:"datadir,omitempty"` // Bisq application directory
+
+	// named node settings (replace the settings above if selected)
+	Profiles map[string]*Config `json:"profiles,omitempty"`
+	Profile  string             `json:"profile,omitempty"` // default profile
+}
+
+// merge non-empty settings
+func (cfg *Config) merge(p *Config) {
+	if len(p.Host) > 0 {
+		cfg.Host = p.Host
+	}
+	if len(p.Password) > 0 {
+		cfg.Password = p.Password
+	}
+	if p.Timeout > 0 {
+		cfg.Timeout = p.Timeout
+	}
+	if len(p.DataDir) > 0 {
+		cfg.DataDir = p.DataDir
+	}
+}
+
+// useDataDir reads host and password from a Bisq application directory
+func (cfg *Config) useDataDir(dir string) error {
+	dd, err := bisquit.ReadDataDir(dir)
+	if err != nil {
+		return err
+	}
+	cfg.DataDir = dd.AppDir
+	cfg.Host = dd.Host
+	cfg.Password = dd.Password
+	return nil
+}
+
+// path of the address book file (set by option)
+var addressBook string
+
+// defaultAddressBookPath returns the path of the default address book
+func defaultAddressBookPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bisquit", "addressbook.json")
+}
+
+// defaultConfigPath returns the path of the default config file
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bisquit", "config.json")
+}
+
+// readConfig reads the config file (if it exists) and applies settings
+// of the selected profile (or the default profile of the file if empty),
+// of a Bisq application directory and from the environment (BISQ_API_HOST
+// and BISQ_API_PASSWORD).
+func readConfig(path, profile string, required bool) (cfg *Config, err error) {
+	cfg = &Config{
+		Host:    "localhost:9998",
+		Timeout: 30,
+	}
+	if len(path) > 0 {
+		var data []byte
+		if data, err = os.ReadFile(path); err == nil {
+			if err = json.Unmarshal(data, cfg); err != nil {
+				return
+			}
+		} else if required || !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		err = nil
+	}
+	if len(profile) == 0 {
+		profile = cfg.Profile
+	}
+	if len(profile) > 0 {
+		p, ok := cfg.Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("%w '%s'", ErrConfigProfile, profile)
+		}
+		cfg.merge(p)
+		if len(p.DataDir) == 0 {
+			cfg.DataDir = ""
+		}
+	}
+	if len(cfg.DataDir) > 0 {
+		if err = cfg.useDataDir(cfg.DataDir); err != nil {
+			return
+		}
+	}
+	if host := os.Getenv("BISQ_API_HOST"); len(host) > 0 {
+		cfg.Host = host
+	}
+	if passwd := os.Getenv("BISQ_API_PASSWORD"); len(passwd) > 0 {
+		cfg.Password = passwd
+	}
+	return
+}
+
+// usage prints the list of commands
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bisquit [options] <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\nOptions:")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-24s %s\n", name, commands[name].help)
+	}
+}
+
+func main() {
+	var (
+		cfgFile string
+		profile string
+		dataDir string
+		host    string
+		timeout int
+		asJSON  bool
+	)
+	flag.StringVar(&cfgFile, "config", "", "config file (default: "+defaultConfigPath()+")")
+	flag.StringVar(&profile, "profile", "", "name of node profile in config file")
+	flag.StringVar(&dataDir, "datadir", "", "read host and password from Bisq application directory")
+	flag.StringVar(&host, "host", "", "host:port of Bisq gRPC daemon")
+	flag.IntVar(&timeout, "timeout", 0, "RPC timeout in seconds")
+	flag.StringVar(&addressBook, "addressbook", defaultAddressBookPath(), "address book file")
+	flag.BoolVar(&asJSON, "json", false, "print results as JSON")
+	flag.Usage = usage
+	flag.Parse()
+
+	// find command
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	// read configuration
+	required := len(cfgFile) > 0
+	if !required {
+		cfgFile = defaultConfigPath()
+	}
+	cfg, err := readConfig(cfgFile, profile, required)
+	if err == nil && len(dataDir) > 0 {
+		err = cfg.useDataDir(dataDir)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if len(host) > 0 {
+		cfg.Host = host
+	}
+	if timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	if len(cfg.Password) == 0 {
+		fmt.Fprintln(os.Stderr, "no API password defined (use BISQ_API_PASSWORD or config file)")
+		os.Exit(1)
+	}
+
+	// connect to daemon
+	ctx := context.Background()
+	client := bisquit.NewClient(cfg.Host, cfg.Password, time.Duration(cfg.Timeout)*time.Second)
+	if err = client.Connect(ctx, time.Duration(cfg.Timeout)*time.Second); err != nil {
+		fmt.Fprintf(os.Stderr, "connect: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	// execute command
+	res, err := cmd.run(ctx, client, flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err.Error())
+		client.Close()
+		os.Exit(1)
+	}
+	if asJSON {
+		err = printJSON(os.Stdout, res)
+	} else {
+		err = printTable(os.Stdout, res)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "output: %s\n", err.Error())
+		client.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,178 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bfix/bisquit"
+)
+
+func TestReadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"host":"node:9998","password":"secret"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BISQ_API_HOST", "")
+	t.Setenv("BISQ_API_PASSWORD", "")
+	cfg, err := readConfig(path, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "node:9998" || cfg.Password != "secret" || cfg.Timeout != 30 {
+		t.Fatalf("unexpected config: %v", cfg)
+	}
+	// environment overrides file
+	t.Setenv("BISQ_API_HOST", "other:9998")
+	if cfg, err = readConfig(path, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "other:9998" {
+		t.Fatalf("unexpected host '%s'", cfg.Host)
+	}
+	// missing file
+	if _, err = readConfig(path+".missing", "", true); err == nil {
+		t.Fatal("missing required config file accepted")
+	}
+	if _, err = readConfig(path+".missing", "", false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSecretFlags(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "passwd")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WALLET_PASSWORD", "from-env")
+	stdin = bufio.NewReader(strings.NewReader("first\nsecond\n"))
+	for _, tc := range []struct {
+		args []string
+		exp  string
+	}{
+		{[]string{"-password-env", "WALLET_PASSWORD"}, "from-env"},
+		{[]string{"-password-file", path}, "from-file"},
+		{nil, "first"},
+		{nil, "second"},
+	} {
+		var f secretFlags
+		fs := newFlags("test")
+		f.register(fs, "", "password")
+		if err := fs.Parse(tc.args); err != nil {
+			t.Fatal(err)
+		}
+		if passwd, err := readSecret(ctx, f.source("Password")); err != nil || passwd != tc.exp {
+			t.Fatalf("%v: wrong password '%s' (%v)", tc.args, passwd, err)
+		}
+	}
+	if _, err := readSecret(ctx, promptSecret("Password")); err == nil {
+		t.Fatal("missing input accepted")
+	}
+}
+
+func TestReadConfigProfiles(t *testing.T) {
+	dir := t.TempDir()
+	appDir := filepath.Join(dir, "Bisq")
+	os.MkdirAll(appDir, 0700)
+	if err := os.WriteFile(filepath.Join(appDir, "bisq.properties"), []byte("apiPassword=local\napiPort=9999\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	data := `{"host":"node:9998","password":"secret","profile":"eu","profiles":{
+		"eu":{"host":"eu:9998","password":"eu-secret","timeout":60},
+		"local":{"datadir":"` + appDir + `"}}}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BISQ_API_HOST", "")
+	t.Setenv("BISQ_API_PASSWORD", "")
+	for _, tc := range []struct {
+		profile, host, passwd string
+		timeout               int
+	}{
+		{"", "eu:9998", "eu-secret", 60},
+		{"eu", "eu:9998", "eu-secret", 60},
+		{"local", "localhost:9999", "local", 30},
+	} {
+		cfg, err := readConfig(path, tc.profile, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Host != tc.host || cfg.Password != tc.passwd || cfg.Timeout != tc.timeout {
+			t.Fatalf("profile '%s': unexpected config: %v", tc.profile, cfg)
+		}
+	}
+	if _, err := readConfig(path, "us", true); !errors.Is(err, ErrConfigProfile) {
+		t.Fatalf("unknown profile accepted: %v", err)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	offers := []*bisquit.OfferInfo{
+		{Id: "o1", Direction: "BUY", Price: "30000", Amount: 1234567, PaymentMethodId: "SEPA"},
+	}
+	buf := new(bytes.Buffer)
+	if err := printTable(buf, offers); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "0.01234567") || !strings.Contains(buf.String(), "SEPA") {
+		t.Fatalf("unexpected table output:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := printJSON(buf, offers); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"paymentMethodId": "SEPA"`) {
+		t.Fatalf("unexpected JSON output:\n%s", buf.String())
+	}
+
+	// trades with deadlines
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	trade := &bisquit.TradeInfo{TradeId: "t1", Date: uint64(start.UnixMilli()), Offer: offers[0]}
+	d, err := bisquit.NewTradeDeadline(trade, &bisquit.PaymentMethod{Id: "SEPA", MaxTradePeriod: 6 * 86400000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	views := []*tradeView{{trade: trade, deadline: d}, {trade: &bisquit.TradeInfo{TradeId: "t2"}}}
+	buf.Reset()
+	if err = printTable(buf, views); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "2024-03-07 12:00") || !strings.Contains(buf.String(), "DEADLINE") {
+		t.Fatalf("unexpected table output:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err = printJSON(buf, views); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"tradeId": "t1"`) || strings.Count(buf.String(), `"half":`) != 1 {
+		t.Fatalf("unexpected JSON output:\n%s", buf.String())
+	}
+}
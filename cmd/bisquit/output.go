@@ -0,0 +1,312 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+//----------------------------------------------------------------------
+// JSON output
+//----------------------------------------------------------------------
+
+// printJSON prints a result in JSON format; Protobuf messages (and lists
+// of messages) are encoded with protojson.
+func printJSON(w io.Writer, res interface{}) error {
+	data, err := toJSON(res)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// toJSON converts a result into a JSON-encodable value
+func toJSON(res interface{}) (interface{}, error) {
+	if msg, ok := res.(proto.Message); ok {
+		data, err := protojson.Marshal(msg)
+		return json.RawMessage(data), err
+	}
+	v := reflect.ValueOf(res)
+	if v.Kind() == reflect.Slice && v.Type().Elem().Implements(reflect.TypeOf((*proto.Message)(nil)).Elem()) {
+		list := make([]json.RawMessage, v.Len())
+		for i := range list {
+			data, err := protojson.Marshal(v.Index(i).Interface().(proto.Message))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = data
+		}
+		return list, nil
+	}
+	return res, nil
+}
+
+// tradeView is a trade with the deadlines of its trade period
+type tradeView struct {
+	trade    *bisquit.TradeInfo     // trade information
+	deadline *bisquit.TradeDeadline // deadlines (nil if not open)
+}
+
+// MarshalJSON encodes the trade with protojson and adds the deadlines
+// as field "deadline".
+func (v *tradeView) MarshalJSON() ([]byte, error) {
+	data, err := protojson.Marshal(v.trade)
+	if err != nil {
+		return nil, err
+	}
+	obj := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	if v.deadline != nil {
+		if obj["deadline"], err = json.Marshal(v.deadline); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(obj)
+}
+
+//----------------------------------------------------------------------
+// Table output
+//----------------------------------------------------------------------
+
+// printTable prints a result in human-readable form
+func printTable(w io.Writer, res interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch r := res.(type) {
+	case []*bisquit.OfferInfo:
+		fmt.Fprintln(tw, "ID\tDIRECTION\tPRICE\tAMOUNT\tMIN AMOUNT\tMETHOD\tCURRENCY\tCREATED")
+		for _, o := range r {
+			mthd := o.PaymentMethodShortName
+			if len(mthd) == 0 {
+				mthd = o.PaymentMethodId
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				o.Id, o.Direction, o.Price, btc(o.Amount), btc(o.MinAmount),
+				mthd, o.CounterCurrencyCode, date(o.Date))
+		}
+	case *bisquit.OfferInfo:
+		return printTable(w, []*bisquit.OfferInfo{r})
+
+	case []*bisquit.TradeInfo:
+		fmt.Fprintln(tw, "ID\tSHORT ID\tROLE\tPHASE\tAMOUNT\tPRICE\tVOLUME\tCREATED")
+		for _, t := range r {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.TradeId, t.ShortId, t.Role, t.Phase, btc(t.TradeAmountAsLong),
+				t.TradePrice, t.TradeVolume, date(t.Date))
+		}
+	case *bisquit.TradeInfo:
+		return printTable(w, []*bisquit.TradeInfo{r})
+
+	case []*tradeView:
+		now := time.Now()
+		fmt.Fprintln(tw, "ID\tSHORT ID\tROLE\tPHASE\tAMOUNT\tPRICE\tVOLUME\tCREATED\tHALF PERIOD\tDEADLINE\tREMAINING")
+		for _, v := range r {
+			t, half, deadline, remaining := v.trade, "-", "-", "-"
+			if d := v.deadline; d != nil {
+				half = d.Half.Format("2006-01-02 15:04")
+				deadline = d.Deadline.Format("2006-01-02 15:04")
+				remaining = d.Remaining(now).Round(time.Minute).String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.TradeId, t.ShortId, t.Role, t.Phase, btc(t.TradeAmountAsLong),
+				t.TradePrice, t.TradeVolume, date(t.Date), half, deadline, remaining)
+		}
+	case *tradeView:
+		return printTable(w, []*tradeView{r})
+
+	case []*bisquit.TradeDeadline:
+		now := time.Now()
+		fmt.Fprintln(tw, "SHORT ID\tPHASE\tMETHOD\tSTATE\tHALF PERIOD\tDEADLINE\tREMAINING")
+		for _, d := range r {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				d.ShortID, d.Phase, d.Method, d.State(now), d.Half.Format("2006-01-02 15:04"),
+				d.Deadline.Format("2006-01-02 15:04"), d.Remaining(now).Round(time.Minute))
+		}
+
+	case []*bisquit.PaymentAccount:
+		fmt.Fprintln(tw, "ID\tNAME\tMETHOD\tCURRENCIES")
+		for _, a := range r {
+			var currs []string
+			for _, tc := range a.TradeCurrencies {
+				currs = append(currs, tc.Code)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Id, a.AccountName, a.PaymentMethod.GetId(), strings.Join(currs, ","))
+		}
+	case *bisquit.PaymentAccount:
+		return printTable(w, []*bisquit.PaymentAccount{r})
+
+	case []*bisquit.PaymentMethod:
+		fmt.Fprintln(tw, "ID\tMAX TRADE PERIOD\tMAX TRADE LIMIT")
+		for _, m := range r {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", m.Id, time.Duration(m.MaxTradePeriod)*time.Millisecond, btc(uint64(m.MaxTradeLimit)))
+		}
+
+	case []*bisquit.AddressBalanceInfo:
+		fmt.Fprintln(tw, "ADDRESS\tBALANCE\tCONFIRMATIONS\tUNUSED")
+		for _, a := range r {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%v\n", a.Address, btc(uint64(a.Balance)), a.NumConfirmations, a.IsAddressUnused)
+		}
+	case *bisquit.AddressBalanceInfo:
+		return printTable(w, []*bisquit.AddressBalanceInfo{r})
+
+	case *bisquit.BalancesInfo:
+		fmt.Fprintln(tw, "BTC\t")
+		fmt.Fprintf(tw, "  available\t%s\n", btc(r.Btc.GetAvailableBalance()))
+		fmt.Fprintf(tw, "  reserved\t%s\n", btc(r.Btc.GetReservedBalance()))
+		fmt.Fprintf(tw, "  total available\t%s\n", btc(r.Btc.GetTotalAvailableBalance()))
+		fmt.Fprintf(tw, "  locked\t%s\n", btc(r.Btc.GetLockedBalance()))
+		fmt.Fprintln(tw, "BSQ\t")
+		fmt.Fprintf(tw, "  available confirmed\t%s\n", bsq(r.Bsq.GetAvailableConfirmedBalance()))
+		fmt.Fprintf(tw, "  unverified\t%s\n", bsq(r.Bsq.GetUnverifiedBalance()))
+		fmt.Fprintf(tw, "  unconfirmed change\t%s\n", bsq(r.Bsq.GetUnconfirmedChangeBalance()))
+		fmt.Fprintf(tw, "  locked for voting\t%s\n", bsq(r.Bsq.GetLockedForVotingBalance()))
+		fmt.Fprintf(tw, "  lockup bonds\t%s\n", bsq(r.Bsq.GetLockupBondsBalance()))
+		fmt.Fprintf(tw, "  unlocking bonds\t%s\n", bsq(r.Bsq.GetUnlockingBondsBalance()))
+
+	case *bisquit.TxFeeRateInfo:
+		fmt.Fprintf(tw, "use custom rate\t%v\n", r.UseCustomTxFeeRate)
+		fmt.Fprintf(tw, "custom rate\t%d sats/vbyte\n", r.CustomTxFeeRate)
+		fmt.Fprintf(tw, "fee service rate\t%d sats/vbyte\n", r.FeeServiceRate)
+		fmt.Fprintf(tw, "min. fee service rate\t%d sats/vbyte\n", r.MinFeeServiceRate)
+		fmt.Fprintf(tw, "last request\t%s\n", date(r.LastFeeServiceRequestTs))
+
+	case *bisquit.OfferFunds:
+		fmt.Fprintf(tw, "amount\t%s\n", btc(r.Amount))
+		fmt.Fprintf(tw, "security deposit\t%s\n", btc(r.Deposit))
+		fmt.Fprintf(tw, "maker fee\t%s\n", btc(r.MakerFee))
+		fmt.Fprintf(tw, "tx fee\t%s\n", btc(r.TxFee))
+		fmt.Fprintf(tw, "total\t%s\n", btc(r.Total))
+		fmt.Fprintf(tw, "available\t%s\n", btc(r.Available))
+
+	case []*bisquit.FundingAddress:
+		fmt.Fprintln(tw, "ADDRESS\tBALANCE\tCONFIRMATIONS\tUNUSED\tREUSED\tPURPOSE\tLABEL")
+		for _, a := range r {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%v\t%v\t%s\t%s\n",
+				a.Address, btc(uint64(a.Balance)), a.Confirmations, a.Unused, a.Reused, a.Purpose, a.Label)
+		}
+
+	case []*bisquit.AddressLabel:
+		fmt.Fprintln(tw, "ADDRESS\tASSET\tPURPOSE\tLABEL\tCREATED")
+		for _, e := range r {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				e.Address, e.Asset, e.Purpose, e.Label, e.Created.Format("2006-01-02 15:04"))
+		}
+	case *bisquit.AddressLabel:
+		return printTable(w, []*bisquit.AddressLabel{r})
+
+	case *bisquit.FeeChange:
+		rate := func(r uint64) string {
+			if r == 0 {
+				return "fee service rate"
+			}
+			return fmt.Sprintf("%d sats/vbyte", r)
+		}
+		fmt.Fprintf(tw, "old preference\t%s\n", rate(r.Old))
+		fmt.Fprintf(tw, "new preference\t%s\n", rate(r.New))
+		fmt.Fprintf(tw, "reason\t%s\n", r.Reason)
+
+	case []*bisquit.BsqSwapReport:
+		fmt.Fprintln(tw, "DATE\tTRADE ID\tROLE\tSIDE\tPRICE\tBTC\tBSQ\tBSQ FEE\tCONF\tERROR")
+		for _, sw := range r {
+			role, side := "taker", "sell BTC"
+			if sw.Maker {
+				role = "maker"
+			}
+			if sw.BuyBtc {
+				side = "buy BTC"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				sw.Time.Format("2006-01-02 15:04"), sw.ShortID, role, side, sw.Price,
+				btc(sw.BtcAmount), bsq(sw.BsqAmount), bsq(sw.BsqFee), sw.Confirmations, sw.Error)
+		}
+	case []*bisquit.TxInfo:
+		fmt.Fprintln(tw, "TX ID\tINPUT SUM\tOUTPUT SUM\tFEE\tPENDING\tMEMO")
+		for _, tx := range r {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%v\t%s\n",
+				tx.TxId, btc(tx.InputSum), btc(tx.OutputSum), btc(tx.Fee), tx.IsPending, tx.Memo)
+		}
+	case *bisquit.TxInfo:
+		fmt.Fprintf(tw, "tx id\t%s\n", r.TxId)
+		fmt.Fprintf(tw, "input sum\t%s\n", btc(r.InputSum))
+		fmt.Fprintf(tw, "output sum\t%s\n", btc(r.OutputSum))
+		fmt.Fprintf(tw, "fee\t%s\n", btc(r.Fee))
+		fmt.Fprintf(tw, "size\t%d bytes\n", r.Size)
+		fmt.Fprintf(tw, "pending\t%v\n", r.IsPending)
+		fmt.Fprintf(tw, "memo\t%s\n", r.Memo)
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(r))
+		for k := range r {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s\t%v\n", k, r[k])
+		}
+
+	case proto.Message:
+		// generic message
+		out, err := protojson.MarshalOptions{Multiline: true}.Marshal(r)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(tw, string(out))
+
+	default:
+		fmt.Fprintln(tw, res)
+	}
+	return tw.Flush()
+}
+
+// btc formats an amount in satoshis as BTC
+func btc(sats uint64) string {
+	return fmt.Sprintf("%d.%08d", sats/100000000, sats%100000000)
+}
+
+// bsq formats an amount in BSQ satoshis (1/100 BSQ) as BSQ
+func bsq(units uint64) string {
+	return fmt.Sprintf("%d.%02d", units/100, units%100)
+}
+
+// date formats a timestamp in milliseconds since epoch
+func date(ms uint64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return time.UnixMilli(int64(ms)).UTC().Format("2006-01-02 15:04")
+}
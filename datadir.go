@@ -0,0 +1,229 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Error codes
+var (
+	ErrDataDirOption   = fmt.Errorf("Invalid option (expected '--key=value')")
+	ErrDataDirNetwork  = fmt.Errorf("Unknown base currency network")
+	ErrDataDirPassword = fmt.Errorf("No API password configured")
+)
+
+// Name of the Bisq config file in the application directory
+const BisqProperties = "bisq.properties"
+
+// Default API port of a Bisq daemon
+const DefaultAPIPort = "9998"
+
+// Base currency networks and their folders in the application directory
+var networkDirs = map[string]string{
+	"BTC_MAINNET": "btc_mainnet",
+	"BTC_TESTNET": "btc_testnet",
+	"BTC_REGTEST": "btc_regtest",
+}
+
+// DefaultDataDir returns the default Bisq application directory.
+func DefaultDataDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(os.Getenv("APPDATA"), "Bisq")
+	case "darwin":
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, "Library", "Application Support", "Bisq")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "share", "Bisq")
+}
+
+// ParseProperties reads settings in Java properties format ("key=value"
+// or "key: value" per line, '#' and '!' start comments, lines ending with
+// a backslash are continued).
+func ParseProperties(r io.Reader) (map[string]string, error) {
+	props := make(map[string]string)
+	scan := bufio.NewScanner(r)
+	line := ""
+	for scan.Scan() {
+		s := strings.TrimSpace(scan.Text())
+		if len(line) == 0 && (len(s) == 0 || s[0] == '#' || s[0] == '!') {
+			continue
+		}
+		if strings.HasSuffix(s, "\\") && !strings.HasSuffix(s, "\\\\") {
+			line += s[:len(s)-1]
+			continue
+		}
+		line += s
+		key, val := line, ""
+		if i := strings.IndexAny(line, "=:"); i != -1 {
+			key, val = line[:i], line[i+1:]
+		}
+		props[strings.TrimSpace(key)] = unescape(strings.TrimSpace(val))
+		line = ""
+	}
+	return props, scan.Err()
+}
+
+// unescape backslash sequences in property values
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 't':
+				buf.WriteByte('\t')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			default:
+				buf.WriteByte(s[i])
+			}
+			continue
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// DataDirConfig is the API configuration of a Bisq daemon.
+type DataDirConfig struct {
+	AppDir   string            // application directory
+	Network  string            // base currency network (like "BTC_MAINNET")
+	NetDir   string            // network folder in the application directory
+	Host     string            // host:port of the API
+	Password string            // API password
+	Props    map[string]string // all settings (config file and overrides)
+}
+
+// ReadDataDir reads the configuration of a Bisq daemon from its application
+// directory (default directory if path is empty). The path can also be a
+// network folder like "btc_mainnet". Settings from the "bisq.properties"
+// file can be overridden by Bisq command-line options ("--apiPort=9999").
+func ReadDataDir(path string, overrides ...string) (*DataDirConfig, error) {
+	if len(path) == 0 {
+		path = DefaultDataDir()
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	cfg := &DataDirConfig{
+		AppDir: path,
+		Props:  make(map[string]string),
+	}
+	// path is a network folder?
+	for network, dir := range networkDirs {
+		if filepath.Base(path) == dir {
+			cfg.AppDir = filepath.Dir(path)
+			cfg.Network = network
+		}
+	}
+	// parse overrides
+	opts := make(map[string]string)
+	for _, arg := range overrides {
+		arg = strings.TrimLeft(arg, "-")
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, ErrDataDirOption
+		}
+		opts[kv[0]] = kv[1]
+	}
+	if dir, ok := opts["appDataDir"]; ok {
+		cfg.AppDir = dir
+	}
+	// read config file: the application directory has precedence over the
+	// network folders.
+	candidates := []string{filepath.Join(cfg.AppDir, BisqProperties)}
+	if len(cfg.Network) > 0 {
+		candidates = append(candidates, filepath.Join(path, BisqProperties))
+	} else {
+		for _, network := range []string{"BTC_MAINNET", "BTC_TESTNET", "BTC_REGTEST"} {
+			candidates = append(candidates, filepath.Join(cfg.AppDir, networkDirs[network], BisqProperties))
+		}
+	}
+	for _, fn := range candidates {
+		f, err := os.Open(fn)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		props, err := ParseProperties(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Props = props
+		if len(cfg.Network) == 0 && filepath.Dir(fn) != cfg.AppDir {
+			cfg.Network = strings.ToUpper(filepath.Base(filepath.Dir(fn)))
+		}
+		break
+	}
+	for k, v := range opts {
+		cfg.Props[k] = v
+	}
+	// evaluate settings
+	if network, ok := cfg.Props["baseCurrencyNetwork"]; ok {
+		cfg.Network = strings.ToUpper(network)
+	}
+	if len(cfg.Network) == 0 {
+		cfg.Network = "BTC_MAINNET"
+	}
+	dir, ok := networkDirs[cfg.Network]
+	if !ok {
+		return nil, ErrDataDirNetwork
+	}
+	cfg.NetDir = filepath.Join(cfg.AppDir, dir)
+	port, ok := cfg.Props["apiPort"]
+	if !ok {
+		port = DefaultAPIPort
+	}
+	cfg.Host = net.JoinHostPort("localhost", port)
+	if cfg.Password = cfg.Props["apiPassword"]; len(cfg.Password) == 0 {
+		return nil, ErrDataDirPassword
+	}
+	return cfg, nil
+}
+
+// NewClientFromDataDir creates a client for the Bisq daemon using the
+// application directory at path (see ReadDataDir).
+func NewClientFromDataDir(path string, overrides []string, timeout time.Duration, opts ...Option) (*Client, error) {
+	cfg, err := ReadDataDir(path, overrides...)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(cfg.Host, cfg.Password, timeout, opts...), nil
+}
@@ -0,0 +1,116 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProperties(t *testing.T) {
+	props, err := ParseProperties(strings.NewReader(`
+# comment
+! another comment
+apiPassword=pa\=ss\\word
+apiPort : 9999
+torrcOptions=a,\
+    b
+empty
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"apiPassword":  `pa=ss\word`,
+		"apiPort":      "9999",
+		"torrcOptions": "a,b",
+		"empty":        "",
+	} {
+		if props[k] != v {
+			t.Fatalf("property '%s': got '%s', expected '%s'", k, props[k], v)
+		}
+	}
+}
+
+func TestReadDataDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, content string) {
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// no config
+	if _, err := ReadDataDir(dir); !errors.Is(err, ErrDataDirPassword) {
+		t.Fatalf("missing password accepted: %v", err)
+	}
+	// config in network folder
+	write(filepath.Join(dir, "btc_regtest", BisqProperties), "apiPassword=regtest\napiPort=9997\n")
+	cfg, err := ReadDataDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Network != "BTC_REGTEST" || cfg.Host != "localhost:9997" || cfg.Password != "regtest" {
+		t.Fatalf("wrong config: %+v", cfg)
+	}
+	// config in application directory has precedence
+	write(filepath.Join(dir, BisqProperties), "apiPassword=secret\n")
+	if cfg, err = ReadDataDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Network != "BTC_MAINNET" || cfg.Host != "localhost:9998" || cfg.Password != "secret" {
+		t.Fatalf("wrong config: %+v", cfg)
+	}
+	if cfg.NetDir != filepath.Join(dir, "btc_mainnet") {
+		t.Fatalf("wrong network folder '%s'", cfg.NetDir)
+	}
+	// command-line overrides
+	if cfg, err = ReadDataDir(dir, "--apiPort=9000", "--baseCurrencyNetwork=btc_testnet"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Network != "BTC_TESTNET" || cfg.Host != "localhost:9000" {
+		t.Fatalf("wrong config: %+v", cfg)
+	}
+	if _, err = ReadDataDir(dir, "--apiPort"); !errors.Is(err, ErrDataDirOption) {
+		t.Fatalf("invalid option accepted: %v", err)
+	}
+	if _, err = ReadDataDir(dir, "--baseCurrencyNetwork=LTC_MAINNET"); !errors.Is(err, ErrDataDirNetwork) {
+		t.Fatalf("invalid network accepted: %v", err)
+	}
+	// network folder as path
+	if cfg, err = ReadDataDir(filepath.Join(dir, "btc_regtest")); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Network != "BTC_REGTEST" || cfg.AppDir != dir || cfg.Password != "secret" {
+		t.Fatalf("wrong config: %+v", cfg)
+	}
+	c, err := NewClientFromDataDir(dir, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.rpcHost != "localhost:9998" {
+		t.Fatalf("wrong host '%s'", c.rpcHost)
+	}
+}
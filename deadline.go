@@ -0,0 +1,534 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error codes
+var (
+	ErrDeadlineMethod = fmt.Errorf("Unknown trade period of payment method")
+	ErrDeadlineDate   = fmt.Errorf("Trade without date")
+	ErrDeadlineClosed = fmt.Errorf("Trade is not open")
+)
+
+// Trade period states (as reported in TradeInfo.TradePeriodState)
+const (
+	PeriodFirstHalf  = "FIRST_HALF"
+	PeriodSecondHalf = "SECOND_HALF"
+	PeriodOver       = "TRADE_PERIOD_OVER"
+)
+
+// Kinds of deadlines
+const (
+	DeadlineHalf  = "half"  // second half of trade period starts
+	DeadlineFinal = "final" // trade period is over
+)
+
+// TradeErrors holds the errors of trades that were skipped (by trade ID).
+type TradeErrors map[string]error
+
+// Error returns a combined error message (sorted by trade ID).
+func (e TradeErrors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = id + ": " + e[id].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// DefaultDeadlineLeads are the lead times of reminders before a deadline.
+var DefaultDeadlineLeads = []time.Duration{24 * time.Hour, 2 * time.Hour, 0}
+
+// TradeDeadline is the view of an open trade with the deadlines of its
+// trade period. The period starts with the trade date and its length is
+// the max. trade period of the payment method.
+type TradeDeadline struct {
+	TradeID     string        `json:"tradeId"`     // trade identifier
+	ShortID     string        `json:"shortId"`     // short trade identifier
+	Role        string        `json:"role"`        // our role in the trade
+	Phase       string        `json:"phase"`       // trade phase
+	PeriodState string        `json:"periodState"` // period state reported by daemon
+	Method      string        `json:"method"`      // payment method
+	Currency    string        `json:"currency"`    // counter currency
+	Amount      uint64        `json:"amount"`      // BTC amount (sats)
+	Volume      string        `json:"volume"`      // counter currency volume
+	Start       time.Time     `json:"start"`       // start of trade period
+	Period      time.Duration `json:"period"`      // length of trade period
+	Half        time.Time     `json:"half"`        // half-period warning
+	Deadline    time.Time     `json:"deadline"`    // end of trade period
+}
+
+// NewTradeDeadline computes the deadlines of a trade for the max. trade
+// period of its payment method.
+func NewTradeDeadline(trade *TradeInfo, method *PaymentMethod) (*TradeDeadline, error) {
+	if trade.Date == 0 {
+		return nil, fmt.Errorf("%w '%s'", ErrDeadlineDate, trade.TradeId)
+	}
+	if method.GetMaxTradePeriod() <= 0 {
+		return nil, fmt.Errorf("%w '%s'", ErrDeadlineMethod, trade.Offer.GetPaymentMethodId())
+	}
+	d := &TradeDeadline{
+		TradeID:     trade.TradeId,
+		ShortID:     trade.ShortId,
+		Role:        trade.Role,
+		Phase:       trade.Phase,
+		PeriodState: trade.TradePeriodState,
+		Method:      method.Id,
+		Currency:    trade.Offer.GetCounterCurrencyCode(),
+		Amount:      trade.TradeAmountAsLong,
+		Volume:      trade.TradeVolume,
+		Start:       time.UnixMilli(int64(trade.Date)).UTC(),
+		Period:      time.Duration(method.MaxTradePeriod) * time.Millisecond,
+	}
+	d.Half = d.Start.Add(d.Period / 2)
+	d.Deadline = d.Start.Add(d.Period)
+	return d, nil
+}
+
+// State returns the trade period state at given time.
+func (d *TradeDeadline) State(now time.Time) string {
+	switch {
+	case now.Before(d.Half):
+		return PeriodFirstHalf
+	case now.Before(d.Deadline):
+		return PeriodSecondHalf
+	}
+	return PeriodOver
+}
+
+// Remaining returns the time left until the end of the trade period
+// (negative if it is over).
+func (d *TradeDeadline) Remaining(now time.Time) time.Duration {
+	return d.Deadline.Sub(now)
+}
+
+// Time returns the time of a deadline kind.
+func (d *TradeDeadline) Time(kind string) time.Time {
+	if kind == DeadlineHalf {
+		return d.Half
+	}
+	return d.Deadline
+}
+
+// tradeOpen returns true if the trade period of a trade is relevant
+func tradeOpen(trade *TradeInfo) bool {
+	return !trade.IsCompleted && !trade.IsPayoutPublished
+}
+
+//----------------------------------------------------------------------
+// Reminders
+//----------------------------------------------------------------------
+
+// DeadlineReminder is fired if a deadline of a trade approaches.
+type DeadlineReminder struct {
+	Deadline *TradeDeadline `json:"deadline"` // trade deadlines
+	Kind     string         `json:"kind"`     // DeadlineHalf or DeadlineFinal
+	Due      time.Time      `json:"due"`      // time of deadline
+	Lead     time.Duration  `json:"lead"`     // lead time of reminder
+	Message  string         `json:"message"`  // human-readable message
+}
+
+// newReminder creates a reminder for a deadline
+func newReminder(d *TradeDeadline, kind string, lead time.Duration, now time.Time) *DeadlineReminder {
+	r := &DeadlineReminder{
+		Deadline: d,
+		Kind:     kind,
+		Due:      d.Time(kind),
+		Lead:     lead,
+	}
+	left := r.Due.Sub(now).Round(time.Minute)
+	switch {
+	case kind == DeadlineHalf && left > 0:
+		r.Message = fmt.Sprintf("Trade %s: second half of trade period starts in %s (%s UTC).",
+			d.ShortID, left, r.Due.Format("2006-01-02 15:04"))
+	case kind == DeadlineHalf:
+		r.Message = fmt.Sprintf("Trade %s: second half of trade period has started (phase %s).",
+			d.ShortID, d.Phase)
+	case left > 0:
+		r.Message = fmt.Sprintf("Trade %s: trade period ends in %s (%s UTC, phase %s).",
+			d.ShortID, left, r.Due.Format("2006-01-02 15:04"), d.Phase)
+	default:
+		r.Message = fmt.Sprintf("Trade %s: trade period is over (phase %s); open a dispute if the trade can't be completed.",
+			d.ShortID, d.Phase)
+	}
+	return r
+}
+
+// deadlineState is the persistent state of the deadline service
+type deadlineState struct {
+	Fired map[string]bool `json:"fired"` // reminders fired (trade/kind[/lead])
+}
+
+// DeadlineService computes the deadlines of open trades and fires
+// reminders as they approach. The half-period warning is reminded when
+// it is reached, the final deadline at each lead time before.
+type DeadlineService struct {
+	client  *Client                   // client for API calls
+	path    string                    // state file ("" = in memory)
+	leads   []time.Duration           // lead times of final reminders
+	methods map[string]*PaymentMethod // payment methods by identifier
+	state   *deadlineState            // reminders fired
+	mtx     sync.Mutex                // serialize access
+}
+
+// NewDeadlineService creates a new deadline service with a state file
+// and given lead times (DefaultDeadlineLeads if none are given). Fired
+// reminders are remembered in the state file.
+func NewDeadlineService(c *Client, path string, leads ...time.Duration) (*DeadlineService, error) {
+	if len(leads) == 0 {
+		leads = DefaultDeadlineLeads
+	}
+	leads = append([]time.Duration(nil), leads...)
+	sort.Slice(leads, func(i, j int) bool { return leads[i] > leads[j] })
+	s := &DeadlineService{
+		client: c,
+		path:   path,
+		leads:  leads,
+		state:  new(deadlineState),
+	}
+	if len(path) > 0 {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			if err = json.Unmarshal(data, s.state); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if s.state.Fired == nil {
+		s.state.Fired = make(map[string]bool)
+	}
+	return s, nil
+}
+
+// save the state (locked)
+func (s *DeadlineService) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// method returns the payment method of a trade; the list of payment
+// methods is requested once.
+func (s *DeadlineService) method(ctx context.Context, trade *TradeInfo) (*PaymentMethod, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.methods == nil {
+		list, err := s.client.GetPaymentMethods(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.methods = make(map[string]*PaymentMethod)
+		for _, m := range list {
+			s.methods[m.Id] = m
+		}
+	}
+	id := trade.Offer.GetPaymentMethodId()
+	m, ok := s.methods[id]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrDeadlineMethod, id)
+	}
+	return m, nil
+}
+
+// Deadline returns the deadlines of an open trade.
+func (s *DeadlineService) Deadline(ctx context.Context, tradeID string) (*TradeDeadline, error) {
+	trade, err := s.client.GetTrade(ctx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if !tradeOpen(trade) {
+		return nil, fmt.Errorf("%w '%s'", ErrDeadlineClosed, tradeID)
+	}
+	m, err := s.method(ctx, trade)
+	if err != nil {
+		return nil, err
+	}
+	return NewTradeDeadline(trade, m)
+}
+
+// Deadlines returns the deadlines of all open trades (sorted by final
+// deadline). Trades without deadlines (unknown payment method or missing
+// date) are skipped; their errors are returned as TradeErrors together
+// with the deadlines of the other trades.
+func (s *DeadlineService) Deadlines(ctx context.Context) ([]*TradeDeadline, error) {
+	trades, err := s.client.GetTrades(ctx, int(GetTradesRequest_OPEN))
+	if err != nil {
+		return nil, err
+	}
+	return s.DeadlinesOf(ctx, trades)
+}
+
+// DeadlinesOf returns the deadlines of the open trades in a list (sorted
+// by final deadline). Closed trades are ignored; trades without deadlines
+// are reported as TradeErrors.
+func (s *DeadlineService) DeadlinesOf(ctx context.Context, trades []*TradeInfo) ([]*TradeDeadline, error) {
+	var (
+		list []*TradeDeadline
+		errs TradeErrors
+	)
+	for _, trade := range trades {
+		if !tradeOpen(trade) {
+			continue
+		}
+		m, err := s.method(ctx, trade)
+		if err != nil {
+			if !errors.Is(err, ErrDeadlineMethod) {
+				return nil, err
+			}
+		} else {
+			var d *TradeDeadline
+			if d, err = NewTradeDeadline(trade, m); err == nil {
+				list = append(list, d)
+				continue
+			}
+		}
+		if errs == nil {
+			errs = make(TradeErrors)
+		}
+		errs[trade.TradeId] = err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Deadline.Before(list[j].Deadline)
+	})
+	if errs != nil {
+		return list, errs
+	}
+	return list, nil
+}
+
+// Reminders returns the reminders due at given time that have not fired
+// before. Only the most urgent pending reminder per deadline is returned.
+func (s *DeadlineService) Reminders(list []*TradeDeadline, now time.Time) (res []*DeadlineReminder) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, d := range list {
+		if !now.Before(d.Half) && now.Before(d.Deadline) {
+			key := d.TradeID + "/" + DeadlineHalf
+			if !s.state.Fired[key] {
+				s.state.Fired[key] = true
+				res = append(res, newReminder(d, DeadlineHalf, 0, now))
+			}
+		}
+		var r *DeadlineReminder
+		for _, lead := range s.leads {
+			if now.Before(d.Deadline.Add(-lead)) {
+				break
+			}
+			key := fmt.Sprintf("%s/%s/%s", d.TradeID, DeadlineFinal, lead)
+			if !s.state.Fired[key] {
+				s.state.Fired[key] = true
+				r = newReminder(d, DeadlineFinal, lead, now)
+			}
+		}
+		if r != nil {
+			res = append(res, r)
+		}
+	}
+	return
+}
+
+// Check computes the deadlines of open trades and returns due reminders.
+// Fired reminders of trades that are no longer open are forgotten.
+// Skipped trades are reported as TradeErrors.
+func (s *DeadlineService) Check(ctx context.Context) ([]*DeadlineReminder, error) {
+	list, err := s.Deadlines(ctx)
+	errs, ok := err.(TradeErrors)
+	if err != nil && !ok {
+		return nil, err
+	}
+	res := s.Reminders(list, time.Now())
+	if err = s.prune(list, errs); err != nil {
+		return res, err
+	}
+	if errs != nil {
+		return res, errs
+	}
+	return res, nil
+}
+
+// prune fired reminders of trades that are neither in the list nor
+// skipped and save the state.
+func (s *DeadlineService) prune(list []*TradeDeadline, skipped TradeErrors) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	open := make(map[string]bool)
+	for _, d := range list {
+		open[d.TradeID] = true
+	}
+	for id := range skipped {
+		open[id] = true
+	}
+	for key := range s.state.Fired {
+		if id, _, _ := strings.Cut(key, "/"); !open[id] {
+			delete(s.state.Fired, key)
+		}
+	}
+	return s.save()
+}
+
+// Run checks the deadlines in given intervals until the context is
+// cancelled. Reminders and errors are passed to the callbacks (if
+// defined).
+func (s *DeadlineService) Run(ctx context.Context, interval time.Duration, cb func(*DeadlineReminder), errCb func(error)) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		list, err := s.Check(ctx)
+		if err != nil && errCb != nil {
+			errCb(err)
+		}
+		if cb != nil {
+			for _, r := range list {
+				cb(r)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+//----------------------------------------------------------------------
+// iCalendar export
+//----------------------------------------------------------------------
+
+// icalEscape escapes text values (RFC 5545, 3.3.11)
+var icalEscape = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// icalTime formats a time in UTC
+func icalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icalDuration formats a lead time as negative duration
+func icalDuration(d time.Duration) string {
+	if d <= 0 {
+		return "PT0S"
+	}
+	if m := int(d.Minutes()); m%60 != 0 {
+		return fmt.Sprintf("-PT%dM", m)
+	}
+	return fmt.Sprintf("-PT%dH", int(d.Hours()))
+}
+
+// icalWriter writes content lines folded at 75 octets
+type icalWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes a content line
+func (iw *icalWriter) line(name, value string) {
+	if iw.err != nil {
+		return
+	}
+	s := name + ":" + value
+	// continuation lines start with a space
+	for limit := 75; len(s) > limit; limit = 74 {
+		// don't split UTF-8 sequences
+		n := limit
+		for n > 0 && s[n]&0xc0 == 0x80 {
+			n--
+		}
+		if _, iw.err = iw.w.WriteString(s[:n] + "\r\n "); iw.err != nil {
+			return
+		}
+		s = s[n:]
+	}
+	_, iw.err = iw.w.WriteString(s + "\r\n")
+}
+
+// WriteDeadlinesICal exports the deadlines of trades as iCalendar feed
+// (RFC 5545) with an event for the half-period warning and the final
+// deadline of every trade. The final deadlines carry alarms at the given
+// lead times.
+func WriteDeadlinesICal(w io.Writer, list []*TradeDeadline, leads []time.Duration, now time.Time) error {
+	iw := &icalWriter{w: bufio.NewWriter(w)}
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//bisquit//trade deadlines//EN")
+	iw.line("CALSCALE", "GREGORIAN")
+	iw.line("X-WR-CALNAME", "Bisq trade deadlines")
+	for _, d := range list {
+		for _, kind := range []string{DeadlineHalf, DeadlineFinal} {
+			summary := "Bisq trade " + d.ShortID + ": trade period ends"
+			if kind == DeadlineHalf {
+				summary = "Bisq trade " + d.ShortID + ": second half of trade period"
+			}
+			desc := fmt.Sprintf("Trade %s (%s)\n%s\nAmount: %d.%08d BTC for %s %s (%s)\nPhase: %s",
+				d.ShortID, d.TradeID, d.Role, d.Amount/100000000, d.Amount%100000000,
+				d.Volume, d.Currency, d.Method, d.Phase)
+			iw.line("BEGIN", "VEVENT")
+			iw.line("UID", d.TradeID+"-"+kind+"@bisquit")
+			iw.line("DTSTAMP", icalTime(now))
+			iw.line("DTSTART", icalTime(d.Time(kind)))
+			iw.line("DURATION", "PT15M")
+			iw.line("SUMMARY", icalEscape.Replace(summary))
+			iw.line("DESCRIPTION", icalEscape.Replace(desc))
+			iw.line("CATEGORIES", "BISQ")
+			if kind == DeadlineFinal {
+				for _, lead := range leads {
+					iw.line("BEGIN", "VALARM")
+					iw.line("ACTION", "DISPLAY")
+					iw.line("DESCRIPTION", icalEscape.Replace(summary))
+					iw.line("TRIGGER", icalDuration(lead))
+					iw.line("END", "VALARM")
+				}
+			}
+			iw.line("END", "VEVENT")
+		}
+	}
+	iw.line("END", "VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
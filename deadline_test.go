@@ -0,0 +1,189 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// test trade started 2024-03-01 12:00 UTC with a SEPA offer (6 days)
+func deadlineTrade() (*TradeInfo, *PaymentMethod) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	trade := &TradeInfo{
+		TradeId:           "t1-0123456789",
+		ShortId:           "t1",
+		Role:              "BTC buyer as taker",
+		Date:              uint64(start.UnixMilli()),
+		Phase:             "DEPOSIT_CONFIRMED",
+		TradeAmountAsLong: 1000000,
+		TradeVolume:       "300.00",
+		Offer:             &OfferInfo{PaymentMethodId: "SEPA", CounterCurrencyCode: "EUR"},
+	}
+	return trade, &PaymentMethod{Id: "SEPA", MaxTradePeriod: 6 * 86400000}
+}
+
+func TestTradeDeadline(t *testing.T) {
+	trade, method := deadlineTrade()
+	d, err := NewTradeDeadline(trade, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Period != 144*time.Hour || !d.Half.Equal(d.Start.Add(72*time.Hour)) || !d.Deadline.Equal(d.Start.Add(144*time.Hour)) {
+		t.Fatalf("wrong deadlines: %v", d)
+	}
+	for _, tc := range []struct {
+		ofs   time.Duration
+		state string
+	}{
+		{time.Hour, PeriodFirstHalf},
+		{72 * time.Hour, PeriodSecondHalf},
+		{144 * time.Hour, PeriodOver},
+	} {
+		if s := d.State(d.Start.Add(tc.ofs)); s != tc.state {
+			t.Fatalf("after %s: expected %s, got %s", tc.ofs, tc.state, s)
+		}
+	}
+	if _, err = NewTradeDeadline(trade, &PaymentMethod{Id: "SEPA"}); !errors.Is(err, ErrDeadlineMethod) {
+		t.Fatalf("missing trade period accepted: %v", err)
+	}
+	trade.Date = 0
+	if _, err = NewTradeDeadline(trade, method); !errors.Is(err, ErrDeadlineDate) {
+		t.Fatalf("missing trade date accepted: %v", err)
+	}
+}
+
+func TestDeadlineReminders(t *testing.T) {
+	trade, method := deadlineTrade()
+	d, _ := NewTradeDeadline(trade, method)
+	path := filepath.Join(t.TempDir(), "deadlines.json")
+	s, err := NewDeadlineService(testClient, path, 2*time.Hour, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []*TradeDeadline{d}
+	for i, tc := range []struct {
+		ofs  time.Duration
+		kind []string
+		lead time.Duration
+	}{
+		{time.Hour, nil, 0},
+		{73 * time.Hour, []string{DeadlineHalf}, 0},
+		{74 * time.Hour, nil, 0},
+		{121 * time.Hour, []string{DeadlineFinal}, 24 * time.Hour},
+		{122 * time.Hour, nil, 0},
+		// service was down: only the most urgent reminder is fired
+		{150 * time.Hour, []string{DeadlineFinal}, 2 * time.Hour},
+		{151 * time.Hour, nil, 0},
+	} {
+		res := s.Reminders(list, d.Start.Add(tc.ofs))
+		if len(res) != len(tc.kind) {
+			t.Fatalf("step %d: expected %d reminders, got %d", i, len(tc.kind), len(res))
+		}
+		for j, r := range res {
+			if r.Kind != tc.kind[j] || (r.Kind == DeadlineFinal && r.Lead != tc.lead) || len(r.Message) == 0 {
+				t.Fatalf("step %d: unexpected reminder %v", i, r)
+			}
+		}
+	}
+
+	// fired reminders survive a restart
+	if err = s.prune(list, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = NewDeadlineService(testClient, path, 2*time.Hour, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if res := s.Reminders(list, d.Start.Add(150*time.Hour)); len(res) != 0 {
+		t.Fatalf("reminders repeated after restart: %v", res)
+	}
+	// ... and are forgotten when the trade is closed
+	if err = s.prune(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = NewDeadlineService(testClient, path); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.state.Fired) != 0 {
+		t.Fatalf("fired reminders not pruned: %v", s.state.Fired)
+	}
+	// trades without deadlines are skipped and reported
+	skip1, _ := deadlineTrade()
+	skip1.TradeId, skip1.Date = "t2", 0
+	skip2, _ := deadlineTrade()
+	skip2.TradeId, skip2.Offer = "t3", &OfferInfo{PaymentMethodId: "UNKNOWN"}
+	s.methods = map[string]*PaymentMethod{method.Id: method}
+	res, err := s.DeadlinesOf(context.Background(), []*TradeInfo{skip1, trade, skip2})
+	errs, ok := err.(TradeErrors)
+	if !ok || len(errs) != 2 || !errors.Is(errs["t2"], ErrDeadlineDate) || !errors.Is(errs["t3"], ErrDeadlineMethod) {
+		t.Fatalf("wrong trade errors: %v", err)
+	}
+	if len(res) != 1 || res[0].TradeID != trade.TradeId {
+		t.Fatalf("wrong deadlines: %v", res)
+	}
+	// ... and their fired reminders are kept
+	s.state.Fired["t2/final/0s"] = true
+	if err = s.prune(res, errs); err != nil {
+		t.Fatal(err)
+	}
+	if !s.state.Fired["t2/final/0s"] {
+		t.Fatal("fired reminder of skipped trade pruned")
+	}
+	needDaemon(t)
+	// deadlines of open trades (none in test daemon)
+	if _, err := s.Deadlines(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeadlinesICal(t *testing.T) {
+	trade, method := deadlineTrade()
+	trade.Role = strings.Repeat("very long role description, ", 4)
+	d, _ := NewTradeDeadline(trade, method)
+	buf := new(bytes.Buffer)
+	now := time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC)
+	if err := WriteDeadlinesICal(buf, []*TradeDeadline{d}, DefaultDeadlineLeads, now); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{
+		"BEGIN:VCALENDAR\r\n", "UID:t1-0123456789-half@bisquit\r\n", "DTSTART:20240304T120000Z\r\n",
+		"UID:t1-0123456789-final@bisquit\r\n", "DTSTART:20240307T120000Z\r\n", "DTSTAMP:20240302T080000Z\r\n",
+		"TRIGGER:-PT24H\r\n", "TRIGGER:-PT2H\r\n", "TRIGGER:PT0S\r\n", "very long role description\\,", "END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(strings.ReplaceAll(out, "\r\n ", ""), s) {
+			t.Fatalf("missing '%s' in:\n%s", s, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line not folded: %s", line)
+		}
+	}
+	if strings.Count(out, "BEGIN:VEVENT") != 2 || strings.Count(out, "BEGIN:VALARM") != 3 {
+		t.Fatalf("unexpected events:\n%s", out)
+	}
+}
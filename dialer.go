@@ -0,0 +1,315 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+)
+
+// Error codes
+var (
+	ErrDialerProxy = fmt.Errorf("Proxy does not support dialing with context")
+)
+
+// DefaultTorProxy is the SOCKS5 address of a local Tor daemon.
+const DefaultTorProxy = "127.0.0.1:9050"
+
+// Dialer establishes the network connection to a Bisq daemon for the
+// given address (the host argument of NewClient).
+type Dialer func(ctx context.Context, addr string) (net.Conn, error)
+
+// WithDialer uses a custom dialer to connect to the daemon.
+func WithDialer(d Dialer) Option {
+	return func(c *Client) {
+		c.dialer = d
+	}
+}
+
+// WithUnixSocket connects to a daemon listening on (or forwarded to) a
+// unix domain socket. The host argument of NewClient is only used as the
+// authority of requests (e.g. "localhost").
+func WithUnixSocket(path string) Option {
+	return WithDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	})
+}
+
+// WithSOCKS5 connects to the daemon through a SOCKS5 proxy. The host name
+// is resolved by the proxy (required for onion services); user and
+// password are optional.
+func WithSOCKS5(proxyAddr, user, passwd string) Option {
+	var auth *proxy.Auth
+	if len(user) > 0 || len(passwd) > 0 {
+		auth = &proxy.Auth{
+			User:     user,
+			Password: passwd,
+		}
+	}
+	return WithDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialSOCKS5(ctx, proxyAddr, auth, addr)
+	})
+}
+
+// dialSOCKS5 connects to an address through a SOCKS5 proxy
+func dialSOCKS5(ctx context.Context, proxyAddr string, auth *proxy.Auth, addr string) (net.Conn, error) {
+	d, err := proxy.SOCKS5("tcp", proxyAddr, auth, proxy.Direct)
+	if err != nil {
+		return nil, err
+	}
+	cd, ok := d.(proxy.ContextDialer)
+	if !ok {
+		return nil, ErrDialerProxy
+	}
+	return cd.DialContext(ctx, "tcp", addr)
+}
+
+// source of random Tor credentials
+var torRand io.Reader = rand.Reader
+
+// WithTor connects to the daemon through a Tor SOCKS5 proxy (default
+// proxy address is used if empty). The client uses random credentials
+// for the proxy, so Tor isolates its streams from the streams of other
+// applications (and other clients) on separate circuits. The credentials
+// are generated on first dial; a failure is returned as dial error.
+func WithTor(proxyAddr string) Option {
+	if len(proxyAddr) == 0 {
+		proxyAddr = DefaultTorProxy
+	}
+	var (
+		auth *proxy.Auth
+		mtx  sync.Mutex
+	)
+	return WithDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		mtx.Lock()
+		if auth == nil {
+			buf := make([]byte, 16)
+			if _, err := io.ReadFull(torRand, buf); err != nil {
+				mtx.Unlock()
+				return nil, err
+			}
+			auth = &proxy.Auth{
+				User:     "bisquit",
+				Password: hex.EncodeToString(buf),
+			}
+		}
+		a := auth
+		mtx.Unlock()
+		return dialSOCKS5(ctx, proxyAddr, a, addr)
+	})
+}
+
+//----------------------------------------------------------------------
+// SSH tunnel
+//----------------------------------------------------------------------
+
+// SSHTunnel forwards connections to a daemon over an SSH connection to
+// its host (like "ssh -L"), but without an external ssh process. The SSH
+// connection is established on first use and re-established if broken.
+type SSHTunnel struct {
+	addr    string            // host:port of SSH server
+	cfg     *ssh.ClientConfig // SSH client configuration
+	client  *ssh.Client       // active SSH connection
+	pending chan struct{}     // closed when a pending connect is done
+	mtx     sync.Mutex        // serialize access
+}
+
+// NewSSHTunnel creates a new tunnel over the SSH server at given address.
+func NewSSHTunnel(addr string, cfg *ssh.ClientConfig) *SSHTunnel {
+	return &SSHTunnel{
+		addr: addr,
+		cfg:  cfg,
+	}
+}
+
+// SSHConfig returns a client configuration for key-based authentication.
+// The private key is read from a (OpenSSH or PEM) file and decrypted with
+// the passphrase (if not nil); the SSH server must be listed in the
+// known_hosts file.
+func SSHConfig(user, keyFile string, passphrase []byte, knownHostsFile string) (*ssh.ClientConfig, error) {
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(key)
+	var signer ssh.Signer
+	if passphrase != nil {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// connect to the SSH server
+func (t *SSHTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	// honor context during handshake
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	cc, chans, reqs, err := ssh.NewClientConn(conn, t.addr, t.cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(cc, chans, reqs), nil
+}
+
+// sshClient returns the active SSH connection or establishes a new one.
+// Concurrent callers wait for a pending connect (or their context).
+func (t *SSHTunnel) sshClient(ctx context.Context) (*ssh.Client, error) {
+	for {
+		t.mtx.Lock()
+		if t.client != nil {
+			client := t.client
+			t.mtx.Unlock()
+			return client, nil
+		}
+		if wait := t.pending; wait != nil {
+			t.mtx.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		t.pending = done
+		t.mtx.Unlock()
+
+		client, err := t.connect(ctx)
+		t.mtx.Lock()
+		t.client, t.pending = client, nil
+		close(done)
+		t.mtx.Unlock()
+		return client, err
+	}
+}
+
+// drop a broken SSH connection
+func (t *SSHTunnel) drop(client *ssh.Client) {
+	t.mtx.Lock()
+	if t.client == client {
+		t.client = nil
+	}
+	t.mtx.Unlock()
+	client.Close()
+}
+
+// dialSSH opens a forwarded connection; the dial is abandoned if the
+// context is done before (the connection is closed when it completes).
+func dialSSH(ctx context.Context, client *ssh.Client, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	res := make(chan *result, 1)
+	go func() {
+		conn, err := client.Dial("tcp", addr)
+		res <- &result{conn, err}
+	}()
+	select {
+	case r := <-res:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-res; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Dial a connection to addr (as seen from the SSH server) through the
+// tunnel.
+func (t *SSHTunnel) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	client, err := t.sshClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialSSH(ctx, client, addr)
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+	// a forward rejected by the server leaves the connection intact;
+	// otherwise it might be broken: try again on a new one.
+	var rejected *ssh.OpenChannelError
+	if errors.As(err, &rejected) {
+		return nil, err
+	}
+	t.drop(client)
+	if client, err = t.sshClient(ctx); err != nil {
+		return nil, err
+	}
+	return dialSSH(ctx, client, addr)
+}
+
+// Close the SSH connection.
+func (t *SSHTunnel) Close() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.client == nil {
+		return nil
+	}
+	err := t.client.Close()
+	t.client = nil
+	return err
+}
+
+// WithSSHTunnel connects to the daemon through an SSH tunnel. The host
+// argument of NewClient is the address of the daemon as seen from the SSH
+// server (e.g. "127.0.0.1:9998"). The tunnel is not closed with the client.
+func WithSSHTunnel(t *SSHTunnel) Option {
+	return WithDialer(t.Dial)
+}
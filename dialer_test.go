@@ -0,0 +1,325 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"google.golang.org/grpc"
+)
+
+// pipe data between two connections until one side closes
+func pipe(a, b io.ReadWriteCloser) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+	}()
+	io.Copy(b, a)
+	b.Close()
+}
+
+// serve accepts connections on a listener and handles them
+func serve(t *testing.T, lst net.Listener, handle func(net.Conn)) {
+	t.Cleanup(func() { lst.Close() })
+	go func() {
+		for {
+			conn, err := lst.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+}
+
+// stubDaemon answers GetVersion requests
+type stubDaemon struct {
+	UnimplementedGetVersionServer
+}
+
+// GetVersion returns a fixed version
+func (stubDaemon) GetVersion(context.Context, *GetVersionRequest) (*GetVersionReply, error) {
+	return &GetVersionReply{Version: "1.9.99"}, nil
+}
+
+// startStubDaemon starts a local gRPC server as stand-in for the daemon
+// and returns its address.
+func startStubDaemon(t *testing.T) string {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	RegisterGetVersionServer(srv, stubDaemon{})
+	go srv.Serve(lst)
+	t.Cleanup(srv.Stop)
+	return lst.Addr().String()
+}
+
+// connect a client with given options and request the daemon version
+func checkDialer(t *testing.T, host string, opts ...Option) {
+	ctx := context.Background()
+	c := NewClient(host, "secret", 10*time.Second, opts...)
+	if err := c.Connect(ctx, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	version, err := c.GetVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "1.9.99" {
+		t.Fatalf("unexpected version '%s'", version)
+	}
+}
+
+func TestDialerUnix(t *testing.T) {
+	daemon := startStubDaemon(t)
+	path := filepath.Join(t.TempDir(), "bisq.sock")
+	lst, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(t, lst, func(conn net.Conn) {
+		fwd, err := net.Dial("tcp", daemon)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		pipe(conn, fwd)
+	})
+	checkDialer(t, "localhost", WithUnixSocket(path))
+}
+
+func TestDialerSOCKS5(t *testing.T) {
+	daemon := startStubDaemon(t)
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		users []string
+		mtx   sync.Mutex
+	)
+	// minimal SOCKS5 proxy (username/password auth, CONNECT only)
+	serve(t, lst, func(conn net.Conn) {
+		defer conn.Close()
+		buf := make([]byte, 262)
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil || buf[0] != 5 {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+			return
+		}
+		conn.Write([]byte{5, 2})
+		// RFC 1929 sub-negotiation
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		user := make([]byte, buf[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, buf[:1])
+		io.ReadFull(conn, buf[1:1+buf[0]])
+		mtx.Lock()
+		users = append(users, string(user)+":"+string(buf[1:1+buf[0]]))
+		mtx.Unlock()
+		conn.Write([]byte{1, 0})
+		// connect request
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil || buf[1] != 1 {
+			return
+		}
+		var host string
+		switch buf[3] {
+		case 1:
+			io.ReadFull(conn, buf[:4])
+			host = net.IP(buf[:4]).String()
+		case 3:
+			io.ReadFull(conn, buf[:1])
+			io.ReadFull(conn, buf[1:1+buf[0]])
+			host = string(buf[1 : 1+buf[0]])
+		default:
+			return
+		}
+		io.ReadFull(conn, buf[:2])
+		port := binary.BigEndian.Uint16(buf[:2])
+		fwd, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		pipe(conn, fwd)
+	})
+	checkDialer(t, daemon, WithSOCKS5(lst.Addr().String(), "user", "pass"))
+	checkDialer(t, daemon, WithTor(lst.Addr().String()))
+	checkDialer(t, daemon, WithTor(lst.Addr().String()))
+
+	// stream isolation: Tor clients use distinct credentials
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(users) != 3 || users[0] != "user:pass" || users[1] == users[2] {
+		t.Fatalf("wrong proxy credentials: %v", users)
+	}
+
+	// failing random source is reported by the dialer
+	torRand = iotest.ErrReader(io.ErrUnexpectedEOF)
+	defer func() { torRand = rand.Reader }()
+	c := NewClient(daemon, "secret", time.Second, WithTor(lst.Addr().String()))
+	if _, err := c.dialer(context.Background(), daemon); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected dial error: %v", err)
+	}
+}
+
+func TestDialerSSH(t *testing.T) {
+	daemon := startStubDaemon(t)
+	dir := t.TempDir()
+	// host and client keys
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	sshPub, _ := ssh.NewPublicKey(clientPub)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(clientPriv, "", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// SSH server accepting the client key and forwarding TCP connections
+	srvCfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "bisq" && string(key.Marshal()) == string(sshPub.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	srvCfg.AddHostKey(hostSigner)
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stuck := make(chan struct{})
+	defer close(stuck)
+	serve(t, lst, func(conn net.Conn) {
+		_, chans, reqs, err := ssh.NewServerConn(conn, srvCfg)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for nc := range chans {
+			go func(nc ssh.NewChannel) {
+				var target struct {
+					Host     string
+					Port     uint32
+					OrigHost string
+					OrigPort uint32
+				}
+				if nc.ChannelType() != "direct-tcpip" || ssh.Unmarshal(nc.ExtraData(), &target) != nil {
+					nc.Reject(ssh.UnknownChannelType, "unsupported")
+					return
+				}
+				// forwards to this host never complete
+				if target.Host == "stuck.invalid" {
+					<-stuck
+					nc.Reject(ssh.ConnectionFailed, "stuck")
+					return
+				}
+				fwd, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+				if err != nil {
+					nc.Reject(ssh.ConnectionFailed, err.Error())
+					return
+				}
+				ch, creqs, err := nc.Accept()
+				if err != nil {
+					fwd.Close()
+					return
+				}
+				go ssh.DiscardRequests(creqs)
+				pipe(ch, fwd)
+			}(nc)
+		}
+	})
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{lst.Addr().String()}, hostSigner.PublicKey())
+	if err = os.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := SSHConfig("bisq", keyFile, []byte("secret"), knownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnel := NewSSHTunnel(lst.Addr().String(), cfg)
+	defer tunnel.Close()
+	checkDialer(t, daemon, WithSSHTunnel(tunnel))
+
+	// a stuck forward honors its context and doesn't block other dials
+	errCh := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		_, err := tunnel.Dial(ctx, "stuck.invalid:9998")
+		errCh <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	conn, err := tunnel.Dial(ctx, daemon)
+	cancel()
+	if err != nil {
+		t.Fatalf("dial blocked by stuck forward: %v", err)
+	}
+	conn.Close()
+	if err = <-errCh; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("stuck forward: %v", err)
+	}
+	checkDialer(t, daemon, WithSSHTunnel(tunnel))
+
+	// unknown host key is rejected
+	os.WriteFile(knownHosts, nil, 0600)
+	if cfg, err = SSHConfig("bisq", keyFile, []byte("secret"), knownHosts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewSSHTunnel(lst.Addr().String(), cfg).Dial(context.Background(), daemon); err == nil {
+		t.Fatal("unknown host key accepted")
+	}
+}
@@ -0,0 +1,601 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error codes
+var (
+	ErrExecNoSender       = fmt.Errorf("No payment sender defined")
+	ErrExecNoVerifier     = fmt.Errorf("No payment verifier defined")
+	ErrExecPaymentUnknown = fmt.Errorf("Outcome of payment unknown (clear payment to retry)")
+	ErrExecPaymentState   = fmt.Errorf("Payment can't be cleared")
+)
+
+//----------------------------------------------------------------------
+// Payment sender and verifier
+//----------------------------------------------------------------------
+
+// PaymentSender initiates the (fiat or altcoin) payment for a trade
+// where we are the BTC buyer. The executor calls the sender only once
+// per trade (recorded in its journal); a failed or interrupted payment
+// is only retried after the operator cleared it.
+type PaymentSender interface {
+	SendPayment(ctx context.Context, trade *TradeInfo) error
+}
+
+// PaymentSenderFunc is a function implementing the PaymentSender interface
+type PaymentSenderFunc func(ctx context.Context, trade *TradeInfo) error
+
+// SendPayment for trade
+func (f PaymentSenderFunc) SendPayment(ctx context.Context, trade *TradeInfo) error {
+	return f(ctx, trade)
+}
+
+// PaymentVerifier checks if the payment for a trade was received where
+// we are the BTC seller.
+type PaymentVerifier interface {
+	VerifyPayment(ctx context.Context, trade *TradeInfo) (bool, error)
+}
+
+// PaymentVerifierFunc is a function implementing the PaymentVerifier interface
+type PaymentVerifierFunc func(ctx context.Context, trade *TradeInfo) (bool, error)
+
+// VerifyPayment for trade
+func (f PaymentVerifierFunc) VerifyPayment(ctx context.Context, trade *TradeInfo) (bool, error) {
+	return f(ctx, trade)
+}
+
+// ManualVerifier waits for a human to approve the payment of a trade.
+// A notification function is called once for every new trade that
+// requires approval.
+type ManualVerifier struct {
+	notify   func(*TradeInfo) // notification for new requests
+	pending  map[string]bool  // trades waiting for approval
+	approved map[string]bool  // approved trades
+	mtx      sync.Mutex       // serialize access
+}
+
+// NewManualVerifier creates a new verifier for manual approvals.
+func NewManualVerifier(notify func(*TradeInfo)) *ManualVerifier {
+	return &ManualVerifier{
+		notify:   notify,
+		pending:  make(map[string]bool),
+		approved: make(map[string]bool),
+	}
+}
+
+// Approve the payment for a trade.
+func (v *ManualVerifier) Approve(tradeID string) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.approved[tradeID] = true
+	delete(v.pending, tradeID)
+}
+
+// Pending returns the IDs of trades waiting for approval.
+func (v *ManualVerifier) Pending() (list []string) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	for id := range v.pending {
+		list = append(list, id)
+	}
+	return
+}
+
+// VerifyPayment returns true if the payment was approved.
+func (v *ManualVerifier) VerifyPayment(ctx context.Context, trade *TradeInfo) (bool, error) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if v.approved[trade.TradeId] {
+		return true, nil
+	}
+	if !v.pending[trade.TradeId] {
+		v.pending[trade.TradeId] = true
+		if v.notify != nil {
+			v.notify(trade)
+		}
+	}
+	return false, nil
+}
+
+// BsqVerifier checks if the BSQ payment for a trade was received by our
+// BSQ address in the trade contract.
+type BsqVerifier struct {
+	client *Client
+}
+
+// NewBsqVerifier creates a new verifier for BSQ payments.
+func NewBsqVerifier(c *Client) *BsqVerifier {
+	return &BsqVerifier{client: c}
+}
+
+// VerifyPayment returns true if the BSQ amount was received.
+func (v *BsqVerifier) VerifyPayment(ctx context.Context, trade *TradeInfo) (bool, error) {
+	if trade.Offer.GetBaseCurrencyCode() != "BSQ" {
+		return false, fmt.Errorf("not a BSQ trade: %s", trade.ShortId)
+	}
+	// our (seller) payment account holds the receiving address
+	contract := trade.Contract
+	accnt := contract.GetMakerPaymentAccountPayload()
+	if contract.GetIsBuyerMakerAndSellerTaker() {
+		accnt = contract.GetTakerPaymentAccountPayload()
+	}
+	if len(accnt.GetAddress()) == 0 {
+		return false, fmt.Errorf("no BSQ address for trade %s", trade.ShortId)
+	}
+	return v.client.VerifyBsqSentToAddress(ctx, accnt.GetAddress(), trade.TradeVolume)
+}
+
+// CSVVerifier checks for payments in a CSV export of bank statements: a
+// payment is found if the reference column contains the short trade ID
+// and the amount column matches the trade volume. The file is re-read
+// on every verification.
+type CSVVerifier struct {
+	Path      string // path to CSV file
+	Comma     rune   // field separator (default ',')
+	Header    bool   // skip first line
+	RefCol    int    // column index of payment reference
+	AmountCol int    // column index of payment amount
+}
+
+// VerifyPayment returns true if a matching entry is found.
+func (v *CSVVerifier) VerifyPayment(ctx context.Context, trade *TradeInfo) (bool, error) {
+	vol, err := ParseAmount(trade.TradeVolume)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.Open(v.Path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	rdr := csv.NewReader(f)
+	if v.Comma != 0 {
+		rdr.Comma = v.Comma
+	}
+	rdr.FieldsPerRecord = -1
+	for first := true; ; first = false {
+		rec, err := rdr.Read()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if (first && v.Header) || len(rec) <= v.RefCol || len(rec) <= v.AmountCol {
+			continue
+		}
+		if !strings.Contains(strings.ToUpper(rec[v.RefCol]), strings.ToUpper(trade.ShortId)) {
+			continue
+		}
+		amount, err := ParseAmount(rec[v.AmountCol])
+		if err != nil {
+			continue
+		}
+		if math.Abs(math.Abs(amount)-vol) < 0.005 {
+			return true, nil
+		}
+	}
+}
+
+// ParseAmount parses a decimal amount in common notations ("1234.56",
+// "1234,56", "1.234,56" or "1,234.56").
+func ParseAmount(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	s = strings.ReplaceAll(s, " ", "")
+	dot := strings.LastIndex(s, ".")
+	comma := strings.LastIndex(s, ",")
+	switch {
+	case comma > dot && strings.Count(s, ",") == 1:
+		// comma is the decimal separator
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	case comma >= 0:
+		// comma is a thousands separator
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+//----------------------------------------------------------------------
+// Trade protocol executor
+//----------------------------------------------------------------------
+
+// Actions performed by the executor
+const (
+	ExecNone           = ""
+	ExecPaymentStarted = "payment-started"
+	ExecPaymentRecvd   = "payment-received"
+	ExecCloseTrade     = "close-trade"
+)
+
+// Payment states in the executor journal
+const (
+	PaymentSending = "sending" // payment in progress (or interrupted)
+	PaymentSent    = "sent"    // payment sent
+	PaymentFailed  = "failed"  // payment failed (might have been sent)
+	PaymentCleared = "cleared" // cleared by operator for another attempt
+)
+
+// ExecPayment is a journal record of a payment for a trade.
+type ExecPayment struct {
+	Time    time.Time `json:"time"`            // time of record
+	TradeID string    `json:"tradeId"`         // trade identifier
+	ShortID string    `json:"shortId"`         // short trade identifier
+	State   string    `json:"state"`           // payment state
+	Error   string    `json:"error,omitempty"` // error message of failed payment
+}
+
+// execLock serializes the processing of a trade
+type execLock struct {
+	mtx  sync.Mutex // trade lock
+	refs int        // number of users
+}
+
+// ExecStep is a log entry for an executor action on a trade.
+type ExecStep struct {
+	Time    time.Time // time of action
+	TradeID string    // trade identifier
+	Phase   string    // trade phase
+	Action  string    // executed action
+	Msg     string    // additional information
+	Err     error     // error (or nil on success)
+}
+
+// String returns a human-readable log entry
+func (s *ExecStep) String() string {
+	msg := fmt.Sprintf("trade %s [%s]: %s", s.TradeID, s.Phase, s.Action)
+	if len(s.Msg) > 0 {
+		msg += " -- " + s.Msg
+	}
+	if s.Err != nil {
+		msg += " -- ERROR: " + s.Err.Error()
+	}
+	return msg
+}
+
+// Executor drives open trades through the trade protocol: as the BTC
+// buyer it sends the payment (using a PaymentSender) and confirms the
+// payment start; as the BTC seller it verifies the receipt of payment
+// (using a PaymentVerifier) and confirms it. Completed trades are closed.
+// Trades on hold are not touched by the executor. Payments are recorded
+// in a journal (JSON lines) and are never sent twice for a trade.
+type Executor struct {
+	client   *Client                 // client for API calls
+	sender   PaymentSender           // payment sender (we are buyer)
+	verifier PaymentVerifier         // payment verifier (we are seller)
+	path     string                  // payment journal ("" = in memory)
+	logger   *log.Logger             // logger for steps
+	holds    map[string]bool         // trades on hold
+	paid     map[string]*ExecPayment // latest payment record per trade
+	locks    map[string]*execLock    // trades in process
+	steps    map[string][]*ExecStep  // executed steps per trade
+	mtx      sync.Mutex              // serialize access
+}
+
+// NewExecutor creates a new trade executor with a payment journal. An
+// existing journal is read.
+func NewExecutor(c *Client, s PaymentSender, v PaymentVerifier, journal string) (*Executor, error) {
+	e := &Executor{
+		client:   c,
+		sender:   s,
+		verifier: v,
+		path:     journal,
+		logger:   log.Default(),
+		holds:    make(map[string]bool),
+		paid:     make(map[string]*ExecPayment),
+		locks:    make(map[string]*execLock),
+		steps:    make(map[string][]*ExecStep),
+	}
+	if len(journal) == 0 {
+		return e, nil
+	}
+	f, err := os.Open(journal)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return e, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		p := new(ExecPayment)
+		if err = dec.Decode(p); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		e.paid[p.TradeID] = p
+	}
+	return e, nil
+}
+
+// record a payment state in the journal
+func (e *Executor) record(trade *TradeInfo, state string, pErr error) error {
+	p := &ExecPayment{
+		Time:    time.Now().UTC(),
+		TradeID: trade.TradeId,
+		ShortID: trade.ShortId,
+		State:   state,
+	}
+	if pErr != nil {
+		p.Error = pErr.Error()
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if len(e.path) > 0 {
+		f, err := os.OpenFile(e.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		if err = json.NewEncoder(f).Encode(p); err != nil {
+			f.Close()
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+	}
+	e.paid[p.TradeID] = p
+	return nil
+}
+
+// Payment returns the latest payment record of a trade.
+func (e *Executor) Payment(tradeID string) (*ExecPayment, bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	p, ok := e.paid[tradeID]
+	if !ok {
+		return nil, false
+	}
+	pp := *p
+	return &pp, true
+}
+
+// ClearPayment allows another payment attempt for a trade whose payment
+// failed or was interrupted. The operator must make sure that no payment
+// was sent before.
+func (e *Executor) ClearPayment(trade *TradeInfo) error {
+	unlock := e.lockTrade(trade.TradeId)
+	defer unlock()
+	p, ok := e.Payment(trade.TradeId)
+	if !ok || (p.State != PaymentSending && p.State != PaymentFailed) {
+		return ErrExecPaymentState
+	}
+	return e.record(trade, PaymentCleared, nil)
+}
+
+// lockTrade serializes the processing of a trade; returns the function
+// to release the lock.
+func (e *Executor) lockTrade(tradeID string) func() {
+	e.mtx.Lock()
+	l, ok := e.locks[tradeID]
+	if !ok {
+		l = new(execLock)
+		e.locks[tradeID] = l
+	}
+	l.refs++
+	e.mtx.Unlock()
+	l.mtx.Lock()
+	return func() {
+		l.mtx.Unlock()
+		e.mtx.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(e.locks, tradeID)
+		}
+		e.mtx.Unlock()
+	}
+}
+
+// SetLogger sets the logger for executed steps (nil to disable logging)
+func (e *Executor) SetLogger(l *log.Logger) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.logger = l
+}
+
+// Hold a trade: the executor will not perform any actions on it.
+func (e *Executor) Hold(tradeID string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.holds[tradeID] = true
+}
+
+// Release a trade from hold.
+func (e *Executor) Release(tradeID string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	delete(e.holds, tradeID)
+}
+
+// IsHeld returns true if the trade is on hold.
+func (e *Executor) IsHeld(tradeID string) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.holds[tradeID]
+}
+
+// Steps returns the executed steps for a trade.
+func (e *Executor) Steps(tradeID string) []*ExecStep {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return append([]*ExecStep{}, e.steps[tradeID]...)
+}
+
+// log an executed step
+func (e *Executor) log(trade *TradeInfo, action, msg string, err error) {
+	step := &ExecStep{
+		Time:    time.Now(),
+		TradeID: trade.TradeId,
+		Phase:   trade.Phase,
+		Action:  action,
+		Msg:     msg,
+		Err:     err,
+	}
+	e.mtx.Lock()
+	e.steps[trade.TradeId] = append(e.steps[trade.TradeId], step)
+	logger := e.logger
+	e.mtx.Unlock()
+	if logger != nil {
+		logger.Println(step.String())
+	}
+}
+
+// NextAction returns the protocol action required for a trade in its
+// current phase (or ExecNone if no action is required).
+func NextAction(trade *TradeInfo) string {
+	switch {
+	case trade.IsCompleted:
+		return ExecNone
+	case trade.IsPayoutPublished || trade.Phase == "PAYOUT_PUBLISHED":
+		return ExecCloseTrade
+	case IsBuyer(trade):
+		if trade.Phase == "DEPOSIT_CONFIRMED" && !trade.IsPaymentStartedMessageSent {
+			return ExecPaymentStarted
+		}
+	default:
+		if trade.Phase == "FIAT_SENT" && !trade.IsPaymentReceivedMessageSent {
+			return ExecPaymentRecvd
+		}
+	}
+	return ExecNone
+}
+
+// Process executes the next protocol step for a trade. All errors are
+// logged as steps.
+func (e *Executor) Process(ctx context.Context, trade *TradeInfo) (err error) {
+	if e.IsHeld(trade.TradeId) {
+		return nil
+	}
+	unlock := e.lockTrade(trade.TradeId)
+	defer unlock()
+
+	action := NextAction(trade)
+	switch action {
+	case ExecPaymentStarted:
+		if e.sender == nil {
+			err = ErrExecNoSender
+			e.log(trade, action, "sending payment", err)
+			return
+		}
+		state := ""
+		if p, ok := e.Payment(trade.TradeId); ok {
+			state = p.State
+		}
+		switch state {
+		case "", PaymentCleared:
+			// reserve payment in journal before sending
+			if err = e.record(trade, PaymentSending, nil); err != nil {
+				e.log(trade, action, "recording payment", err)
+				return
+			}
+			if err = e.sender.SendPayment(ctx, trade); err != nil {
+				e.log(trade, action, "sending payment failed", err)
+				if rErr := e.record(trade, PaymentFailed, err); rErr != nil {
+					e.log(trade, action, "recording payment", rErr)
+				}
+				return
+			}
+			if err = e.record(trade, PaymentSent, nil); err != nil {
+				e.log(trade, action, "recording payment", err)
+				return
+			}
+			e.log(trade, action, "payment sent", nil)
+		case PaymentSent:
+		default:
+			// failed or interrupted payment might have been sent
+			err = ErrExecPaymentUnknown
+			e.log(trade, action, "sending payment", err)
+			return
+		}
+		err = e.client.ConfirmPaymentStarted(ctx, trade.TradeId)
+		e.log(trade, action, "confirm payment started", err)
+
+	case ExecPaymentRecvd:
+		if e.verifier == nil {
+			err = ErrExecNoVerifier
+			e.log(trade, action, "verifying payment", err)
+			return
+		}
+		var ok bool
+		if ok, err = e.verifier.VerifyPayment(ctx, trade); err != nil {
+			e.log(trade, action, "verifying payment failed", err)
+			return
+		}
+		if !ok {
+			return
+		}
+		e.log(trade, action, "payment verified", nil)
+		err = e.client.ConfirmPaymentReceived(ctx, trade.TradeId)
+		e.log(trade, action, "confirm payment received", err)
+
+	case ExecCloseTrade:
+		err = e.client.CloseTrade(ctx, trade.TradeId)
+		e.log(trade, action, "close trade", err)
+	}
+	return
+}
+
+// Step processes all open trades once. Errors on single trades are
+// logged and do not stop the processing of other trades.
+func (e *Executor) Step(ctx context.Context) error {
+	trades, err := e.client.GetTrades(ctx, int(GetTradesRequest_OPEN))
+	if err != nil {
+		return err
+	}
+	for _, trade := range trades {
+		e.Process(ctx, trade)
+	}
+	return nil
+}
+
+// Run the executor in given intervals until the context is cancelled.
+// Errors are passed to the callback (if defined).
+func (e *Executor) Run(ctx context.Context, interval time.Duration, errCb func(error)) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		if err := e.Step(ctx); err != nil && errCb != nil {
+			errCb(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,225 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExecNextAction(t *testing.T) {
+	buyer := &TradeInfo{
+		Offer:    &OfferInfo{IsMyOffer: true},
+		Contract: &ContractInfo{IsBuyerMakerAndSellerTaker: true},
+		Phase:    "DEPOSIT_CONFIRMED",
+	}
+	if a := NextAction(buyer); a != ExecPaymentStarted {
+		t.Fatalf("buyer: unexpected action '%s'", a)
+	}
+	buyer.IsPaymentStartedMessageSent = true
+	if a := NextAction(buyer); a != ExecNone {
+		t.Fatalf("buyer: unexpected action '%s'", a)
+	}
+	seller := &TradeInfo{
+		Offer:    &OfferInfo{},
+		Role:     "BTC seller as taker",
+		Contract: &ContractInfo{IsBuyerMakerAndSellerTaker: true},
+		Phase:    "FIAT_SENT",
+	}
+	if a := NextAction(seller); a != ExecPaymentRecvd {
+		t.Fatalf("seller: unexpected action '%s'", a)
+	}
+	seller.Phase = "PAYOUT_PUBLISHED"
+	if a := NextAction(seller); a != ExecCloseTrade {
+		t.Fatalf("seller: unexpected action '%s'", a)
+	}
+}
+
+func TestExecCSVVerifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bank.csv")
+	data := "date;ref;amount\n" +
+		"2023-01-02;Invoice 42;100,00\n" +
+		"2023-01-03;Bisq trade AbCdEf;1.234,56\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	v := &CSVVerifier{Path: path, Comma: ';', Header: true, RefCol: 1, AmountCol: 2}
+	trade := &TradeInfo{ShortId: "abcdef", TradeVolume: "1234.56"}
+	ok, err := v.VerifyPayment(context.Background(), trade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("payment not found")
+	}
+	trade.TradeVolume = "1234"
+	if ok, _ = v.VerifyPayment(context.Background(), trade); ok {
+		t.Fatal("wrong amount accepted")
+	}
+}
+
+func TestExecManualVerifier(t *testing.T) {
+	notified := 0
+	v := NewManualVerifier(func(*TradeInfo) { notified++ })
+	trade := &TradeInfo{TradeId: "t1"}
+	for i := 0; i < 2; i++ {
+		if ok, _ := v.VerifyPayment(context.Background(), trade); ok {
+			t.Fatal("unapproved payment accepted")
+		}
+	}
+	if notified != 1 || len(v.Pending()) != 1 {
+		t.Fatal("unexpected notification state")
+	}
+	v.Approve("t1")
+	if ok, _ := v.VerifyPayment(context.Background(), trade); !ok {
+		t.Fatal("approved payment not accepted")
+	}
+}
+
+func TestExecHold(t *testing.T) {
+	e, err := NewExecutor(testClient, nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetLogger(nil)
+	trade := &TradeInfo{
+		TradeId:           "t1",
+		Offer:             &OfferInfo{},
+		IsPayoutPublished: true,
+	}
+	e.Hold(trade.TradeId)
+	if err := e.Process(context.Background(), trade); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Steps(trade.TradeId)) != 0 {
+		t.Fatal("held trade processed")
+	}
+	needDaemon(t)
+	if err := e.Step(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecPayment(t *testing.T) {
+	ctx := context.Background()
+	journal := filepath.Join(t.TempDir(), "payments.journal")
+	// client is never connected: confirmations fail after payments
+	c := NewClient("localhost:9998", "", time.Second)
+	var (
+		sent    int
+		fail    bool
+		mtx     sync.Mutex
+		started = make(chan struct{}, 1)
+		release = make(chan struct{})
+	)
+	sender := PaymentSenderFunc(func(ctx context.Context, trade *TradeInfo) error {
+		mtx.Lock()
+		sent++
+		mtx.Unlock()
+		select {
+		case started <- struct{}{}:
+			<-release
+		default:
+		}
+		if fail {
+			return errors.New("bank timeout")
+		}
+		return nil
+	})
+	newExec := func() *Executor {
+		e, err := NewExecutor(c, sender, nil, journal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.SetLogger(nil)
+		return e
+	}
+	e := newExec()
+	trade := &TradeInfo{
+		TradeId:  "t1",
+		ShortId:  "s1",
+		Offer:    &OfferInfo{IsMyOffer: true},
+		Contract: &ContractInfo{IsBuyerMakerAndSellerTaker: true},
+		Phase:    "DEPOSIT_CONFIRMED",
+	}
+
+	// concurrent processing sends the payment once
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Process(ctx, trade)
+		}()
+	}
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if sent != 1 {
+		t.Fatalf("payment sent %d times", sent)
+	}
+	// ... and not again after a restart
+	e = newExec()
+	if err := e.Process(ctx, trade); !errors.Is(err, ErrClientNotConnected) || sent != 1 {
+		t.Fatalf("payment sent %d times (%v)", sent, err)
+	}
+	if err := e.ClearPayment(trade); err != ErrExecPaymentState {
+		t.Fatalf("sent payment cleared: %v", err)
+	}
+
+	// failed payment is only retried after clearing
+	fail = true
+	trade = &TradeInfo{TradeId: "t2", ShortId: "s2", Offer: trade.Offer, Contract: trade.Contract, Phase: trade.Phase}
+	if err := e.Process(ctx, trade); err == nil || sent != 2 {
+		t.Fatalf("failed payment: %d (%v)", sent, err)
+	}
+	e = newExec()
+	if err := e.Process(ctx, trade); err != ErrExecPaymentUnknown || sent != 2 {
+		t.Fatalf("failed payment retried: %d (%v)", sent, err)
+	}
+	if steps := e.Steps(trade.TradeId); len(steps) != 1 || steps[0].Err != ErrExecPaymentUnknown {
+		t.Fatalf("error not logged: %v", steps)
+	}
+	fail = false
+	if err := e.ClearPayment(trade); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Process(ctx, trade); !errors.Is(err, ErrClientNotConnected) || sent != 3 {
+		t.Fatalf("cleared payment: %d (%v)", sent, err)
+	}
+	if p, _ := e.Payment(trade.TradeId); p.State != PaymentSent {
+		t.Fatalf("wrong payment state: %+v", p)
+	}
+
+	// missing sender is logged
+	e, _ = NewExecutor(c, nil, nil, "")
+	e.SetLogger(nil)
+	trade.TradeId = "t3"
+	if err := e.Process(ctx, trade); err != ErrExecNoSender || len(e.Steps("t3")) != 1 {
+		t.Fatalf("missing sender not logged: %v", err)
+	}
+}
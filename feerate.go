@@ -0,0 +1,477 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error codes
+var (
+	ErrFeeUrgency = fmt.Errorf("Unknown fee urgency")
+	ErrFeeWindow  = fmt.Errorf("Invalid fee schedule window")
+	ErrFeeNoRate  = fmt.Errorf("No fee service rate sampled")
+)
+
+// FeeUrgency of a transaction: routine sends can wait for cheaper blocks,
+// withdrawals should confirm fast.
+type FeeUrgency int
+
+// Fee urgency levels
+const (
+	FeeRoutine FeeUrgency = iota // can wait (default preference)
+	FeeNormal                    // next few blocks
+	FeeUrgent                    // next block (withdrawals)
+)
+
+// String returns the name of the urgency level
+func (u FeeUrgency) String() string {
+	switch u {
+	case FeeRoutine:
+		return "routine"
+	case FeeNormal:
+		return "normal"
+	case FeeUrgent:
+		return "urgent"
+	}
+	return "unknown"
+}
+
+// ParseFeeUrgency returns the urgency level for a name.
+func ParseFeeUrgency(s string) (FeeUrgency, error) {
+	for _, u := range []FeeUrgency{FeeRoutine, FeeNormal, FeeUrgent} {
+		if strings.EqualFold(s, u.String()) {
+			return u, nil
+		}
+	}
+	return 0, fmt.Errorf("%w '%s'", ErrFeeUrgency, s)
+}
+
+// MarshalText returns the name of the urgency level (for JSON maps).
+func (u FeeUrgency) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText sets the urgency level from its name.
+func (u *FeeUrgency) UnmarshalText(data []byte) (err error) {
+	*u, err = ParseFeeUrgency(string(data))
+	return
+}
+
+// DefaultFeeFactors are the factors applied to the fee service rate for
+// the urgency levels.
+var DefaultFeeFactors = map[FeeUrgency]float64{
+	FeeRoutine: 0.8,
+	FeeNormal:  1.0,
+	FeeUrgent:  1.5,
+}
+
+// FeeWindow is a time-of-day window (local time) with a factor applied
+// to the fee rate. Windows wrapping midnight (From > To) are allowed.
+type FeeWindow struct {
+	From   time.Duration // start (offset from midnight)
+	To     time.Duration // end (offset from midnight)
+	Factor float64       // factor for fee rate
+}
+
+// feeWindowJSON is the JSON representation of a window
+type feeWindowJSON struct {
+	Window string  `json:"window"` // "HH:MM-HH:MM"
+	Factor float64 `json:"factor"` // factor for fee rate
+}
+
+// MarshalJSON encodes the window as {"window":"HH:MM-HH:MM","factor":f}.
+func (w *FeeWindow) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&feeWindowJSON{Window: w.String(), Factor: w.Factor})
+}
+
+// UnmarshalJSON decodes a window.
+func (w *FeeWindow) UnmarshalJSON(data []byte) error {
+	var v feeWindowJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	fw, err := ParseFeeWindow(v.Window, v.Factor)
+	if err != nil {
+		return err
+	}
+	*w = *fw
+	return nil
+}
+
+// ParseFeeWindow parses a window "HH:MM-HH:MM" with given factor.
+func ParseFeeWindow(s string, factor float64) (*FeeWindow, error) {
+	parse := func(t string) (time.Duration, error) {
+		hm, err := time.Parse("15:04", strings.TrimSpace(t))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(hm.Hour())*time.Hour + time.Duration(hm.Minute())*time.Minute, nil
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 || factor <= 0 {
+		return nil, fmt.Errorf("%w '%s'", ErrFeeWindow, s)
+	}
+	from, err := parse(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s'", ErrFeeWindow, s)
+	}
+	to, err := parse(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s'", ErrFeeWindow, s)
+	}
+	return &FeeWindow{From: from, To: to, Factor: factor}, nil
+}
+
+// Contains returns true if the time of day of t is in the window.
+func (w *FeeWindow) Contains(t time.Time) bool {
+	y, m, d := t.Date()
+	ofs := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if w.From <= w.To {
+		return ofs >= w.From && ofs < w.To
+	}
+	return ofs >= w.From || ofs < w.To
+}
+
+// String returns the window as "HH:MM-HH:MM"
+func (w *FeeWindow) String() string {
+	hm := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return hm(w.From) + "-" + hm(w.To)
+}
+
+// FeePolicy defines how the fee rate preference is derived from the
+// sampled fee service rates.
+type FeePolicy struct {
+	MinRate   uint64                 `json:"minRate"`   // lower bound (sats/vbyte; 0 = none)
+	MaxRate   uint64                 `json:"maxRate"`   // upper bound (sats/vbyte; 0 = none)
+	Factors   map[FeeUrgency]float64 `json:"factors"`   // factors per urgency (nil = defaults)
+	Schedule  []*FeeWindow           `json:"schedule"`  // time-of-day windows (first match)
+	Samples   int                    `json:"samples"`   // number of samples for median
+	Tolerance float64                `json:"tolerance"` // relative change ignored
+}
+
+// DefaultFeePolicy uses the median of the last 6 samples and ignores
+// changes below 10%.
+func DefaultFeePolicy() *FeePolicy {
+	return &FeePolicy{
+		Samples:   6,
+		Tolerance: 0.1,
+	}
+}
+
+// FeeSample is a sampled fee rate information.
+type FeeSample struct {
+	Time        time.Time `json:"time"`        // time of sample
+	ServiceRate uint64    `json:"serviceRate"` // fee service rate (sats/vbyte)
+	MinRate     uint64    `json:"minRate"`     // min. fee service rate
+	Custom      uint64    `json:"custom"`      // custom rate (0 = not used)
+}
+
+// FeeChange is a record of a change of the fee rate preference.
+type FeeChange struct {
+	Time   time.Time `json:"time"`   // time of change
+	Old    uint64    `json:"old"`    // previous preference (0 = unset)
+	New    uint64    `json:"new"`    // new preference (0 = unset)
+	Reason string    `json:"reason"` // reason for change
+}
+
+// FeeManager samples the fee service rates of the daemon and sets (or
+// unsets) the fee rate preference of the wallet according to a policy.
+// All changes are recorded in a journal (JSON lines) if a path is given.
+type FeeManager struct {
+	client  *Client      // client for API calls
+	policy  *FeePolicy   // fee policy
+	path    string       // path to journal file
+	samples []*FeeSample // recent samples (oldest first)
+	changes []*FeeChange // changes of preference
+	apply   sync.Mutex   // serialize Apply calls
+	mtx     sync.Mutex   // serialize access
+}
+
+// NewFeeManager creates a new fee manager with given policy (nil for the
+// default policy); an existing journal is read.
+func NewFeeManager(c *Client, policy *FeePolicy, journal string) (*FeeManager, error) {
+	if policy == nil {
+		policy = DefaultFeePolicy()
+	}
+	m := &FeeManager{
+		client: c,
+		policy: policy,
+		path:   journal,
+	}
+	if len(journal) == 0 {
+		return m, nil
+	}
+	f, err := os.Open(journal)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		ch := new(FeeChange)
+		if err = dec.Decode(ch); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		m.changes = append(m.changes, ch)
+	}
+	return m, nil
+}
+
+// Changes returns the recorded changes of the fee rate preference.
+func (m *FeeManager) Changes() []*FeeChange {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return append([]*FeeChange(nil), m.changes...)
+}
+
+// Samples returns the recent fee rate samples (oldest first).
+func (m *FeeManager) Samples() []*FeeSample {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return append([]*FeeSample(nil), m.samples...)
+}
+
+// Sample the current fee rates of the daemon.
+func (m *FeeManager) Sample(ctx context.Context) (*FeeSample, error) {
+	info, err := m.client.GetTxFeeRate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.add(info, time.Now()), nil
+}
+
+// add a sample (unlocked)
+func (m *FeeManager) add(info *TxFeeRateInfo, now time.Time) *FeeSample {
+	s := &FeeSample{
+		Time:        now,
+		ServiceRate: info.FeeServiceRate,
+		MinRate:     info.MinFeeServiceRate,
+	}
+	if info.UseCustomTxFeeRate {
+		s.Custom = info.CustomTxFeeRate
+	}
+	m.samples = append(m.samples, s)
+	if n := m.policy.Samples; n > 0 && len(m.samples) > n {
+		m.samples = m.samples[len(m.samples)-n:]
+	}
+	return s
+}
+
+// Rate returns the fee rate (sats/vbyte) for a transaction of given
+// urgency at time now and the reason for it. The rate is the median of
+// the sampled fee service rates scaled by the factors for urgency and
+// time of day, bounded by the policy and the spending policy of the
+// client; the minimal fee service rate is applied last.
+func (m *FeeManager) Rate(u FeeUrgency, now time.Time) (uint64, string, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.rate(u, now)
+}
+
+// rate for urgency (unlocked)
+func (m *FeeManager) rate(u FeeUrgency, now time.Time) (uint64, string, error) {
+	if len(m.samples) == 0 {
+		return 0, "", ErrFeeNoRate
+	}
+	factors := m.policy.Factors
+	if factors == nil {
+		factors = DefaultFeeFactors
+	}
+	factor, ok := factors[u]
+	if !ok {
+		return 0, "", fmt.Errorf("%w '%s'", ErrFeeUrgency, u)
+	}
+	rates := make([]uint64, len(m.samples))
+	for i, s := range m.samples {
+		rates[i] = s.ServiceRate
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+	median := rates[len(rates)/2]
+	if len(rates)%2 == 0 {
+		median = (rates[len(rates)/2-1] + median) / 2
+	}
+	reason := []string{fmt.Sprintf("median service rate %d of %d samples", median, len(rates))}
+	if factor != 1 {
+		reason = append(reason, fmt.Sprintf("x%s for %s", ftoa(factor), u))
+	}
+	for _, w := range m.policy.Schedule {
+		if w.Contains(now) {
+			factor *= w.Factor
+			reason = append(reason, fmt.Sprintf("x%s in %s", ftoa(w.Factor), w))
+			break
+		}
+	}
+	rate := uint64(math.Round(float64(median) * factor))
+
+	// apply bounds
+	bound := func(ok bool, r uint64, what string) {
+		if ok {
+			rate = r
+			reason = append(reason, fmt.Sprintf("%s %d", what, r))
+		}
+	}
+	bound(m.policy.MinRate > 0 && rate < m.policy.MinRate, m.policy.MinRate, "raised to policy min.")
+	bound(m.policy.MaxRate > 0 && rate > m.policy.MaxRate, m.policy.MaxRate, "capped at policy max.")
+	if p := m.client.policy; p != nil && p.cfg.MaxFeeRate > 0 {
+		bound(rate > p.cfg.MaxFeeRate, p.cfg.MaxFeeRate, "capped at spending policy max.")
+	}
+	// the daemon rejects rates below the min. service rate (even if
+	// that exceeds a cap)
+	minRate := m.samples[len(m.samples)-1].MinRate
+	bound(minRate > 0 && rate < minRate, minRate, "raised to min. service rate")
+	return rate, strings.Join(reason, ", "), nil
+}
+
+// ftoa formats a factor
+func ftoa(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// TxFeeRate returns the fee rate for a transaction of given urgency in
+// the format expected by SendBtc and SendBsq.
+func (m *FeeManager) TxFeeRate(u FeeUrgency) (string, error) {
+	rate, _, err := m.Rate(u, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(rate, 10), nil
+}
+
+// decide the new preference for the routine urgency (unlocked). Returns
+// nil if the current preference is kept.
+func (m *FeeManager) decide(now time.Time) (*FeeChange, error) {
+	rate, reason, err := m.rate(FeeRoutine, now)
+	if err != nil {
+		return nil, err
+	}
+	last := m.samples[len(m.samples)-1]
+	ch := &FeeChange{
+		Time:   now.UTC(),
+		Old:    last.Custom,
+		New:    rate,
+		Reason: reason,
+	}
+	// the daemon uses the fee service rate if no preference is set
+	if within(rate, last.ServiceRate, m.policy.Tolerance) {
+		ch.New = 0
+		ch.Reason += fmt.Sprintf(": service rate %d used", last.ServiceRate)
+	}
+	switch {
+	case ch.Old == ch.New:
+		return nil, nil
+	case ch.Old != 0 && ch.New != 0 && within(ch.New, ch.Old, m.policy.Tolerance):
+		return nil, nil
+	}
+	return ch, nil
+}
+
+// within returns true if a is within the relative tolerance of b
+func within(a, b uint64, tol float64) bool {
+	if b == 0 {
+		return a == 0
+	}
+	return math.Abs(float64(a)-float64(b)) <= tol*float64(b)
+}
+
+// Apply samples the fee rates and sets (or unsets) the fee rate
+// preference of the wallet for routine transactions. Returns the recorded
+// change or nil if the preference is kept. The preference is changed
+// without holding the lock, so rates can be queried in the meantime.
+func (m *FeeManager) Apply(ctx context.Context) (*FeeChange, error) {
+	m.apply.Lock()
+	defer m.apply.Unlock()
+	if _, err := m.Sample(ctx); err != nil {
+		return nil, err
+	}
+	m.mtx.Lock()
+	ch, err := m.decide(time.Now())
+	m.mtx.Unlock()
+	if ch == nil || err != nil {
+		return nil, err
+	}
+	if ch.New == 0 {
+		_, err = m.client.UnsetTxFeeRatePreference(ctx)
+	} else {
+		_, err = m.client.SetTxFeeRatePreference(ctx, ch.New)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.samples[len(m.samples)-1].Custom = ch.New
+	return ch, m.record(ch)
+}
+
+// record a change
+func (m *FeeManager) record(ch *FeeChange) error {
+	m.changes = append(m.changes, ch)
+	if len(m.path) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(ch)
+}
+
+// Run applies the fee policy in given intervals until the context is
+// cancelled. Changes and errors are passed to the callbacks (if defined).
+func (m *FeeManager) Run(ctx context.Context, interval time.Duration, cb func(*FeeChange), errCb func(error)) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		ch, err := m.Apply(ctx)
+		if err != nil && errCb != nil {
+			errCb(err)
+		} else if ch != nil && cb != nil {
+			cb(ch)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
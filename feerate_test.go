@@ -0,0 +1,205 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFeeWindow(t *testing.T) {
+	night, err := ParseFeeWindow("22:00-06:00", 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day, err := ParseFeeWindow("09:30-17:00", 1.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(h, m int) time.Time {
+		return time.Date(2024, 3, 1, h, m, 0, 0, time.Local)
+	}
+	for _, tc := range []struct {
+		w   *FeeWindow
+		t   time.Time
+		res bool
+	}{
+		{night, at(23, 0), true},
+		{night, at(3, 0), true},
+		{night, at(6, 0), false},
+		{night, at(12, 0), false},
+		{day, at(9, 30), true},
+		{day, at(9, 29), false},
+		{day, at(17, 0), false},
+	} {
+		if tc.w.Contains(tc.t) != tc.res {
+			t.Fatalf("window %s at %s: expected %v", tc.w, tc.t.Format("15:04"), tc.res)
+		}
+	}
+	for _, s := range []string{"22:00", "25:00-06:00", "22:00-6"} {
+		if _, err = ParseFeeWindow(s, 1); !errors.Is(err, ErrFeeWindow) {
+			t.Fatalf("invalid window '%s' accepted", s)
+		}
+	}
+	// policy in JSON
+	data := []byte(`{"maxRate":50,"factors":{"routine":0.5,"urgent":2},
+		"schedule":[{"window":"22:00-06:00","factor":0.5}]}`)
+	p := new(FeePolicy)
+	if err = json.Unmarshal(data, p); err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxRate != 50 || p.Factors[FeeRoutine] != 0.5 || p.Factors[FeeUrgent] != 2 || p.Schedule[0].String() != "22:00-06:00" {
+		t.Fatalf("wrong policy: %v", p)
+	}
+	if _, err = ParseFeeUrgency("asap"); !errors.Is(err, ErrFeeUrgency) {
+		t.Fatal("unknown urgency accepted")
+	}
+}
+
+func TestFeeRate(t *testing.T) {
+	policy := &FeePolicy{
+		MinRate:   5,
+		MaxRate:   40,
+		Schedule:  []*FeeWindow{{From: 22 * time.Hour, To: 6 * time.Hour, Factor: 0.5}},
+		Samples:   3,
+		Tolerance: 0.1,
+	}
+	m, err := NewFeeManager(NewClient("localhost:9998", "", time.Second), policy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noon := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	night := time.Date(2024, 3, 1, 23, 0, 0, 0, time.Local)
+	if _, _, err = m.Rate(FeeNormal, noon); !errors.Is(err, ErrFeeNoRate) {
+		t.Fatal("rate without samples")
+	}
+	// median of last three samples is 20 (spike of 100 ignored)
+	for _, r := range []uint64{1, 20, 100, 18} {
+		m.add(&TxFeeRateInfo{FeeServiceRate: r, MinFeeServiceRate: 2}, noon)
+	}
+	if len(m.Samples()) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(m.Samples()))
+	}
+	for _, tc := range []struct {
+		u    FeeUrgency
+		t    time.Time
+		rate uint64
+	}{
+		{FeeNormal, noon, 20},
+		{FeeRoutine, noon, 16},
+		{FeeUrgent, noon, 30},
+		{FeeRoutine, night, 8},
+		{FeeUrgent, night, 15},
+	} {
+		rate, reason, err := m.Rate(tc.u, tc.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate != tc.rate {
+			t.Fatalf("%s at %s: expected %d, got %d (%s)", tc.u, tc.t.Format("15:04"), tc.rate, rate, reason)
+		}
+	}
+	// bounds
+	m.add(&TxFeeRateInfo{FeeServiceRate: 100}, noon)
+	m.add(&TxFeeRateInfo{FeeServiceRate: 100}, noon)
+	if rate, reason, _ := m.Rate(FeeUrgent, noon); rate != 40 {
+		t.Fatalf("rate not capped: %d (%s)", rate, reason)
+	}
+	for i := 0; i < 3; i++ {
+		m.add(&TxFeeRateInfo{FeeServiceRate: 4, MinFeeServiceRate: 2}, noon)
+	}
+	if rate, reason, _ := m.Rate(FeeRoutine, night); rate != 5 {
+		t.Fatalf("rate not raised: %d (%s)", rate, reason)
+	}
+	// min. service rate is applied after the caps
+	for i := 0; i < 3; i++ {
+		m.add(&TxFeeRateInfo{FeeServiceRate: 100, MinFeeServiceRate: 50}, noon)
+	}
+	if rate, reason, _ := m.Rate(FeeUrgent, noon); rate != 50 {
+		t.Fatalf("rate below min. service rate: %d (%s)", rate, reason)
+	}
+	// preference: small changes are ignored
+	for i := 0; i < 3; i++ {
+		m.add(&TxFeeRateInfo{FeeServiceRate: 20, UseCustomTxFeeRate: true, CustomTxFeeRate: 15}, noon)
+	}
+	if ch, _ := m.decide(noon); ch != nil {
+		t.Fatalf("unexpected change: %v", ch)
+	}
+	if ch, _ := m.decide(night); ch == nil || ch.Old != 15 || ch.New != 8 {
+		t.Fatalf("unexpected change: %v", ch)
+	}
+}
+
+func TestFeeManager(t *testing.T) {
+	needDaemon(t)
+	ctx := context.Background()
+	defer testClient.UnsetTxFeeRatePreference(ctx)
+
+	journal := filepath.Join(t.TempDir(), "fee.journal")
+	policy := &FeePolicy{Samples: 3, Tolerance: 0.1}
+	m, err := NewFeeManager(testClient, policy, journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = testClient.UnsetTxFeeRatePreference(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// routine rate is 80% of the fee service rate
+	ch, err := m.Apply(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch == nil || ch.Old != 0 || ch.New == 0 || len(ch.Reason) == 0 {
+		t.Fatalf("unexpected change: %v", ch)
+	}
+	info, err := testClient.GetTxFeeRate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.UseCustomTxFeeRate || info.CustomTxFeeRate != ch.New {
+		t.Fatalf("preference not set: %v", info)
+	}
+	if ch, err = m.Apply(ctx); ch != nil || err != nil {
+		t.Fatalf("unexpected change: %v (%v)", ch, err)
+	}
+	// service rate for routine transactions: preference is unset
+	policy.Factors = map[FeeUrgency]float64{FeeRoutine: 1}
+	if ch, err = m.Apply(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ch == nil || ch.New != 0 {
+		t.Fatalf("unexpected change: %v", ch)
+	}
+	if info, err = testClient.GetTxFeeRate(ctx); err != nil || info.UseCustomTxFeeRate {
+		t.Fatalf("preference not unset: %v (%v)", info, err)
+	}
+	// changes are journaled
+	if m, err = NewFeeManager(testClient, policy, journal); err != nil {
+		t.Fatal(err)
+	}
+	if list := m.Changes(); len(list) != 2 || list[1].Old == 0 {
+		t.Fatalf("unexpected journal: %v", list)
+	}
+}
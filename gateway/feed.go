@@ -0,0 +1,540 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Error codes
+var (
+	ErrFeedTopic = fmt.Errorf("Invalid topic")
+)
+
+// Event types
+const (
+	EventSnapshot = "snapshot" // last known state on subscription
+	EventUpdate   = "update"   // state has changed
+	EventError    = "error"    // polling for topic failed
+)
+
+// Topics (and topic prefixes) of the event feed:
+//
+//	trade:{id}            changes of a trade
+//	trades                changes of all trades
+//	market:{curr}:{dir}   offer book for currency and direction
+//	price:{curr}          market price of currency
+//	wallet                wallet balances
+const (
+	TopicTrade  = "trade:"
+	TopicTrades = "trades"
+	TopicMarket = "market:"
+	TopicPrice  = "price:"
+	TopicWallet = "wallet"
+)
+
+// size of event queue for subscribers
+const feedQueueSize = 64
+
+// Event is a message pushed to subscribers
+type Event struct {
+	Topic string          `json:"topic"`           // event topic
+	Type  string          `json:"type"`            // event type
+	Time  int64           `json:"time"`            // timestamp (ms since epoch)
+	Data  json.RawMessage `json:"data,omitempty"`  // state (protojson)
+	Error string          `json:"error,omitempty"` // error message
+}
+
+// CheckTopic returns an error if a topic is invalid.
+func CheckTopic(topic string) error {
+	switch {
+	case topic == TopicTrades || topic == TopicWallet:
+		return nil
+	case strings.HasPrefix(topic, TopicTrade):
+		if len(topic) > len(TopicTrade) {
+			return nil
+		}
+	case strings.HasPrefix(topic, TopicPrice):
+		if len(topic) > len(TopicPrice) {
+			return nil
+		}
+	case strings.HasPrefix(topic, TopicMarket):
+		parts := strings.Split(topic, ":")
+		if len(parts) == 3 && len(parts[1]) > 0 {
+			if dir := strings.ToLower(parts[2]); dir == "buy" || dir == "sell" {
+				return nil
+			}
+		}
+	}
+	return ErrFeedTopic
+}
+
+// subscriber to the event feed
+type subscriber struct {
+	topics map[string]bool // subscribed topics
+	ch     chan *Event     // event queue
+}
+
+// matches returns true if the subscriber receives events for a topic
+func (s *subscriber) matches(topic string) bool {
+	for t := range s.topics {
+		if matchTopic(t, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTopic returns true if events for a topic are delivered to
+// subscribers of a topic ("trades" includes all "trade:{id}" topics).
+func matchTopic(sub, topic string) bool {
+	if sub == topic {
+		return true
+	}
+	return sub == TopicTrades && strings.HasPrefix(topic, TopicTrade)
+}
+
+// Feed polls the daemon for trades, offers, prices and balances and
+// pushes changes to subscribers. Only topics with subscribers are polled.
+type Feed struct {
+	client   *bisquit.Client          // client for API calls
+	interval time.Duration            // polling interval
+	subs     map[*subscriber]bool     // active subscribers
+	state    map[string]proto.Message // last known state per topic
+	errs     map[string]string        // last error per topic
+	trigger  chan struct{}            // request for immediate poll
+	mtx      sync.Mutex               // serialize access
+}
+
+// NewFeed creates a new event feed polling the daemon in given intervals.
+func NewFeed(c *bisquit.Client, interval time.Duration) *Feed {
+	return &Feed{
+		client:   c,
+		interval: interval,
+		subs:     make(map[*subscriber]bool),
+		state:    make(map[string]proto.Message),
+		errs:     make(map[string]string),
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Subscribe to a list of topics. Events are delivered on the returned
+// channel until the cancel function is called; the channel is closed if
+// the subscriber doesn't keep up with the events.
+func (f *Feed) Subscribe(topics ...string) (<-chan *Event, func(), error) {
+	for _, t := range topics {
+		if err := CheckTopic(t); err != nil {
+			return nil, nil, fmt.Errorf("%w '%s'", err, t)
+		}
+	}
+	s := f.add()
+	f.update(s, topics, nil)
+	return s.ch, func() { f.remove(s) }, nil
+}
+
+// add a new subscriber
+func (f *Feed) add() *subscriber {
+	s := &subscriber{
+		topics: make(map[string]bool),
+		ch:     make(chan *Event, feedQueueSize),
+	}
+	f.mtx.Lock()
+	f.subs[s] = true
+	f.mtx.Unlock()
+	return s
+}
+
+// remove a subscriber and close its event queue
+func (f *Feed) remove(s *subscriber) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.drop(s)
+}
+
+// drop a subscriber (locked)
+func (f *Feed) drop(s *subscriber) {
+	if f.subs[s] {
+		delete(f.subs, s)
+		close(s.ch)
+		f.prune()
+	}
+}
+
+// kept returns true if the state of a topic is kept (locked): states of
+// trades are kept while the trade is open (to report its final state),
+// other states as long as the topic has subscribers.
+func (f *Feed) kept(topic string) bool {
+	if strings.HasPrefix(topic, TopicTrade) {
+		return true
+	}
+	for s := range f.subs {
+		if s.matches(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// prune states and errors of topics without subscribers (locked)
+func (f *Feed) prune() {
+	for topic := range f.state {
+		if !f.kept(topic) {
+			delete(f.state, topic)
+		}
+	}
+	for topic := range f.errs {
+		if !f.kept(topic) {
+			delete(f.errs, topic)
+		}
+	}
+}
+
+// update the topics of a subscriber; snapshots of added topics are queued.
+func (f *Feed) update(s *subscriber, add, remove []string) error {
+	for _, t := range add {
+		if err := CheckTopic(t); err != nil {
+			return fmt.Errorf("%w '%s'", err, t)
+		}
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for _, t := range remove {
+		delete(s.topics, t)
+	}
+	if len(remove) > 0 {
+		f.prune()
+	}
+	var added []string
+	for _, t := range add {
+		if !s.topics[t] {
+			s.topics[t] = true
+			added = append(added, t)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	// queue snapshots of known states
+	for topic, msg := range f.state {
+		for _, t := range added {
+			if matchTopic(t, topic) {
+				f.send(s, newEvent(topic, EventSnapshot, msg))
+				break
+			}
+		}
+	}
+	// poll new topics soon
+	select {
+	case f.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// send an event to a subscriber (locked); slow subscribers are dropped.
+func (f *Feed) send(s *subscriber, ev *Event) {
+	if !f.subs[s] {
+		return
+	}
+	select {
+	case s.ch <- ev:
+	default:
+		f.drop(s)
+	}
+}
+
+// newEvent creates an event for a state message
+func newEvent(topic, typ string, msg proto.Message) *Event {
+	ev := &Event{
+		Topic: topic,
+		Type:  typ,
+		Time:  time.Now().UnixMilli(),
+	}
+	if data, err := protojson.Marshal(msg); err == nil {
+		ev.Data = data
+	}
+	return ev
+}
+
+// publish a state for a topic if it has changed
+func (f *Feed) publish(topic string, msg proto.Message) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	delete(f.errs, topic)
+	if !f.kept(topic) {
+		// unsubscribed while polling
+		delete(f.state, topic)
+		return
+	}
+	if old, ok := f.state[topic]; ok && proto.Equal(old, msg) {
+		return
+	}
+	f.state[topic] = msg
+	ev := newEvent(topic, EventUpdate, msg)
+	for s := range f.subs {
+		if s.matches(topic) {
+			f.send(s, ev)
+		}
+	}
+}
+
+// failed publishes a polling error for a topic (once per error message)
+func (f *Feed) failed(topic string, err error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	msg := err.Error()
+	if f.errs[topic] == msg || !f.kept(topic) {
+		return
+	}
+	f.errs[topic] = msg
+	ev := &Event{
+		Topic: topic,
+		Type:  EventError,
+		Time:  time.Now().UnixMilli(),
+		Error: msg,
+	}
+	for s := range f.subs {
+		if s.matches(topic) {
+			f.send(s, ev)
+		}
+	}
+}
+
+// topics returns the list of subscribed topics and flags if trades and
+// wallet are to be polled.
+func (f *Feed) topics() (list []string, trades, wallet bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	seen := make(map[string]bool)
+	for s := range f.subs {
+		for t := range s.topics {
+			switch {
+			case t == TopicTrades || strings.HasPrefix(t, TopicTrade):
+				trades = true
+			case t == TopicWallet:
+				wallet = true
+			case !seen[t]:
+				seen[t] = true
+				list = append(list, t)
+			}
+		}
+	}
+	return
+}
+
+// Poll the daemon once for all subscribed topics.
+func (f *Feed) Poll(ctx context.Context) {
+	list, trades, wallet := f.topics()
+	if trades {
+		f.pollTrades(ctx)
+	}
+	if wallet {
+		bal, err := f.client.GetBalances(ctx, "")
+		if err != nil {
+			f.failed(TopicWallet, err)
+		} else {
+			f.publish(TopicWallet, bal)
+		}
+	}
+	for _, t := range list {
+		var (
+			msg proto.Message
+			err error
+		)
+		parts := strings.Split(t, ":")
+		if strings.HasPrefix(t, TopicPrice) {
+			var price float64
+			price, err = f.client.GetMarketPrice(ctx, strings.ToUpper(parts[1]))
+			msg = &bisquit.MarketPriceReply{Price: price}
+		} else {
+			var offers []*bisquit.OfferInfo
+			offers, err = f.client.GetOffers(ctx, strings.ToUpper(parts[2]), strings.ToUpper(parts[1]))
+			msg = &bisquit.GetOffersReply{Offers: offers}
+		}
+		if err != nil {
+			f.failed(t, err)
+			continue
+		}
+		f.publish(t, msg)
+	}
+}
+
+// pollTrades publishes changes of open trades; trades that are no longer
+// open are published with their final state and then forgotten.
+func (f *Feed) pollTrades(ctx context.Context) {
+	trades, err := f.client.GetTrades(ctx, int(bisquit.GetTradesRequest_OPEN))
+	if err != nil {
+		f.failed(TopicTrades, err)
+		return
+	}
+	open := make(map[string]bool)
+	for _, t := range trades {
+		open[TopicTrade+t.TradeId] = true
+		f.publish(TopicTrade+t.TradeId, t)
+	}
+	// find trades that have been closed
+	var gone []string
+	f.mtx.Lock()
+	for topic := range f.state {
+		if strings.HasPrefix(topic, TopicTrade) && !open[topic] {
+			gone = append(gone, topic)
+		}
+	}
+	f.mtx.Unlock()
+	for _, topic := range gone {
+		t, err := f.client.GetTrade(ctx, strings.TrimPrefix(topic, TopicTrade))
+		if err != nil {
+			f.failed(topic, err)
+			continue
+		}
+		f.publish(topic, t)
+		f.mtx.Lock()
+		delete(f.state, topic)
+		f.mtx.Unlock()
+	}
+}
+
+// Run polls the daemon until the context is cancelled.
+func (f *Feed) Run(ctx context.Context) {
+	tick := time.NewTicker(f.interval)
+	defer tick.Stop()
+	for {
+		f.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		case <-f.trigger:
+		}
+	}
+}
+
+//----------------------------------------------------------------------
+// HTTP endpoints
+//----------------------------------------------------------------------
+
+// ServeSSE streams events for the topics in the query ("?topic=...") as
+// Server-Sent Events.
+func (f *Feed) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("Streaming not supported"))
+		return
+	}
+	events, cancel, err := f.Subscribe(r.URL.Query()["topic"]...)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// Command from a WebSocket client to change subscriptions
+type Command struct {
+	Subscribe   []string `json:"subscribe,omitempty"`   // topics to add
+	Unsubscribe []string `json:"unsubscribe,omitempty"` // topics to remove
+}
+
+// ServeWS streams events as JSON messages over a WebSocket. Initial topics
+// are taken from the query ("?topic=..."); clients can change their
+// subscriptions by sending commands.
+func (f *Feed) ServeWS(w http.ResponseWriter, r *http.Request) {
+	topics := r.URL.Query()["topic"]
+	for _, t := range topics {
+		if err := CheckTopic(t); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%w '%s'", err, t))
+			return
+		}
+	}
+	srv := websocket.Server{
+		// access is controlled by tokens: accept any origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			s := f.add()
+			defer f.remove(s)
+			f.update(s, topics, nil)
+
+			// handle commands from client
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					var cmd Command
+					if err := websocket.JSON.Receive(ws, &cmd); err != nil {
+						return
+					}
+					if err := f.update(s, cmd.Subscribe, cmd.Unsubscribe); err != nil {
+						websocket.JSON.Send(ws, &Event{
+							Type:  EventError,
+							Time:  time.Now().UnixMilli(),
+							Error: err.Error(),
+						})
+					}
+				}
+			}()
+			// send events to client
+			for {
+				select {
+				case <-done:
+					return
+				case ev, ok := <-s.ch:
+					if !ok {
+						return
+					}
+					if err := websocket.JSON.Send(ws, ev); err != nil {
+						return
+					}
+				}
+			}
+		},
+	}
+	srv.ServeHTTP(w, r)
+}
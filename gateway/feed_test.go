@@ -0,0 +1,218 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// next returns the next event from a channel (or fails)
+func next(t *testing.T, ch <-chan *Event) *Event {
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return nil
+}
+
+// none checks that no event is pending
+func none(t *testing.T, ch <-chan *Event) {
+	select {
+	case ev := <-ch:
+		t.Fatalf("unexpected event: %v", ev)
+	default:
+	}
+}
+
+func TestCheckTopic(t *testing.T) {
+	for _, topic := range []string{"trade:123", "trades", "market:EUR:buy", "market:USD:SELL", "price:EUR", "wallet"} {
+		if err := CheckTopic(topic); err != nil {
+			t.Errorf("%s: %s", topic, err.Error())
+		}
+	}
+	for _, topic := range []string{"trade:", "market:EUR", "market::buy", "market:EUR:hold", "price:", "offers"} {
+		if err := CheckTopic(topic); err == nil {
+			t.Errorf("%s: accepted", topic)
+		}
+	}
+}
+
+func TestFeed(t *testing.T) {
+	f := NewFeed(bisquit.NewClient("localhost:9998", "secret", time.Second), time.Minute)
+	if _, _, err := f.Subscribe("wallet", "invalid"); err == nil {
+		t.Fatal("invalid topic accepted")
+	}
+	all, cancelAll, err := f.Subscribe("trades")
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, cancelOne, err := f.Subscribe("trade:2", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancelOne()
+
+	// updates are only published on change
+	f.publish("trade:1", &bisquit.TradeInfo{TradeId: "1", Phase: "INIT"})
+	f.publish("trade:1", &bisquit.TradeInfo{TradeId: "1", Phase: "INIT"})
+	f.publish("trade:2", &bisquit.TradeInfo{TradeId: "2", Phase: "INIT"})
+	if ev := next(t, all); ev.Topic != "trade:1" || ev.Type != EventUpdate {
+		t.Fatalf("wrong event: %v", ev)
+	}
+	if ev := next(t, all); ev.Topic != "trade:2" {
+		t.Fatalf("wrong event: %v", ev)
+	}
+	none(t, all)
+	ev := next(t, one)
+	var trade bisquit.TradeInfo
+	if err = protojson.Unmarshal(ev.Data, &trade); err != nil || trade.TradeId != "2" {
+		t.Fatalf("wrong data: %s", string(ev.Data))
+	}
+	none(t, one)
+
+	// new subscribers get snapshots
+	snap, cancelSnap, _ := f.Subscribe("trade:1")
+	if ev := next(t, snap); ev.Type != EventSnapshot || ev.Topic != "trade:1" {
+		t.Fatalf("wrong event: %v", ev)
+	}
+	cancelSnap()
+
+	// polling errors are reported once
+	f.Poll(context.Background())
+	f.Poll(context.Background())
+	if ev := next(t, one); ev.Type != EventError || ev.Topic != TopicWallet {
+		t.Fatalf("wrong event: %v", ev)
+	}
+	none(t, one)
+	if ev := next(t, all); ev.Type != EventError || ev.Topic != TopicTrades {
+		t.Fatalf("wrong event: %v", ev)
+	}
+
+	// slow subscribers are dropped
+	for i := 0; i <= feedQueueSize; i++ {
+		f.publish(fmt.Sprintf("trade:x%d", i), &bisquit.TradeInfo{})
+	}
+	for range all {
+	}
+	cancelAll()
+
+	// states of topics without subscribers are removed
+	price, cancelPrice, _ := f.Subscribe("price:EUR", "market:EUR:buy")
+	f.publish("price:EUR", &bisquit.MarketPriceReply{Price: 30000})
+	f.publish("market:EUR:buy", &bisquit.GetOffersReply{})
+	f.failed("market:EUR:buy", fmt.Errorf("failed"))
+	next(t, price)
+	next(t, price)
+	next(t, price)
+	cancelPrice()
+	f.publish("price:EUR", &bisquit.MarketPriceReply{Price: 31000})
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for _, topic := range []string{"price:EUR", "market:EUR:buy"} {
+		if _, ok := f.state[topic]; ok {
+			t.Fatalf("state of %s not removed", topic)
+		}
+		if _, ok := f.errs[topic]; ok {
+			t.Fatalf("error of %s not removed", topic)
+		}
+	}
+	if _, ok := f.state["trade:2"]; !ok {
+		t.Fatal("state of open trade removed")
+	}
+}
+
+func TestFeedHTTP(t *testing.T) {
+	f := NewFeed(bisquit.NewClient("localhost:9998", "secret", time.Second), time.Minute)
+	g := New(nil, []string{"token1"})
+	g.SetFeed(f)
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	// server-sent events
+	resp, err := http.Get(srv.URL + "/events?topic=price:EUR&token=token2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	resp, err = http.Get(srv.URL + "/events?topic=price:EUR&token=token1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %s", ct)
+	}
+	f.publish("price:EUR", &bisquit.MarketPriceReply{Price: 30000})
+	rdr := bufio.NewReader(resp.Body)
+	line, _ := rdr.ReadString('\n')
+	if line != "event: update\n" {
+		t.Fatalf("wrong line: %q", line)
+	}
+	line, _ = rdr.ReadString('\n')
+	if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, `"price":30000`) {
+		t.Fatalf("wrong line: %q", line)
+	}
+
+	// websocket
+	cfg, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/events/ws?topic=wallet", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Header.Set("Authorization", "Bearer token1")
+	ws, err := websocket.DialConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err = websocket.JSON.Send(ws, &Command{Subscribe: []string{"market:EUR:buy"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = websocket.JSON.Send(ws, &Command{Subscribe: []string{"market:EUR"}}); err != nil {
+		t.Fatal(err)
+	}
+	var ev Event
+	if err = websocket.JSON.Receive(ws, &ev); err != nil || ev.Type != EventError {
+		t.Fatalf("wrong event: %v (%v)", ev, err)
+	}
+	f.publish("market:EUR:buy", &bisquit.GetOffersReply{Offers: []*bisquit.OfferInfo{{Id: "o1"}}})
+	if err = websocket.JSON.Receive(ws, &ev); err != nil || ev.Topic != "market:EUR:buy" {
+		t.Fatalf("wrong event: %v (%v)", ev, err)
+	}
+}
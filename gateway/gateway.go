@@ -0,0 +1,299 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+// Package gateway exposes the operations of a Bisq client as REST/JSON
+// endpoints. Request and response bodies are Protobuf messages encoded
+// with protojson; access is protected by bearer tokens that are separate
+// from the daemon API password.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Error codes
+var (
+	ErrGatewayAuth     = fmt.Errorf("Missing or invalid access token")
+	ErrGatewayNotFound = fmt.Errorf("No such endpoint")
+	ErrGatewayMethod   = fmt.Errorf("Method not allowed")
+)
+
+// max. size of request bodies
+const maxBodySize = 1 << 20
+
+// request is a decoded HTTP request passed to a route handler
+type request struct {
+	params map[string]string // path parameters
+	query  url.Values        // query parameters
+	body   proto.Message     // decoded request body (or nil)
+}
+
+// route defines a REST endpoint
+type route struct {
+	method  string        // HTTP method
+	path    string        // path pattern (with {param} placeholders)
+	summary string        // short description
+	query   []string      // names of query parameters
+	body    proto.Message // request body type (or nil)
+	reply   proto.Message // response body type
+	handle  func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error)
+}
+
+// match a request path against the route pattern
+func (rt *route) match(path string) (map[string]string, bool) {
+	pat := strings.Split(strings.Trim(rt.path, "/"), "/")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(pat) != len(parts) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, p := range pat {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			val, err := url.PathUnescape(parts[i])
+			if err != nil || len(val) == 0 {
+				return nil, false
+			}
+			params[p[1:len(p)-1]] = val
+		} else if p != parts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// Gateway is a HTTP handler for the REST endpoints.
+type Gateway struct {
+	client *bisquit.Client // client for API calls
+	tokens [][]byte        // valid access tokens
+	routes []*route        // list of endpoints
+	feed   *Feed           // event feed (optional)
+}
+
+// New creates a new gateway for a connected client. Requests must carry
+// one of the access tokens as "Authorization: Bearer <token>".
+func New(c *bisquit.Client, tokens []string) *Gateway {
+	g := &Gateway{
+		client: c,
+		routes: routes,
+	}
+	for _, t := range tokens {
+		if len(t) > 0 {
+			g.tokens = append(g.tokens, []byte(t))
+		}
+	}
+	return g
+}
+
+// SetFeed enables the event endpoints "/events" (Server-Sent Events) and
+// "/events/ws" (WebSocket) for a feed.
+func (g *Gateway) SetFeed(f *Feed) {
+	g.feed = f
+}
+
+// authorized checks the access token of a request. Browsers can't set
+// headers for event streams (and calendar clients can't set them for
+// subscriptions), so the token can be passed as query parameter "token"
+// for event endpoints and the deadline calendar.
+func (g *Gateway) authorized(r *http.Request) bool {
+	var token []byte
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = []byte(strings.TrimPrefix(auth, "Bearer "))
+	} else if strings.HasPrefix(r.URL.Path, "/events") || r.URL.Path == "/deadlines.ics" {
+		token = []byte(r.URL.Query().Get("token"))
+	}
+	if len(token) == 0 {
+		return false
+	}
+	ok := false
+	for _, t := range g.tokens {
+		if subtle.ConstantTimeCompare(t, token) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// ServeHTTP handles REST requests
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the API description is public
+	if r.URL.Path == "/openapi.json" && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(g.OpenAPI())
+		return
+	}
+	if !g.authorized(r) {
+		writeError(w, http.StatusUnauthorized, ErrGatewayAuth)
+		return
+	}
+	// event feed
+	if g.feed != nil && r.Method == http.MethodGet {
+		switch r.URL.Path {
+		case "/events":
+			g.feed.ServeSSE(w, r)
+			return
+		case "/events/ws":
+			g.feed.ServeWS(w, r)
+			return
+		}
+	}
+	// deadline calendar
+	if r.URL.Path == "/deadlines.ics" && r.Method == http.MethodGet {
+		g.serveDeadlines(w, r)
+		return
+	}
+	// find route
+	var (
+		rt     *route
+		params map[string]string
+		found  bool
+	)
+	for _, e := range g.routes {
+		if p, ok := e.match(r.URL.Path); ok {
+			found = true
+			if e.method == r.Method {
+				rt, params = e, p
+				break
+			}
+		}
+	}
+	if rt == nil {
+		if found {
+			writeError(w, http.StatusMethodNotAllowed, ErrGatewayMethod)
+		} else {
+			writeError(w, http.StatusNotFound, ErrGatewayNotFound)
+		}
+		return
+	}
+	// decode request
+	req := &request{
+		params: params,
+		query:  r.URL.Query(),
+	}
+	if rt.body != nil {
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		req.body = rt.body.ProtoReflect().New().Interface()
+		if err = protojson.Unmarshal(data, req.body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	// handle request
+	resp, err := rt.handle(r.Context(), g.client, req)
+	if err != nil {
+		writeError(w, httpStatus(err), err)
+		return
+	}
+	data, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(resp)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// serveDeadlines sends the deadlines of open trades as iCalendar feed.
+// Trades without deadlines are left out of the calendar.
+func (g *Gateway) serveDeadlines(w http.ResponseWriter, r *http.Request) {
+	s, err := bisquit.NewDeadlineService(g.client, "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	list, err := s.Deadlines(r.Context())
+	if _, ok := err.(bisquit.TradeErrors); err != nil && !ok {
+		writeError(w, httpStatus(err), err)
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err = bisquit.WriteDeadlinesICal(buf, list, bisquit.DefaultDeadlineLeads, time.Now()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// httpStatus maps an error to a HTTP status code
+func httpStatus(err error) int {
+	var pv *bisquit.PolicyViolationError
+	if errors.As(err, &pv) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, ErrGatewayCategory) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, bisquit.ErrClientNotConnected) {
+		return http.StatusServiceUnavailable
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.InvalidArgument, codes.OutOfRange:
+			return http.StatusBadRequest
+		case codes.NotFound:
+			return http.StatusNotFound
+		case codes.AlreadyExists, codes.FailedPrecondition:
+			return http.StatusConflict
+		case codes.PermissionDenied:
+			return http.StatusForbidden
+		case codes.Unimplemented:
+			return http.StatusNotImplemented
+		case codes.Unavailable:
+			return http.StatusServiceUnavailable
+		case codes.DeadlineExceeded:
+			return http.StatusGatewayTimeout
+		case codes.Unknown:
+			// error messages from the daemon without status
+			return http.StatusBadGateway
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError sends an error response
+func writeError(w http.ResponseWriter, code int, err error) {
+	msg := err.Error()
+	if s, ok := status.FromError(err); ok {
+		msg = s.Message()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
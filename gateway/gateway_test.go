@@ -0,0 +1,151 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRouteMatch(t *testing.T) {
+	rt := &route{path: "/trades/{id}/payment-started"}
+	params, ok := rt.match("/trades/abc%2Fd/payment-started")
+	if !ok || params["id"] != "abc/d" {
+		t.Fatalf("match failed: %v", params)
+	}
+	for _, p := range []string{"/trades/abc", "/trades//payment-started", "/trades/abc/close"} {
+		if _, ok := rt.match(p); ok {
+			t.Fatalf("unexpected match: %s", p)
+		}
+	}
+}
+
+func TestGateway(t *testing.T) {
+	// the client is not connected: calls fail with ErrClientNotConnected
+	c := bisquit.NewClient("localhost:9998", "secret", time.Second)
+	srv := httptest.NewServer(New(c, []string{"token1", ""}))
+	defer srv.Close()
+
+	do := func(method, path, token, body string) int {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var res map[string]string
+		if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res["error"]) == 0 {
+			t.Fatalf("%s %s: no error message", method, path)
+		}
+		return resp.StatusCode
+	}
+	for _, tc := range []struct {
+		method, path, token, body string
+		code                      int
+	}{
+		{"GET", "/offers", "", "", http.StatusUnauthorized},
+		{"GET", "/offers", "token2", "", http.StatusUnauthorized},
+		{"GET", "/unknown", "token1", "", http.StatusNotFound},
+		{"PUT", "/offers", "token1", "", http.StatusMethodNotAllowed},
+		{"POST", "/offers", "token1", "{invalid", http.StatusBadRequest},
+		{"GET", "/trades?category=unknown", "token1", "", http.StatusBadRequest},
+		{"GET", "/offers?direction=BUY&currency=EUR", "token1", "", http.StatusServiceUnavailable},
+		{"POST", "/trades/123/payment-started", "token1", "", http.StatusServiceUnavailable},
+		{"POST", "/wallet/send-btc", "token1", `{"address":"bc1q","amount":"0.1"}`, http.StatusServiceUnavailable},
+		{"GET", "/deadlines.ics", "", "", http.StatusUnauthorized},
+		{"GET", "/deadlines.ics?token=token1", "", "", http.StatusServiceUnavailable},
+	} {
+		if code := do(tc.method, tc.path, tc.token, tc.body); code != tc.code {
+			t.Errorf("%s %s: got %d, expected %d", tc.method, tc.path, code, tc.code)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv := httptest.NewServer(New(nil, nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var doc struct {
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, rt := range routes {
+		op, ok := doc.Paths[rt.path][strings.ToLower(rt.method)]
+		if !ok {
+			t.Fatalf("missing operation %s %s", rt.method, rt.path)
+		}
+		if op["operationId"] != operationID(rt) {
+			t.Fatalf("wrong operation id: %v", op["operationId"])
+		}
+	}
+	for _, name := range []string{"OfferInfo", "TradeInfo", "CreateOfferRequest", "BalancesInfo", "Error"} {
+		if doc.Components.Schemas[name] == nil {
+			t.Fatalf("missing schema %s", name)
+		}
+	}
+	if id := operationID(&route{method: "POST", path: "/trades/{id}/payment-started"}); id != "postTradesIdPaymentStarted" {
+		t.Fatalf("operation id: %s", id)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{bisquit.ErrClientNotConnected, http.StatusServiceUnavailable},
+		{&bisquit.PolicyViolationError{Rule: bisquit.RuleMaxDaily}, http.StatusForbidden},
+		{status.Error(codes.NotFound, "no offer"), http.StatusNotFound},
+		{status.Error(codes.InvalidArgument, "bad"), http.StatusBadRequest},
+		{status.Error(codes.Unknown, "daemon"), http.StatusBadGateway},
+	} {
+		if code := httpStatus(tc.err); code != tc.code {
+			t.Errorf("%v: got %d, expected %d", tc.err, code, tc.code)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package gateway
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Version of the gateway API
+const Version = "1.0.0"
+
+// OpenAPI returns the OpenAPI 3.0 description of the gateway endpoints.
+// Schemas of request and response bodies are derived from the Protobuf
+// message descriptors (in protojson encoding).
+func (g *Gateway) OpenAPI() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+	for _, rt := range g.routes {
+		item, ok := paths[rt.path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[rt.path] = item
+		}
+		op := map[string]interface{}{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Success",
+					"content":     jsonContent(schemaRef(rt.reply, schemas)),
+				},
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     jsonContent(map[string]interface{}{"$ref": "#/components/schemas/Error"}),
+				},
+			},
+		}
+		var params []interface{}
+		for _, p := range strings.Split(rt.path, "/") {
+			if strings.HasPrefix(p, "{") {
+				params = append(params, parameter(p[1:len(p)-1], "path", true))
+			}
+		}
+		for _, q := range rt.query {
+			params = append(params, parameter(q, "query", false))
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if rt.body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schemaRef(rt.body, schemas)),
+			}
+		}
+		item[strings.ToLower(rt.method)] = op
+	}
+	if g.feed != nil {
+		topic := map[string]interface{}{
+			"name":        "topic",
+			"in":          "query",
+			"required":    true,
+			"description": "trade:{id}, trades, market:{currency}:{buy|sell}, price:{currency} or wallet",
+			"schema": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+			"explode": true,
+		}
+		event := map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"topic": map[string]interface{}{"type": "string"},
+				"type":  map[string]interface{}{"type": "string", "enum": []string{EventSnapshot, EventUpdate, EventError}},
+				"time":  map[string]interface{}{"type": "integer", "format": "int64"},
+				"data":  map[string]interface{}{"type": "object"},
+				"error": map[string]interface{}{"type": "string"},
+			},
+		}
+		schemas["Event"] = event
+		paths["/events"] = map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Stream events as Server-Sent Events",
+				"operationId": "getEvents",
+				"parameters":  []interface{}{topic},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "Event stream (data is a JSON-encoded Event)",
+						"content": map[string]interface{}{
+							"text/event-stream": map[string]interface{}{
+								"schema": map[string]interface{}{"$ref": "#/components/schemas/Event"},
+							},
+						},
+					},
+				},
+			},
+		}
+		paths["/events/ws"] = map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Stream events over a WebSocket",
+				"operationId": "getEventsWs",
+				"parameters":  []interface{}{topic},
+				"responses": map[string]interface{}{
+					"101": map[string]interface{}{"description": "Switching to WebSocket protocol"},
+				},
+			},
+		}
+	}
+	paths["/deadlines.ics"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "Get trade deadlines of open trades as iCalendar feed",
+			"operationId": "getDeadlinesIcs",
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Calendar with one event per deadline",
+					"content": map[string]interface{}{
+						"text/calendar": map[string]interface{}{
+							"schema": map[string]interface{}{"type": "string"},
+						},
+					},
+				},
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     jsonContent(map[string]interface{}{"$ref": "#/components/schemas/Error"}),
+				},
+			},
+		},
+	}
+	schemas["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{"type": "string"},
+		},
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "bisquit REST gateway",
+			"version": Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{
+					"type":   "http",
+					"scheme": "bearer",
+				},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+		},
+	}
+}
+
+// operationID builds an identifier from method and path of a route
+// (e.g. "postTradesIdPaymentStarted").
+func operationID(rt *route) string {
+	id := strings.ToLower(rt.method)
+	for _, p := range strings.FieldsFunc(rt.path, func(r rune) bool {
+		return strings.ContainsRune("/{}-", r)
+	}) {
+		id += strings.ToUpper(p[:1]) + p[1:]
+	}
+	return id
+}
+
+// parameter returns the description of a string parameter
+func parameter(name, in string, required bool) map[string]interface{} {
+	return map[string]interface{}{
+		"name":     name,
+		"in":       in,
+		"required": required,
+		"schema":   map[string]interface{}{"type": "string"},
+	}
+}
+
+// jsonContent returns a JSON content description for a schema
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// schemaRef returns a reference to the schema of a message; the schema
+// (and the schemas of nested messages) are added to the list.
+func schemaRef(msg proto.Message, schemas map[string]interface{}) map[string]interface{} {
+	return messageRef(msg.ProtoReflect().Descriptor(), schemas)
+}
+
+// messageRef returns a reference to the schema of a message descriptor
+func messageRef(md protoreflect.MessageDescriptor, schemas map[string]interface{}) map[string]interface{} {
+	name := string(md.Name())
+	if _, ok := schemas[name]; !ok {
+		// register name first to terminate recursive definitions
+		schemas[name] = nil
+		props := make(map[string]interface{})
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			props[fd.JSONName()] = fieldSchema(fd, schemas)
+		}
+		schemas[name] = map[string]interface{}{
+			"type":       "object",
+			"properties": props,
+		}
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// fieldSchema returns the schema of a message field
+func fieldSchema(fd protoreflect.FieldDescriptor, schemas map[string]interface{}) map[string]interface{} {
+	if fd.IsMap() {
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": kindSchema(fd.MapValue(), schemas),
+		}
+	}
+	s := kindSchema(fd, schemas)
+	if fd.IsList() {
+		return map[string]interface{}{
+			"type":  "array",
+			"items": s,
+		}
+	}
+	return s
+}
+
+// kindSchema returns the schema for a single value of a field
+func kindSchema(fd protoreflect.FieldDescriptor, schemas map[string]interface{}) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson encodes 64-bit integers as strings
+		return map[string]interface{}{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		vals := fd.Enum().Values()
+		names := make([]string, vals.Len())
+		for i := range names {
+			names[i] = string(vals.Get(i).Name())
+		}
+		sort.Strings(names)
+		return map[string]interface{}{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageRef(fd.Message(), schemas)
+	}
+	return map[string]interface{}{"type": "string"}
+}
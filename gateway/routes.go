@@ -0,0 +1,416 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bfix/bisquit"
+	"google.golang.org/protobuf/proto"
+)
+
+// Error codes
+var (
+	ErrGatewayCategory = fmt.Errorf("Unknown trade category")
+)
+
+// routes lists all REST endpoints of the gateway
+var routes = []*route{
+
+	//------------------------------------------------------------------
+	// Version and prices
+	//------------------------------------------------------------------
+
+	{
+		method: "GET", path: "/version",
+		summary: "Get version of the Bisq daemon",
+		reply:   &bisquit.GetVersionReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			v, err := c.GetVersion(ctx)
+			return &bisquit.GetVersionReply{Version: v}, err
+		},
+	},
+	{
+		method: "GET", path: "/prices/{currency}",
+		summary: "Get market price for a currency",
+		reply:   &bisquit.MarketPriceReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			p, err := c.GetMarketPrice(ctx, r.params["currency"])
+			return &bisquit.MarketPriceReply{Price: p}, err
+		},
+	},
+
+	//------------------------------------------------------------------
+	// Offers
+	//------------------------------------------------------------------
+
+	{
+		method: "GET", path: "/offers",
+		summary: "List available offers",
+		query:   []string{"direction", "currency"},
+		reply:   &bisquit.GetOffersReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			list, err := c.GetOffers(ctx, r.query.Get("direction"), r.query.Get("currency"))
+			return &bisquit.GetOffersReply{Offers: list}, err
+		},
+	},
+	{
+		method: "GET", path: "/offers/mine",
+		summary: "List own offers",
+		query:   []string{"direction", "currency"},
+		reply:   &bisquit.GetMyOffersReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			list, err := c.GetMyOffers(ctx, r.query.Get("direction"), r.query.Get("currency"))
+			return &bisquit.GetMyOffersReply{Offers: list}, err
+		},
+	},
+	{
+		method: "POST", path: "/offers",
+		summary: "Create a new offer",
+		body:    &bisquit.CreateOfferRequest{},
+		reply:   &bisquit.CreateOfferReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			offer, err := c.CreateOffer(ctx, r.body.(*bisquit.CreateOfferRequest))
+			return &bisquit.CreateOfferReply{Offer: offer}, err
+		},
+	},
+	{
+		method: "GET", path: "/offers/{id}",
+		summary: "Get offer with given ID",
+		reply:   &bisquit.GetOfferReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			offer, err := c.GetOffer(ctx, r.params["id"])
+			return &bisquit.GetOfferReply{Offer: offer}, err
+		},
+	},
+	{
+		method: "GET", path: "/offers/{id}/category",
+		summary: "Get category of offer with given ID",
+		reply:   &bisquit.GetOfferCategoryReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			cat, err := c.GetOfferCategory(ctx, r.params["id"])
+			if err != nil {
+				return nil, err
+			}
+			return &bisquit.GetOfferCategoryReply{OfferCategory: *cat}, nil
+		},
+	},
+	{
+		method: "PATCH", path: "/offers/{id}",
+		summary: "Edit own offer with given ID",
+		body:    &bisquit.EditOfferRequest{},
+		reply:   &bisquit.EditOfferReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			req := r.body.(*bisquit.EditOfferRequest)
+			req.Id = r.params["id"]
+			return &bisquit.EditOfferReply{}, c.EditOffer(ctx, req)
+		},
+	},
+	{
+		method: "DELETE", path: "/offers/{id}",
+		summary: "Cancel own offer with given ID",
+		reply:   &bisquit.CancelOfferReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			return &bisquit.CancelOfferReply{}, c.CancelOffer(ctx, r.params["id"])
+		},
+	},
+	{
+		method: "GET", path: "/bsqswap/offers",
+		summary: "List available BSQ swap offers",
+		query:   []string{"direction"},
+		reply:   &bisquit.GetBsqSwapOffersReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			list, err := c.GetBsqSwapOffers(ctx, r.query.Get("direction"), "BSQ")
+			return &bisquit.GetBsqSwapOffersReply{BsqSwapOffers: list}, err
+		},
+	},
+	{
+		method: "POST", path: "/bsqswap/offers",
+		summary: "Create a new BSQ swap offer",
+		body:    &bisquit.CreateBsqSwapOfferRequest{},
+		reply:   &bisquit.CreateBsqSwapOfferReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			offer, err := c.CreateBsqSwapOffer(ctx, r.body.(*bisquit.CreateBsqSwapOfferRequest))
+			return &bisquit.CreateBsqSwapOfferReply{BsqSwapOffer: offer}, err
+		},
+	},
+	{
+		method: "GET", path: "/bsqswap/offers/{id}",
+		summary: "Get BSQ swap offer with given ID",
+		reply:   &bisquit.GetBsqSwapOfferReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			offer, err := c.GetBsqSwapOffer(ctx, r.params["id"])
+			return &bisquit.GetBsqSwapOfferReply{BsqSwapOffer: offer}, err
+		},
+	},
+
+	//------------------------------------------------------------------
+	// Trades
+	//------------------------------------------------------------------
+
+	{
+		method: "GET", path: "/trades",
+		summary: "List trades (category 'open' (default), 'closed' or 'failed')",
+		query:   []string{"category"},
+		reply:   &bisquit.GetTradesReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			cat := "OPEN"
+			if v := r.query.Get("category"); len(v) > 0 {
+				cat = strings.ToUpper(v)
+			}
+			mode, ok := bisquit.GetTradesRequest_Category_value[cat]
+			if !ok {
+				return nil, ErrGatewayCategory
+			}
+			list, err := c.GetTrades(ctx, int(mode))
+			return &bisquit.GetTradesReply{Trades: list}, err
+		},
+	},
+	{
+		method: "POST", path: "/trades",
+		summary: "Take an offer",
+		body:    &bisquit.TakeOfferRequest{},
+		reply:   &bisquit.TakeOfferReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			req := r.body.(*bisquit.TakeOfferRequest)
+			trade, err := c.TakeOffer(ctx, int64(req.Amount), req.OfferId, req.PaymentAccountId, req.TakerFeeCurrencyCode)
+			return &bisquit.TakeOfferReply{Trade: trade}, err
+		},
+	},
+	{
+		method: "GET", path: "/trades/{id}",
+		summary: "Get trade with given ID",
+		reply:   &bisquit.GetTradeReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			trade, err := c.GetTrade(ctx, r.params["id"])
+			return &bisquit.GetTradeReply{Trade: trade}, err
+		},
+	},
+	tradeOp("payment-started", "Confirm that payment has been started", (*bisquit.Client).ConfirmPaymentStarted, &bisquit.ConfirmPaymentStartedReply{}),
+	tradeOp("payment-received", "Confirm that payment has been received", (*bisquit.Client).ConfirmPaymentReceived, &bisquit.ConfirmPaymentReceivedReply{}),
+	tradeOp("close", "Close a completed trade", (*bisquit.Client).CloseTrade, &bisquit.CloseTradeReply{}),
+	tradeOp("fail", "Move an open trade to failed trades", (*bisquit.Client).FailTrade, &bisquit.FailTradeReply{}),
+	tradeOp("unfail", "Move a failed trade back to open trades", (*bisquit.Client).UnFailTrade, &bisquit.UnFailTradeReply{}),
+	{
+		method: "POST", path: "/trades/{id}/withdraw",
+		summary: "Withdraw trade proceeds to an external address",
+		body:    &bisquit.WithdrawFundsRequest{},
+		reply:   &bisquit.WithdrawFundsReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			req := r.body.(*bisquit.WithdrawFundsRequest)
+			return &bisquit.WithdrawFundsReply{}, c.WithdrawFunds(ctx, r.params["id"], req.Address, req.Memo)
+		},
+	},
+
+	//------------------------------------------------------------------
+	// Payment accounts
+	//------------------------------------------------------------------
+
+	{
+		method: "GET", path: "/payment-accounts",
+		summary: "List payment accounts",
+		reply:   &bisquit.GetPaymentAccountsReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			list, err := c.GetPaymentAccounts(ctx)
+			return &bisquit.GetPaymentAccountsReply{PaymentAccounts: list}, err
+		},
+	},
+	{
+		method: "POST", path: "/payment-accounts",
+		summary: "Create a payment account from a filled-in form",
+		body:    &bisquit.CreatePaymentAccountRequest{},
+		reply:   &bisquit.CreatePaymentAccountReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			req := r.body.(*bisquit.CreatePaymentAccountRequest)
+			acc, err := c.CreatePaymentAccount(ctx, req.PaymentAccountForm)
+			return &bisquit.CreatePaymentAccountReply{PaymentAccount: acc}, err
+		},
+	},
+	{
+		method: "GET", path: "/payment-methods",
+		summary: "List payment methods",
+		reply:   &bisquit.GetPaymentMethodsReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			list, err := c.GetPaymentMethods(ctx)
+			return &bisquit.GetPaymentMethodsReply{PaymentMethods: list}, err
+		},
+	},
+	{
+		method: "GET", path: "/payment-methods/{id}/form",
+		summary: "Get payment account form for a payment method",
+		reply:   &bisquit.GetPaymentAccountFormReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			form, err := c.GetPaymentAccountForm(ctx, r.params["id"])
+			if err != nil {
+				return nil, err
+			}
+			data, err := json.Marshal(form)
+			return &bisquit.GetPaymentAccountFormReply{PaymentAccountFormJson: string(data)}, err
+		},
+	},
+
+	//------------------------------------------------------------------
+	// Wallet
+	//------------------------------------------------------------------
+
+	{
+		method: "GET", path: "/wallet/balances",
+		summary: "Get wallet balances (currency 'BTC', 'BSQ' or all)",
+		query:   []string{"currency"},
+		reply:   &bisquit.GetBalancesReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			bal, err := c.GetBalances(ctx, r.query.Get("currency"))
+			return &bisquit.GetBalancesReply{Balances: bal}, err
+		},
+	},
+	{
+		method: "GET", path: "/wallet/addresses",
+		summary: "List funding addresses",
+		reply:   &bisquit.GetFundingAddressesReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			list, err := c.GetFundingAddresses(ctx)
+			return &bisquit.GetFundingAddressesReply{AddressBalanceInfo: list}, err
+		},
+	},
+	{
+		method: "GET", path: "/wallet/addresses/{address}",
+		summary: "Get balance of a wallet address",
+		reply:   &bisquit.GetAddressBalanceReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			info, err := c.GetAddressBalance(ctx, r.params["address"])
+			return &bisquit.GetAddressBalanceReply{AddressBalanceInfo: info}, err
+		},
+	},
+	{
+		method: "GET", path: "/wallet/bsq-address",
+		summary: "Get an unused BSQ address",
+		reply:   &bisquit.GetUnusedBsqAddressReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			addr, err := c.GetUnusedBsqAddress(ctx)
+			return &bisquit.GetUnusedBsqAddressReply{Address: addr}, err
+		},
+	},
+	{
+		method: "POST", path: "/wallet/send-btc",
+		summary: "Send BTC to an external address",
+		body:    &bisquit.SendBtcRequest{},
+		reply:   &bisquit.SendBtcReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			req := r.body.(*bisquit.SendBtcRequest)
+			tx, err := c.SendBtc(ctx, req.Address, req.Amount, req.TxFeeRate, req.Memo)
+			return &bisquit.SendBtcReply{TxInfo: tx}, err
+		},
+	},
+	{
+		method: "POST", path: "/wallet/send-bsq",
+		summary: "Send BSQ to an external address",
+		body:    &bisquit.SendBsqRequest{},
+		reply:   &bisquit.SendBsqReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			req := r.body.(*bisquit.SendBsqRequest)
+			tx, err := c.SendBsq(ctx, req.Address, req.Amount, req.TxFeeRate)
+			return &bisquit.SendBsqReply{TxInfo: tx}, err
+		},
+	},
+	{
+		method: "POST", path: "/wallet/verify-bsq",
+		summary: "Verify that BSQ has been sent to a wallet address",
+		body:    &bisquit.VerifyBsqSentToAddressRequest{},
+		reply:   &bisquit.VerifyBsqSentToAddressReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			req := r.body.(*bisquit.VerifyBsqSentToAddressRequest)
+			ok, err := c.VerifyBsqSentToAddress(ctx, req.Address, req.Amount)
+			return &bisquit.VerifyBsqSentToAddressReply{IsAmountReceived: ok}, err
+		},
+	},
+	{
+		method: "GET", path: "/wallet/transactions/{id}",
+		summary: "Get wallet transaction with given ID",
+		reply:   &bisquit.GetTransactionReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			tx, err := c.GetTransaction(ctx, r.params["id"])
+			return &bisquit.GetTransactionReply{TxInfo: tx}, err
+		},
+	},
+	{
+		method: "GET", path: "/wallet/fee-rate",
+		summary: "Get transaction fee rates",
+		reply:   &bisquit.GetTxFeeRateReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			info, err := c.GetTxFeeRate(ctx)
+			return &bisquit.GetTxFeeRateReply{TxFeeRateInfo: info}, err
+		},
+	},
+	{
+		method: "PUT", path: "/wallet/fee-rate",
+		summary: "Set custom transaction fee rate",
+		body:    &bisquit.SetTxFeeRatePreferenceRequest{},
+		reply:   &bisquit.SetTxFeeRatePreferenceReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			req := r.body.(*bisquit.SetTxFeeRatePreferenceRequest)
+			info, err := c.SetTxFeeRatePreference(ctx, req.TxFeeRatePreference)
+			return &bisquit.SetTxFeeRatePreferenceReply{TxFeeRateInfo: info}, err
+		},
+	},
+	{
+		method: "DELETE", path: "/wallet/fee-rate",
+		summary: "Remove custom transaction fee rate",
+		reply:   &bisquit.UnsetTxFeeRatePreferenceReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			info, err := c.UnsetTxFeeRatePreference(ctx)
+			return &bisquit.UnsetTxFeeRatePreferenceReply{TxFeeRateInfo: info}, err
+		},
+	},
+	{
+		method: "POST", path: "/wallet/lock",
+		summary: "Lock the wallet",
+		reply:   &bisquit.LockWalletReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			return &bisquit.LockWalletReply{}, c.LockWallet(ctx)
+		},
+	},
+	{
+		method: "POST", path: "/wallet/unlock",
+		summary: "Unlock the wallet for a period (in seconds)",
+		body:    &bisquit.UnlockWalletRequest{},
+		reply:   &bisquit.UnlockWalletReply{},
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			req := r.body.(*bisquit.UnlockWalletRequest)
+			return &bisquit.UnlockWalletReply{}, c.UnlockWallet(ctx, req.Password, req.Timeout)
+		},
+	},
+}
+
+// tradeOp creates a route for a trade operation without arguments
+func tradeOp(op, summary string, fcn func(*bisquit.Client, context.Context, string) error, reply proto.Message) *route {
+	return &route{
+		method:  "POST",
+		path:    "/trades/{id}/" + op,
+		summary: summary,
+		reply:   reply,
+		handle: func(ctx context.Context, c *bisquit.Client, r *request) (proto.Message, error) {
+			return reply.ProtoReflect().New().Interface(), fcn(c, ctx, r.params["id"])
+		},
+	}
+}
@@ -0,0 +1,433 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Error codes
+var (
+	ErrJournalTampered = fmt.Errorf("Journal has been tampered with")
+	ErrJournalWrite    = fmt.Errorf("Journal write failed")
+	ErrJournalTable    = fmt.Errorf("Invalid journal table name")
+)
+
+// journaled methods (full gRPC method name to short name)
+var journaled = map[string]string{
+	Offers_CreateOffer_FullMethodName:                                 "CreateOffer",
+	Offers_CreateBsqSwapOffer_FullMethodName:                          "CreateBsqSwapOffer",
+	Offers_EditOffer_FullMethodName:                                   "EditOffer",
+	Offers_CancelOffer_FullMethodName:                                 "CancelOffer",
+	Trades_TakeOffer_FullMethodName:                                   "TakeOffer",
+	Trades_ConfirmPaymentStarted_FullMethodName:                       "ConfirmPaymentStarted",
+	Trades_ConfirmPaymentReceived_FullMethodName:                      "ConfirmPaymentReceived",
+	Trades_CloseTrade_FullMethodName:                                  "CloseTrade",
+	Trades_FailTrade_FullMethodName:                                   "FailTrade",
+	Trades_UnFailTrade_FullMethodName:                                 "UnFailTrade",
+	Trades_WithdrawFunds_FullMethodName:                               "WithdrawFunds",
+	Wallets_SendBtc_FullMethodName:                                    "SendBtc",
+	Wallets_SendBsq_FullMethodName:                                    "SendBsq",
+	Wallets_SetTxFeeRatePreference_FullMethodName:                     "SetTxFeeRatePreference",
+	Wallets_UnsetTxFeeRatePreference_FullMethodName:                   "UnsetTxFeeRatePreference",
+	Wallets_SetWalletPassword_FullMethodName:                          "SetWalletPassword",
+	Wallets_RemoveWalletPassword_FullMethodName:                       "RemoveWalletPassword",
+	Wallets_LockWallet_FullMethodName:                                 "LockWallet",
+	Wallets_UnlockWallet_FullMethodName:                               "UnlockWallet",
+	PaymentAccounts_CreatePaymentAccount_FullMethodName:               "CreatePaymentAccount",
+	PaymentAccounts_CreateCryptoCurrencyPaymentAccount_FullMethodName: "CreateCryptoCurrencyPaymentAccount",
+}
+
+// value of redacted arguments
+const redacted = "[redacted]"
+
+//----------------------------------------------------------------------
+// Journal entries
+//----------------------------------------------------------------------
+
+// JournalEntry records a mutating API call
+type JournalEntry struct {
+	Seq    uint64            `json:"seq"`              // sequence number (from 1)
+	Time   time.Time         `json:"time"`             // time of call
+	Method string            `json:"method"`           // name of API method
+	Args   json.RawMessage   `json:"args"`             // request (secrets redacted)
+	Result map[string]string `json:"result,omitempty"` // IDs in the reply
+	Error  string            `json:"error,omitempty"`  // error of call
+	Prev   string            `json:"prev"`             // hash of previous entry
+	Hash   string            `json:"hash"`             // hash of this entry
+}
+
+// digest computes the hash of an entry (over all fields except the hash)
+func (e *JournalEntry) digest() (string, error) {
+	ee := *e
+	ee.Hash = ""
+	data, err := json.Marshal(&ee)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// redact returns the JSON encoding of a request with secrets removed
+func redact(req proto.Message) (json.RawMessage, error) {
+	msg := proto.Clone(req)
+	m := msg.ProtoReflect()
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap() &&
+			strings.Contains(string(fd.Name()), "password") {
+			m.Set(fd, protoreflect.ValueOfString(redacted))
+		}
+		return true
+	})
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	// compact encoding (as stored in the journal)
+	buf := new(bytes.Buffer)
+	if err = json.Compact(buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resultIDs returns the identifiers (offer, trade, transaction and account
+// IDs) in a reply message.
+func resultIDs(reply proto.Message) map[string]string {
+	ids := make(map[string]string)
+	reply.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return true
+		}
+		v.Message().Range(func(sub protoreflect.FieldDescriptor, sv protoreflect.Value) bool {
+			switch sub.Name() {
+			case "id", "trade_id", "tx_id":
+				if sub.Kind() == protoreflect.StringKind {
+					ids[string(fd.Name())+"."+string(sub.Name())] = sv.String()
+				}
+			}
+			return true
+		})
+		return true
+	})
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids
+}
+
+//----------------------------------------------------------------------
+// Journal sinks
+//----------------------------------------------------------------------
+
+// JournalSink stores journal entries
+type JournalSink interface {
+	// Append an entry to the store
+	Append(e *JournalEntry) error
+	// Last returns the last entry in the store (or nil if empty)
+	Last() (*JournalEntry, error)
+	// Entries returns all entries in order
+	Entries() ([]*JournalEntry, error)
+}
+
+// FileSink stores entries in a JSON-lines file.
+type FileSink struct {
+	path string     // journal file
+	mtx  sync.Mutex // serialize access
+}
+
+// NewFileSink creates a sink for the given file.
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+// Append an entry to the file (synced to disk)
+func (s *FileSink) Append(e *JournalEntry) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(data, '\n')); err == nil {
+		err = f.Sync()
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// Entries returns all entries in the file
+func (s *FileSink) Entries() ([]*JournalEntry, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var list []*JournalEntry
+	rdr := bufio.NewScanner(f)
+	rdr.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for rdr.Scan() {
+		e := new(JournalEntry)
+		if err = json.Unmarshal(rdr.Bytes(), e); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rdr.Err()
+}
+
+// Last returns the last entry in the file
+func (s *FileSink) Last() (*JournalEntry, error) {
+	list, err := s.Entries()
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[len(list)-1], nil
+}
+
+// SQLSink stores entries in a table of a SQL database (e.g. an embedded
+// SQLite database; the driver is registered by the application). Queries
+// use '?' placeholders.
+type SQLSink struct {
+	db    *sql.DB // database handle
+	table string  // table name
+}
+
+// valid names of journal tables
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// NewSQLSink creates the journal table (if missing) and returns a sink.
+// The table name is part of the SQL statements and must be a plain
+// identifier.
+func NewSQLSink(db *sql.DB, table string) (*SQLSink, error) {
+	if !tableName.MatchString(table) {
+		return nil, fmt.Errorf("%w '%s'", ErrJournalTable, table)
+	}
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + table + ` (
+		seq INTEGER PRIMARY KEY,
+		time TEXT NOT NULL,
+		method TEXT NOT NULL,
+		args TEXT NOT NULL,
+		result TEXT,
+		error TEXT,
+		prev TEXT NOT NULL,
+		hash TEXT NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLSink{db: db, table: table}, nil
+}
+
+// Append an entry
+func (s *SQLSink) Append(e *JournalEntry) error {
+	res, err := json.Marshal(e.Result)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO `+s.table+` (seq, time, method, args, result, error, prev, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Seq, e.Time.Format(time.RFC3339Nano), e.Method, string(e.Args), string(res), e.Error, e.Prev, e.Hash)
+	return err
+}
+
+// query entries
+func (s *SQLSink) query(suffix string) ([]*JournalEntry, error) {
+	rows, err := s.db.Query(`SELECT seq, time, method, args, result, error, prev, hash FROM ` + s.table + ` ` + suffix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*JournalEntry
+	for rows.Next() {
+		var (
+			e          = new(JournalEntry)
+			ts         string
+			args, res  string
+			errMsg     sql.NullString
+			resultNull sql.NullString
+		)
+		if err = rows.Scan(&e.Seq, &ts, &e.Method, &args, &resultNull, &errMsg, &e.Prev, &e.Hash); err != nil {
+			return nil, err
+		}
+		if e.Time, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+			return nil, err
+		}
+		e.Args = json.RawMessage(args)
+		if res = resultNull.String; len(res) > 0 && res != "null" {
+			if err = json.Unmarshal([]byte(res), &e.Result); err != nil {
+				return nil, err
+			}
+		}
+		e.Error = errMsg.String
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// Entries returns all entries
+func (s *SQLSink) Entries() ([]*JournalEntry, error) {
+	return s.query("ORDER BY seq")
+}
+
+// Last returns the last entry
+func (s *SQLSink) Last() (*JournalEntry, error) {
+	list, err := s.query("ORDER BY seq DESC LIMIT 1")
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+//----------------------------------------------------------------------
+// Journal
+//----------------------------------------------------------------------
+
+// Journal records all mutating API calls of a client in a hash-chained
+// append-only log.
+type Journal struct {
+	sink JournalSink // storage of entries
+	seq  uint64      // sequence number of last entry
+	last string      // hash of last entry
+	mtx  sync.Mutex  // serialize access
+}
+
+// NewJournal creates a journal that continues the chain in a sink.
+func NewJournal(sink JournalSink) (*Journal, error) {
+	j := &Journal{sink: sink}
+	last, err := sink.Last()
+	if err != nil {
+		return nil, err
+	}
+	if last != nil {
+		j.seq, j.last = last.Seq, last.Hash
+	}
+	return j, nil
+}
+
+// WithJournal records mutating API calls of the client in a journal
+func WithJournal(j *Journal) Option {
+	return WithInterceptor(j.Interceptor())
+}
+
+// Record a call in the journal
+func (j *Journal) Record(method string, req, reply proto.Message, callErr error) (*JournalEntry, error) {
+	args, err := redact(req)
+	if err != nil {
+		return nil, err
+	}
+	e := &JournalEntry{
+		Time:   time.Now().UTC(),
+		Method: method,
+		Args:   args,
+	}
+	if callErr != nil {
+		e.Error = callErr.Error()
+	} else if reply != nil {
+		e.Result = resultIDs(reply)
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	e.Seq = j.seq + 1
+	e.Prev = j.last
+	if e.Hash, err = e.digest(); err != nil {
+		return nil, err
+	}
+	if err = j.sink.Append(e); err != nil {
+		return nil, err
+	}
+	j.seq, j.last = e.Seq, e.Hash
+	return e, nil
+}
+
+// Interceptor returns a gRPC interceptor that records mutating calls. If
+// a successful call can't be recorded, ErrJournalWrite is returned.
+func (j *Journal) Interceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		name, ok := journaled[method]
+		if !ok {
+			return err
+		}
+		reqMsg, _ := req.(proto.Message)
+		replyMsg, _ := reply.(proto.Message)
+		if reqMsg == nil {
+			return err
+		}
+		if _, jErr := j.Record(name, reqMsg, replyMsg, err); jErr != nil && err == nil {
+			return fmt.Errorf("%w: %s", ErrJournalWrite, jErr.Error())
+		}
+		return err
+	}
+}
+
+// VerifyJournal checks the hash chain of the entries in a sink; returns
+// the number of entries or ErrJournalTampered (with the first broken
+// sequence number).
+func VerifyJournal(sink JournalSink) (int, error) {
+	list, err := sink.Entries()
+	if err != nil {
+		return 0, err
+	}
+	prev := ""
+	for i, e := range list {
+		hash, err := e.digest()
+		if err != nil {
+			return i, err
+		}
+		if e.Seq != uint64(i+1) || e.Prev != prev || e.Hash != hash {
+			return i, fmt.Errorf("%w (entry #%d)", ErrJournalTampered, i+1)
+		}
+		prev = e.Hash
+	}
+	return len(list), nil
+}
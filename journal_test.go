@@ -0,0 +1,163 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestJournalRecord(t *testing.T) {
+	j, err := NewJournal(new(memorySink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &UnlockWalletRequest{Password: "secret", Timeout: 60}
+	e, err := j.Record("UnlockWallet", req, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(e.Args), "secret") || !strings.Contains(string(e.Args), redacted) {
+		t.Fatalf("secret not redacted: %s", string(e.Args))
+	}
+	if req.Password != "secret" {
+		t.Fatal("request modified")
+	}
+	reply := &TakeOfferReply{Trade: &TradeInfo{TradeId: "t1", ShortId: "t"}}
+	if e, err = j.Record("TakeOffer", &TakeOfferRequest{OfferId: "o1"}, reply, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e.Seq != 2 || e.Result["trade.trade_id"] != "t1" || len(e.Result) != 1 {
+		t.Fatalf("wrong entry: %+v", e)
+	}
+	if e, err = j.Record("CancelOffer", &CancelOfferRequest{Id: "o2"}, nil, errors.New("no offer")); err != nil {
+		t.Fatal(err)
+	}
+	if e.Error != "no offer" || e.Result != nil {
+		t.Fatalf("wrong entry: %+v", e)
+	}
+	if n, err := VerifyJournal(j.sink); n != 3 || err != nil {
+		t.Fatalf("verify failed: %d (%v)", n, err)
+	}
+}
+
+func TestJournalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := NewJournal(NewFileSink(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"o1", "o2"} {
+		if _, err = j.Record("CancelOffer", &CancelOfferRequest{Id: id}, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// continue chain after restart
+	if j, err = NewJournal(NewFileSink(path)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = j.Record("CancelOffer", &CancelOfferRequest{Id: "o3"}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := VerifyJournal(NewFileSink(path)); n != 3 || err != nil {
+		t.Fatalf("verify failed: %d (%v)", n, err)
+	}
+	// tamper with second entry
+	data, _ := os.ReadFile(path)
+	if err = os.WriteFile(path, []byte(strings.Replace(string(data), `"o2"`, `"o4"`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := VerifyJournal(NewFileSink(path)); n != 1 || !errors.Is(err, ErrJournalTampered) {
+		t.Fatalf("tampering not detected: %d (%v)", n, err)
+	}
+}
+
+func TestJournalInterceptor(t *testing.T) {
+	sink := new(memorySink)
+	j, _ := NewJournal(sink)
+	icpt := j.Interceptor()
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if r, ok := reply.(*SendBtcReply); ok {
+			r.TxInfo = &TxInfo{TxId: "tx1"}
+		}
+		return nil
+	}
+	ctx := context.Background()
+	if err := icpt(ctx, Wallets_GetBalances_FullMethodName, &GetBalancesRequest{}, &GetBalancesReply{}, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if err := icpt(ctx, Wallets_SendBtc_FullMethodName, &SendBtcRequest{Address: "bc1q", Amount: "0.1"}, &SendBtcReply{}, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := sink.Entries()
+	if len(list) != 1 || list[0].Method != "SendBtc" || list[0].Result["tx_info.tx_id"] != "tx1" {
+		t.Fatalf("wrong entries: %v", list)
+	}
+}
+
+func TestSQLSinkTable(t *testing.T) {
+	for _, name := range []string{"", "1journal", "journal; DROP TABLE x", "journal-x", "j.x"} {
+		if _, err := NewSQLSink(nil, name); !errors.Is(err, ErrJournalTable) {
+			t.Fatalf("table name '%s' accepted", name)
+		}
+	}
+}
+
+// memorySink keeps journal entries in memory.
+type memorySink struct {
+	list []*JournalEntry // list of entries
+	mtx  sync.Mutex      // serialize access
+}
+
+// Append an entry
+func (s *memorySink) Append(e *JournalEntry) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	ee := *e
+	s.list = append(s.list, &ee)
+	return nil
+}
+
+// Entries returns all entries
+func (s *memorySink) Entries() ([]*JournalEntry, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	list := make([]*JournalEntry, len(s.list))
+	copy(list, s.list)
+	return list, nil
+}
+
+// Last returns the last entry
+func (s *memorySink) Last() (*JournalEntry, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.list) == 0 {
+		return nil, nil
+	}
+	return s.list[len(s.list)-1], nil
+}
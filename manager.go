@@ -0,0 +1,473 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error codes
+var (
+	ErrManagerNodeExists = fmt.Errorf("Node already managed")
+	ErrManagerNoNode     = fmt.Errorf("No such node")
+	ErrManagerNoOwner    = fmt.Errorf("No node owns the offer or trade")
+	ErrManagerAmbiguous  = fmt.Errorf("Offer or trade owned by multiple nodes")
+)
+
+// NodeErrors holds the errors of a fan-out call per node.
+type NodeErrors map[string]error
+
+// Error returns a combined error message (sorted by node name).
+func (e NodeErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + e[name].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// NodeTrade is a trade of a managed node.
+type NodeTrade struct {
+	Node  string     // name of node
+	Trade *TradeInfo // trade information
+}
+
+// NodeOffer is an offer of a managed node.
+type NodeOffer struct {
+	Node  string     // name of node
+	Offer *OfferInfo // offer information
+}
+
+// NodeHealth is the result of a health check of a node.
+type NodeHealth struct {
+	Node      string        `json:"node"`            // name of node
+	Host      string        `json:"host"`            // host:port of daemon
+	Connected bool          `json:"connected"`       // client connected?
+	Version   string        `json:"version"`         // daemon version
+	Latency   time.Duration `json:"latency"`         // round-trip time of version call
+	Checked   time.Time     `json:"checked"`         // time of check
+	Error     string        `json:"error,omitempty"` // error message of failed check
+}
+
+// Healthy returns true if the node responded to the check.
+func (h *NodeHealth) Healthy() bool {
+	return h.Connected && len(h.Error) == 0
+}
+
+// owned is the known owner of an offer or trade
+type owned struct {
+	node  string     // name of owning node
+	trade bool       // listed as open trade
+	offer *OfferInfo // listed as own offer
+}
+
+// Manager holds named clients for multiple Bisq daemons. It runs queries
+// on all nodes concurrently and routes calls for an offer or trade to the
+// node that owns it.
+type Manager struct {
+	nodes map[string]*Client // managed clients
+	owner map[string]*owned  // known owners (offer/trade ID)
+	mtx   sync.RWMutex       // serialize access
+}
+
+// NewManager creates an empty client manager.
+func NewManager() *Manager {
+	return &Manager{
+		nodes: make(map[string]*Client),
+		owner: make(map[string]*owned),
+	}
+}
+
+// Add a client under given name. The client can be connected or not.
+func (m *Manager) Add(name string, c *Client) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.nodes[name]; ok {
+		return ErrManagerNodeExists
+	}
+	m.nodes[name] = c
+	return nil
+}
+
+// Remove a named client from the manager. The client is not closed.
+func (m *Manager) Remove(name string) (*Client, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	c, ok := m.nodes[name]
+	if !ok {
+		return nil, ErrManagerNoNode
+	}
+	delete(m.nodes, name)
+	for id, o := range m.owner {
+		if o.node == name {
+			delete(m.owner, id)
+		}
+	}
+	return c, nil
+}
+
+// Get the client with given name.
+func (m *Manager) Get(name string) (*Client, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	c, ok := m.nodes[name]
+	if !ok {
+		return nil, ErrManagerNoNode
+	}
+	return c, nil
+}
+
+// Names returns the sorted list of node names.
+func (m *Manager) Names() []string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	names := make([]string, 0, len(m.nodes))
+	for name := range m.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Each calls a function for all nodes concurrently. Errors are returned
+// as NodeErrors (or nil if all calls succeeded).
+func (m *Manager) Each(ctx context.Context, fcn func(ctx context.Context, name string, c *Client) error) error {
+	m.mtx.RLock()
+	nodes := make(map[string]*Client, len(m.nodes))
+	for name, c := range m.nodes {
+		nodes[name] = c
+	}
+	m.mtx.RUnlock()
+
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		errs = make(NodeErrors)
+	)
+	for name, c := range nodes {
+		wg.Add(1)
+		go func(name string, c *Client) {
+			defer wg.Done()
+			if err := fcn(ctx, name, c); err != nil {
+				mtx.Lock()
+				errs[name] = err
+				mtx.Unlock()
+			}
+		}(name, c)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Connect all unconnected clients.
+func (m *Manager) Connect(ctx context.Context, timeout time.Duration) error {
+	return m.Each(ctx, func(ctx context.Context, name string, c *Client) error {
+		if c.conn != nil {
+			return nil
+		}
+		return c.Connect(ctx, timeout)
+	})
+}
+
+// Close all connected clients.
+func (m *Manager) Close() error {
+	return m.Each(context.Background(), func(ctx context.Context, name string, c *Client) error {
+		if c.conn == nil {
+			return nil
+		}
+		return c.Close()
+	})
+}
+
+// Health checks all nodes by requesting the daemon version. The result
+// is sorted by node name.
+func (m *Manager) Health(ctx context.Context) []*NodeHealth {
+	var (
+		list []*NodeHealth
+		mtx  sync.Mutex
+	)
+	m.Each(ctx, func(ctx context.Context, name string, c *Client) error {
+		h := &NodeHealth{
+			Node:      name,
+			Host:      c.rpcHost,
+			Connected: c.conn != nil,
+			Checked:   time.Now(),
+		}
+		var err error
+		if h.Version, err = c.GetVersion(ctx); err != nil {
+			h.Error = err.Error()
+		}
+		h.Latency = time.Since(h.Checked)
+		mtx.Lock()
+		list = append(list, h)
+		mtx.Unlock()
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Node < list[j].Node
+	})
+	return list
+}
+
+// Balances returns the balances of all nodes and their sum. Nodes that
+// failed to report balances are listed in the returned NodeErrors.
+func (m *Manager) Balances(ctx context.Context) (total *BalancesInfo, nodes map[string]*BalancesInfo, err error) {
+	var mtx sync.Mutex
+	nodes = make(map[string]*BalancesInfo)
+	err = m.Each(ctx, func(ctx context.Context, name string, c *Client) error {
+		bi, err := c.GetBalances(ctx, "")
+		if err != nil {
+			return err
+		}
+		mtx.Lock()
+		nodes[name] = bi
+		mtx.Unlock()
+		return nil
+	})
+	total = &BalancesInfo{
+		Bsq: new(BsqBalanceInfo),
+		Btc: new(BtcBalanceInfo),
+	}
+	for _, bi := range nodes {
+		if bsq := bi.Bsq; bsq != nil {
+			total.Bsq.AvailableConfirmedBalance += bsq.AvailableConfirmedBalance
+			total.Bsq.UnverifiedBalance += bsq.UnverifiedBalance
+			total.Bsq.UnconfirmedChangeBalance += bsq.UnconfirmedChangeBalance
+			total.Bsq.LockedForVotingBalance += bsq.LockedForVotingBalance
+			total.Bsq.LockupBondsBalance += bsq.LockupBondsBalance
+			total.Bsq.UnlockingBondsBalance += bsq.UnlockingBondsBalance
+		}
+		if btc := bi.Btc; btc != nil {
+			total.Btc.AvailableBalance += btc.AvailableBalance
+			total.Btc.ReservedBalance += btc.ReservedBalance
+			total.Btc.TotalAvailableBalance += btc.TotalAvailableBalance
+			total.Btc.LockedBalance += btc.LockedBalance
+		}
+	}
+	return
+}
+
+// Trades returns the trades of all nodes (mode as in GetTrades), sorted
+// by node name and trade date. The owners of the trades are remembered
+// for routing.
+func (m *Manager) Trades(ctx context.Context, mode int) ([]*NodeTrade, error) {
+	var (
+		list []*NodeTrade
+		mtx  sync.Mutex
+	)
+	err := m.Each(ctx, func(ctx context.Context, name string, c *Client) error {
+		trades, err := c.GetTrades(ctx, mode)
+		if err != nil {
+			return err
+		}
+		mtx.Lock()
+		for _, t := range trades {
+			list = append(list, &NodeTrade{Node: name, Trade: t})
+		}
+		mtx.Unlock()
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Node != list[j].Node {
+			return list[i].Node < list[j].Node
+		}
+		return list[i].Trade.Date < list[j].Trade.Date
+	})
+	m.mtx.Lock()
+	if mode == int(GetTradesRequest_OPEN) {
+		// forget trades that are no longer open on responding nodes
+		open := make(map[string]bool)
+		for _, t := range list {
+			open[t.Trade.TradeId] = true
+		}
+		for id, o := range m.owner {
+			if o.trade && !open[id] && !failed(err, o.node) {
+				delete(m.owner, id)
+			}
+		}
+		for _, t := range list {
+			m.owner[t.Trade.TradeId] = &owned{node: t.Node, trade: true}
+		}
+	} else {
+		// closed and failed trades are not routed from memory
+		for _, t := range list {
+			delete(m.owner, t.Trade.TradeId)
+		}
+	}
+	m.mtx.Unlock()
+	return list, err
+}
+
+// failed returns true if a node is listed in the errors of a fan-out call.
+func failed(err error, name string) bool {
+	if errs, ok := err.(NodeErrors); ok {
+		_, ok = errs[name]
+		return ok
+	}
+	return err != nil
+}
+
+// MyOffers returns the offers of all nodes (see GetMyOffers), sorted by
+// node name and offer date. The owners of the offers are remembered for
+// routing.
+func (m *Manager) MyOffers(ctx context.Context, dir, curr string) ([]*NodeOffer, error) {
+	var (
+		list []*NodeOffer
+		mtx  sync.Mutex
+	)
+	err := m.Each(ctx, func(ctx context.Context, name string, c *Client) error {
+		offers, err := c.GetMyOffers(ctx, dir, curr)
+		if err != nil {
+			return err
+		}
+		mtx.Lock()
+		for _, o := range offers {
+			list = append(list, &NodeOffer{Node: name, Offer: o})
+		}
+		mtx.Unlock()
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Node != list[j].Node {
+			return list[i].Node < list[j].Node
+		}
+		return list[i].Offer.Date < list[j].Offer.Date
+	})
+	m.mtx.Lock()
+	// forget listed offers of responding nodes that are gone
+	listed := make(map[string]bool)
+	for _, o := range list {
+		listed[o.Offer.Id] = true
+	}
+	for id, o := range m.owner {
+		if o.offer != nil && !o.trade && !listed[id] && !failed(err, o.node) &&
+			(len(dir) == 0 || strings.EqualFold(o.offer.Direction, dir)) &&
+			len(filterCurrency([]*OfferInfo{o.offer}, curr)) > 0 {
+			delete(m.owner, id)
+		}
+	}
+	for _, o := range list {
+		if e, ok := m.owner[o.Offer.Id]; ok && e.node == o.Node {
+			e.offer = o.Offer
+			continue
+		}
+		m.owner[o.Offer.Id] = &owned{node: o.Node, offer: o.Offer}
+	}
+	m.mtx.Unlock()
+	return list, err
+}
+
+// Assign an offer or trade ID to a node (e.g. after creating an offer
+// with the client of the node).
+func (m *Manager) Assign(id, name string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.nodes[name]; !ok {
+		return ErrManagerNoNode
+	}
+	m.owner[id] = &owned{node: name}
+	return nil
+}
+
+// Route returns the node that owns an offer or trade with given ID. Unknown
+// IDs are looked up on all nodes (as own offer or as trade); the trade ID
+// in Bisq is the ID of the taken offer. If no owner is found and some
+// nodes failed to answer, their errors are returned as NodeErrors.
+func (m *Manager) Route(ctx context.Context, id string) (string, *Client, error) {
+	m.mtx.RLock()
+	var (
+		name string
+		c    *Client
+	)
+	o, ok := m.owner[id]
+	if ok {
+		name = o.node
+		c = m.nodes[name]
+	}
+	m.mtx.RUnlock()
+	if ok && c != nil {
+		return name, c, nil
+	}
+	var (
+		owners []string
+		mtx    sync.Mutex
+	)
+	err := m.Each(ctx, func(ctx context.Context, name string, c *Client) error {
+		if _, err := c.GetMyOffer(ctx, id); err != nil {
+			if _, err = c.GetTrade(ctx, id); err != nil {
+				if unknownID(err) {
+					return nil
+				}
+				return err
+			}
+		}
+		mtx.Lock()
+		owners = append(owners, name)
+		mtx.Unlock()
+		return nil
+	})
+	switch len(owners) {
+	case 0:
+		if err != nil {
+			return "", nil, err
+		}
+		return "", nil, ErrManagerNoOwner
+	case 1:
+		name = owners[0]
+	default:
+		return "", nil, ErrManagerAmbiguous
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if c, ok = m.nodes[name]; !ok {
+		return "", nil, ErrManagerNoOwner
+	}
+	m.owner[id] = &owned{node: name}
+	return name, c, nil
+}
+
+// unknownID returns true if the daemon rejected a lookup because the ID
+// is unknown (and not because the call failed).
+func unknownID(err error) bool {
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.NotFound, codes.InvalidArgument:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	needDaemon(t)
+	ctx := context.Background()
+	m := NewManager()
+	if err := m.Add("main", testClient); err != nil {
+		t.Fatal(err)
+	}
+	// second node is never connected
+	if err := m.Add("offline", NewClient("127.0.0.1:1", "", time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("main", testClient); !errors.Is(err, ErrManagerNodeExists) {
+		t.Fatalf("duplicate node accepted: %v", err)
+	}
+
+	// health check
+	health := m.Health(ctx)
+	if len(health) != 2 || !health[0].Healthy() || health[1].Healthy() {
+		t.Fatalf("wrong health: %v", health)
+	}
+	t.Logf("Health: %+v", *health[0])
+
+	// aggregated balances with a failing node
+	total, nodes, err := m.Balances(ctx)
+	var errs NodeErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(errs["offline"], ErrClientNotConnected) {
+		t.Fatalf("wrong errors: %v", err)
+	}
+	if _, ok := nodes["main"]; !ok {
+		t.Log("No balances available")
+	} else if total.Btc.AvailableBalance != nodes["main"].Btc.GetAvailableBalance() {
+		t.Fatalf("wrong total: %v", total)
+	}
+	if _, err = m.Trades(ctx, 0); err == nil {
+		t.Fatal("missing error from offline node")
+	}
+
+	// closed trades are evicted from routing (failed nodes keep theirs)
+	m.mtx.Lock()
+	m.owner["closed-id"] = &owned{node: "main", trade: true}
+	m.owner["offline-id"] = &owned{node: "offline", trade: true}
+	m.mtx.Unlock()
+	m.Trades(ctx, int(GetTradesRequest_OPEN))
+	m.mtx.RLock()
+	_, closed := m.owner["closed-id"]
+	_, kept := m.owner["offline-id"]
+	m.mtx.RUnlock()
+	if closed || !kept {
+		t.Fatalf("wrong eviction: %v %v", closed, kept)
+	}
+
+	// routing: unknown ID with a failing node
+	errs = nil
+	if _, _, err = m.Route(ctx, "unknown-id"); !errors.As(err, &errs) ||
+		len(errs) != 1 || !errors.Is(errs["offline"], ErrClientNotConnected) {
+		t.Fatalf("unknown ID routed: %v", err)
+	}
+	if err = m.Assign("some-id", "offline"); err != nil {
+		t.Fatal(err)
+	}
+	name, c, err := m.Route(ctx, "some-id")
+	if err != nil || name != "offline" || c == testClient {
+		t.Fatalf("wrong route: %s (%v)", name, err)
+	}
+	if _, err = m.Remove("offline"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = m.Route(ctx, "some-id"); !errors.Is(err, ErrManagerNoOwner) {
+		t.Fatalf("removed node routed: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//----------------------------------------------------------------------
+// HTTP webhook
+//----------------------------------------------------------------------
+
+// Webhook headers
+const (
+	HeaderSignature = "X-Bisquit-Signature" // "sha256=<hex>"
+	HeaderTimestamp = "X-Bisquit-Timestamp" // seconds since epoch
+	HeaderDelivery  = "X-Bisquit-Delivery"  // notification ID
+)
+
+// Webhook posts notifications as JSON to an URL. If a secret is set, the
+// payload is signed with HMAC-SHA256 over "<timestamp>.<body>".
+type Webhook struct {
+	URL    string       // webhook endpoint
+	Secret []byte       // signing key (optional)
+	Client *http.Client // HTTP client (default: 30s timeout)
+}
+
+// Sign returns the signature of a payload.
+func Sign(secret []byte, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a webhook request body; receivers should
+// also reject old timestamps to prevent replays.
+func Verify(secret []byte, ts int64, body []byte, sig string) bool {
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(sig))
+}
+
+// Notify posts the notification to the webhook URL
+func (w *Webhook) Notify(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderDelivery, n.ID)
+	if len(w.Secret) > 0 {
+		req.Header.Set(HeaderSignature, Sign(w.Secret, ts, body))
+	}
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+//----------------------------------------------------------------------
+// SMTP mail
+//----------------------------------------------------------------------
+
+// Mailer sends notifications as plain-text mails.
+type Mailer struct {
+	Addr string    // host:port of SMTP server
+	Auth smtp.Auth // authentication (optional)
+	From string    // sender address
+	To   []string  // recipient addresses
+}
+
+// message builds the mail for a notification
+func (m *Mailer) message(n *Notification) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[bisquit] "+n.Title))
+	fmt.Fprintf(buf, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(buf, "%s\r\n\r\n", n.Message)
+	fmt.Fprintf(buf, "Trade:  %s\r\n", n.TradeID)
+	fmt.Fprintf(buf, "Role:   %s\r\n", n.Role)
+	fmt.Fprintf(buf, "Phase:  %s\r\n", n.Phase)
+	fmt.Fprintf(buf, "Period: %s\r\n", n.PeriodState)
+	return buf.Bytes()
+}
+
+// Notify sends a mail to all recipients (the context is not used by
+// the SMTP client).
+func (m *Mailer) Notify(ctx context.Context, n *Notification) error {
+	return smtp.SendMail(m.Addr, m.Auth, m.From, m.To, m.message(n))
+}
+
+//----------------------------------------------------------------------
+// External command
+//----------------------------------------------------------------------
+
+// Command runs an external program for notifications. The notification is
+// passed as JSON on stdin and in environment variables (BISQUIT_KIND,
+// BISQUIT_TRADE_ID, BISQUIT_SHORT_ID, BISQUIT_PHASE, BISQUIT_TITLE and
+// BISQUIT_MESSAGE). A non-zero exit code is a failed delivery.
+type Command struct {
+	Path string   // program to run
+	Args []string // command-line arguments
+}
+
+// Notify runs the command
+func (c *Command) Notify(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"BISQUIT_KIND="+n.Kind,
+		"BISQUIT_TRADE_ID="+n.TradeID,
+		"BISQUIT_SHORT_ID="+n.ShortID,
+		"BISQUIT_PHASE="+n.Phase,
+		"BISQUIT_TITLE="+n.Title,
+		"BISQUIT_MESSAGE="+n.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); len(msg) > 0 {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
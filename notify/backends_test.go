@@ -0,0 +1,169 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// notification for backend tests
+var testNotification = &Notification{
+	ID:      "abc1/buyer-must-pay/DEPOSIT_CONFIRMED",
+	Kind:    KindBuyerMustPay,
+	Time:    time.Now(),
+	TradeID: "abc1",
+	ShortID: "abc",
+	Phase:   "DEPOSIT_CONFIRMED",
+	Title:   "Trade abc: Payment must be started",
+	Message: "Trade abc: start the payment.",
+}
+
+func TestWebhook(t *testing.T) {
+	secret := []byte("secret")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if !Verify(secret, ts, body, r.Header.Get(HeaderSignature)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var n Notification
+		if err := json.Unmarshal(body, &n); err != nil || n.ID != r.Header.Get(HeaderDelivery) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	if err := (&Webhook{URL: srv.URL, Secret: secret}).Notify(ctx, testNotification); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Webhook{URL: srv.URL, Secret: []byte("wrong")}).Notify(ctx, testNotification); err == nil {
+		t.Fatal("wrong signature accepted")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	cmd := &Command{
+		Path: "/bin/sh",
+		Args: []string{"-c", `cat > "$0" && echo "$BISQUIT_KIND" >> "$0"`, out},
+	}
+	if _, err := os.Stat(cmd.Path); err != nil {
+		t.Skip("no shell available")
+	}
+	if err := cmd.Notify(context.Background(), testNotification); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"tradeId":"abc1"`) || !strings.HasSuffix(string(data), KindBuyerMustPay+"\n") {
+		t.Fatalf("wrong output: %s", string(data))
+	}
+	fail := &Command{Path: "/bin/sh", Args: []string{"-c", "echo broken; exit 1"}}
+	if err := fail.Notify(context.Background(), testNotification); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+// smtpServer accepts a single mail and returns the message
+func smtpServer(ln net.Listener, msg chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rdr := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+	var data strings.Builder
+	inData := false
+	for {
+		line, err := rdr.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				msg <- data.String()
+				reply("250 OK")
+				continue
+			}
+			data.WriteString(line)
+			continue
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			inData = true
+			reply("354 go ahead")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestMailer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msg := make(chan string, 1)
+	go smtpServer(ln, msg)
+
+	m := &Mailer{
+		Addr: ln.Addr().String(),
+		From: "bisquit@example.com",
+		To:   []string{"trader@example.com"},
+	}
+	if err = m.Notify(context.Background(), testNotification); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case body := <-msg:
+		if !strings.Contains(body, "Subject: [bisquit] Trade abc: Payment must be started") ||
+			!strings.Contains(body, testNotification.Message) {
+			t.Fatalf("wrong mail: %s", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no mail received")
+	}
+}
@@ -0,0 +1,489 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+// Package notify sends notifications for trades that need human action
+// (payment to be started or verified, end of trade period, failed trades)
+// to webhooks, mail recipients or external commands. Notifications are
+// queued in a persistent outbox, retried on failure and sent only once
+// per trade phase.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bfix/bisquit"
+)
+
+// Error codes
+var (
+	ErrNotifyNoBackend = fmt.Errorf("No notification backend defined")
+)
+
+// Notification kinds
+const (
+	KindBuyerMustPay     = "buyer-must-pay"     // buyer must start payment
+	KindSellerMustVerify = "seller-must-verify" // seller must confirm payment
+	KindPeriodHalf       = "period-half"        // second half of trade period
+	KindPeriodOver       = "period-over"        // trade period is over
+	KindTradeFailed      = "trade-failed"       // trade has failed
+)
+
+// Notification about a trade that needs attention
+type Notification struct {
+	ID          string    `json:"id"`          // unique key (trade, kind, phase or period state)
+	Kind        string    `json:"kind"`        // notification kind
+	Time        time.Time `json:"time"`        // time of detection
+	TradeID     string    `json:"tradeId"`     // trade identifier
+	ShortID     string    `json:"shortId"`     // short trade identifier
+	Role        string    `json:"role"`        // own role in trade
+	Phase       string    `json:"phase"`       // trade phase
+	PeriodState string    `json:"periodState"` // state of trade period
+	Amount      uint64    `json:"amount"`      // trade amount (sats)
+	Price       string    `json:"price"`       // trade price
+	Volume      string    `json:"volume"`      // trade volume
+	Currency    string    `json:"currency"`    // counter currency
+	Title       string    `json:"title"`       // short description
+	Message     string    `json:"message"`     // human-readable text
+}
+
+// Notifier is a backend that delivers notifications
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// NotifierFunc is a function implementing the Notifier interface
+type NotifierFunc func(ctx context.Context, n *Notification) error
+
+// Notify calls the function
+func (f NotifierFunc) Notify(ctx context.Context, n *Notification) error {
+	return f(ctx, n)
+}
+
+// newNotification creates a notification of given kind for a trade.
+// Notifications about the trade period are sent once per period state
+// (and not again on later phase changes).
+func newNotification(kind string, trade *bisquit.TradeInfo, now time.Time) *Notification {
+	key := trade.Phase
+	if kind == KindPeriodHalf || kind == KindPeriodOver {
+		key = trade.TradePeriodState
+	}
+	n := &Notification{
+		ID:          trade.TradeId + "/" + kind + "/" + key,
+		Kind:        kind,
+		Time:        now,
+		TradeID:     trade.TradeId,
+		ShortID:     trade.ShortId,
+		Role:        trade.Role,
+		Phase:       trade.Phase,
+		PeriodState: trade.TradePeriodState,
+		Amount:      trade.TradeAmountAsLong,
+		Price:       trade.TradePrice,
+		Volume:      trade.TradeVolume,
+		Currency:    trade.Offer.GetCounterCurrencyCode(),
+	}
+	amount := fmt.Sprintf("%d.%08d BTC", n.Amount/100000000, n.Amount%100000000)
+	switch kind {
+	case KindBuyerMustPay:
+		n.Title = "Payment must be started"
+		n.Message = fmt.Sprintf("Trade %s: start the payment of %s %s for %s and confirm it.",
+			n.ShortID, n.Volume, n.Currency, amount)
+	case KindSellerMustVerify:
+		n.Title = "Payment must be verified"
+		n.Message = fmt.Sprintf("Trade %s: the buyer has started the payment of %s %s for %s; verify the receipt and confirm it.",
+			n.ShortID, n.Volume, n.Currency, amount)
+	case KindPeriodHalf:
+		n.Title = "Trade period half over"
+		n.Message = fmt.Sprintf("Trade %s: the second half of the trade period has started (phase %s).",
+			n.ShortID, n.Phase)
+	case KindPeriodOver:
+		n.Title = "Trade period is over"
+		n.Message = fmt.Sprintf("Trade %s: the trade period is over (phase %s); open a dispute if the trade can't be completed.",
+			n.ShortID, n.Phase)
+	case KindTradeFailed:
+		n.Title = "Trade failed"
+		n.Message = fmt.Sprintf("Trade %s has failed (phase %s, state %s).",
+			n.ShortID, n.Phase, trade.State)
+	}
+	n.Title = "Trade " + n.ShortID + ": " + n.Title
+	return n
+}
+
+// Events returns the notifications for an open trade.
+func Events(trade *bisquit.TradeInfo, now time.Time) (list []*Notification) {
+	if trade.IsCompleted || trade.IsPayoutPublished {
+		return
+	}
+	buyer := bisquit.IsBuyer(trade)
+	switch trade.Phase {
+	case "DEPOSIT_CONFIRMED":
+		if buyer && !trade.IsPaymentStartedMessageSent {
+			list = append(list, newNotification(KindBuyerMustPay, trade, now))
+		}
+	case "FIAT_SENT":
+		if !buyer && !trade.IsPaymentReceivedMessageSent {
+			list = append(list, newNotification(KindSellerMustVerify, trade, now))
+		}
+	}
+	switch trade.TradePeriodState {
+	case "SECOND_HALF":
+		list = append(list, newNotification(KindPeriodHalf, trade, now))
+	case "TRADE_PERIOD_OVER":
+		list = append(list, newNotification(KindPeriodOver, trade, now))
+	}
+	return
+}
+
+//----------------------------------------------------------------------
+// Dispatcher with persistent outbox
+//----------------------------------------------------------------------
+
+// Delivery of a notification to a backend
+type Delivery struct {
+	Backend      string        `json:"backend"`         // name of backend
+	Notification *Notification `json:"notification"`    // notification
+	Attempts     int           `json:"attempts"`        // failed attempts
+	Next         time.Time     `json:"next"`            // time of next attempt
+	Error        string        `json:"error,omitempty"` // last error
+	Dead         bool          `json:"dead,omitempty"`  // no more retries
+}
+
+// outbox is the persistent state of the dispatcher
+type outbox struct {
+	Queue  []*Delivery      `json:"queue"`  // pending deliveries
+	Seen   map[string]int64 `json:"seen"`   // notification IDs (and time)
+	Failed map[string]int64 `json:"failed"` // reported failed trades (nil = not seeded)
+}
+
+// Default retry settings
+const (
+	DefaultMaxAttempts = 10
+	DefaultRetryBase   = 30 * time.Second
+	DefaultRetryMax    = time.Hour
+)
+
+// notifications are remembered for dedup for this time
+const seenPeriod = 90 * 24 * time.Hour
+
+// Dispatcher checks trades for required actions and delivers notifications
+// to all backends.
+type Dispatcher struct {
+	client   *bisquit.Client     // client for API calls
+	path     string              // outbox file ("" = in memory)
+	names    []string            // backend names (in order)
+	backends map[string]Notifier // notification backends
+	box      *outbox             // queue and dedup state
+	attempts int                 // max. delivery attempts
+	base     time.Duration       // first retry delay
+	max      time.Duration       // max. retry delay
+	mtx      sync.Mutex          // serialize access
+	dlv      sync.Mutex          // serialize deliveries
+}
+
+// NewDispatcher creates a dispatcher with an outbox file. Pending
+// deliveries from the outbox are resumed.
+func NewDispatcher(c *bisquit.Client, path string) (*Dispatcher, error) {
+	d := &Dispatcher{
+		client:   c,
+		path:     path,
+		backends: make(map[string]Notifier),
+		box: &outbox{
+			Seen: make(map[string]int64),
+		},
+		attempts: DefaultMaxAttempts,
+		base:     DefaultRetryBase,
+		max:      DefaultRetryMax,
+	}
+	if len(path) > 0 {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			if err = json.Unmarshal(data, d.box); err != nil {
+				return nil, err
+			}
+			if d.box.Seen == nil {
+				d.box.Seen = make(map[string]int64)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// AddNotifier adds a named backend.
+func (d *Dispatcher) AddNotifier(name string, n Notifier) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if _, ok := d.backends[name]; !ok {
+		d.names = append(d.names, name)
+	}
+	d.backends[name] = n
+}
+
+// SetRetry sets the max. number of delivery attempts and the delays
+// between attempts (doubled after each attempt up to max).
+func (d *Dispatcher) SetRetry(attempts int, base, max time.Duration) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.attempts, d.base, d.max = attempts, base, max
+}
+
+// Pending returns the queued deliveries (including dead ones).
+func (d *Dispatcher) Pending() []*Delivery {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	list := make([]*Delivery, len(d.box.Queue))
+	for i, e := range d.box.Queue {
+		dd := *e
+		list[i] = &dd
+	}
+	return list
+}
+
+// save the outbox (locked)
+func (d *Dispatcher) save() error {
+	if len(d.path) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(d.box)
+	if err != nil {
+		return err
+	}
+	tmp := d.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
+
+// Enqueue a notification for delivery to all backends. Returns false if
+// the notification has been queued before.
+func (d *Dispatcher) Enqueue(n *Notification) (bool, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if len(d.names) == 0 {
+		return false, ErrNotifyNoBackend
+	}
+	if _, ok := d.box.Seen[n.ID]; ok {
+		return false, nil
+	}
+	d.box.Seen[n.ID] = n.Time.Unix()
+	for _, name := range d.names {
+		d.box.Queue = append(d.box.Queue, &Delivery{
+			Backend:      name,
+			Notification: n,
+			Next:         n.Time,
+		})
+	}
+	return true, d.save()
+}
+
+// Check open and failed trades and queue notifications.
+func (d *Dispatcher) Check(ctx context.Context) error {
+	now := time.Now()
+	trades, err := d.client.GetTrades(ctx, int(bisquit.GetTradesRequest_OPEN))
+	if err != nil {
+		return err
+	}
+	var list []*Notification
+	for _, t := range trades {
+		list = append(list, Events(t, now)...)
+	}
+	if trades, err = d.client.GetTrades(ctx, int(bisquit.GetTradesRequest_FAILED)); err != nil {
+		return err
+	}
+	for _, n := range list {
+		if _, err = d.Enqueue(n); err != nil {
+			return err
+		}
+	}
+	return d.checkFailed(trades, now)
+}
+
+// checkFailed queues notifications for trades that have entered the list of
+// failed trades since the last check. On the first check the known failed
+// trades are recorded without notification.
+func (d *Dispatcher) checkFailed(trades []*bisquit.TradeInfo, now time.Time) error {
+	d.mtx.Lock()
+	seeded := d.box.Failed != nil
+	known := d.box.Failed
+	d.mtx.Unlock()
+
+	failed := make(map[string]int64)
+	for _, t := range trades {
+		ts, ok := known[t.TradeId]
+		if !ok {
+			ts = now.Unix()
+			if seeded {
+				if _, err := d.Enqueue(newNotification(KindTradeFailed, t, now)); err != nil {
+					return err
+				}
+			}
+		}
+		failed[t.TradeId] = ts
+	}
+	// trades that left the list are forgotten
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.box.Failed = failed
+	return d.save()
+}
+
+// Deliver all due notifications. Failed deliveries are retried later;
+// returns the number of successful deliveries.
+func (d *Dispatcher) Deliver(ctx context.Context) (int, error) {
+	d.dlv.Lock()
+	defer d.dlv.Unlock()
+
+	// collect due deliveries
+	now := time.Now()
+	d.mtx.Lock()
+	var due []*Delivery
+	for _, e := range d.box.Queue {
+		if !e.Dead && !e.Next.After(now) {
+			due = append(due, e)
+		}
+	}
+	d.mtx.Unlock()
+
+	// send notifications
+	sent := make(map[*Delivery]bool)
+	for _, e := range due {
+		d.mtx.Lock()
+		n := d.backends[e.Backend]
+		d.mtx.Unlock()
+		var err error
+		if n == nil {
+			err = fmt.Errorf("unknown backend '%s'", e.Backend)
+		} else {
+			err = n.Notify(ctx, e.Notification)
+		}
+		d.mtx.Lock()
+		if err == nil {
+			sent[e] = true
+		} else {
+			e.Attempts++
+			e.Error = err.Error()
+			if e.Attempts >= d.attempts {
+				e.Dead = true
+			} else {
+				e.Next = time.Now().Add(d.backoff(e.Attempts))
+			}
+		}
+		d.mtx.Unlock()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// update outbox
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	var queue []*Delivery
+	for _, e := range d.box.Queue {
+		if !sent[e] {
+			queue = append(queue, e)
+		}
+	}
+	d.box.Queue = queue
+	d.prune(now)
+	return len(sent), d.save()
+}
+
+// backoff returns the delay after a number of failed attempts (locked)
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.base
+	for i := 1; i < attempts && delay < d.max; i++ {
+		delay *= 2
+	}
+	if delay > d.max {
+		delay = d.max
+	}
+	return delay
+}
+
+// prune old dedup entries without pending deliveries (locked)
+func (d *Dispatcher) prune(now time.Time) {
+	queued := make(map[string]bool)
+	for _, e := range d.box.Queue {
+		queued[e.Notification.ID] = true
+	}
+	limit := now.Add(-seenPeriod).Unix()
+	for id, ts := range d.box.Seen {
+		if ts < limit && !queued[id] {
+			delete(d.box.Seen, id)
+		}
+	}
+}
+
+// Retry resets dead deliveries for another round of attempts; returns the
+// number of revived deliveries.
+func (d *Dispatcher) Retry() (int, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	count := 0
+	for _, e := range d.box.Queue {
+		if e.Dead {
+			e.Dead = false
+			e.Attempts = 0
+			e.Next = time.Now()
+			count++
+		}
+	}
+	return count, d.save()
+}
+
+// Run checks trades and delivers notifications in given intervals until
+// the context is cancelled. Errors are passed to the callback (if defined).
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration, errCb func(error)) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		// deliver queued notifications even if the daemon is unavailable
+		errC := d.Check(ctx)
+		_, errD := d.Deliver(ctx)
+		if errCb != nil {
+			for _, err := range []error{errC, errD} {
+				if err != nil {
+					errCb(err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// Backends returns the names of all backends.
+func (d *Dispatcher) Backends() []string {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	list := make([]string, len(d.names))
+	copy(list, d.names)
+	return list
+}
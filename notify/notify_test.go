@@ -0,0 +1,236 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bfix/bisquit"
+)
+
+// trade returns a test trade (we are the buyer as maker)
+func trade(id, phase, period string) *bisquit.TradeInfo {
+	return &bisquit.TradeInfo{
+		TradeId:           id,
+		ShortId:           id[:3],
+		Role:              "BTC buyer as maker",
+		Phase:             phase,
+		TradePeriodState:  period,
+		TradeAmountAsLong: 1000000,
+		TradeVolume:       "300.00",
+		Offer:             &bisquit.OfferInfo{IsMyOffer: true, CounterCurrencyCode: "EUR"},
+		Contract:          &bisquit.ContractInfo{IsBuyerMakerAndSellerTaker: true},
+	}
+}
+
+func TestEvents(t *testing.T) {
+	now := time.Now()
+	kinds := func(tr *bisquit.TradeInfo) (list []string) {
+		for _, n := range Events(tr, now) {
+			list = append(list, n.Kind)
+		}
+		return
+	}
+	if k := kinds(trade("abc1", "DEPOSIT_CONFIRMED", "FIRST_HALF")); len(k) != 1 || k[0] != KindBuyerMustPay {
+		t.Fatalf("wrong events: %v", k)
+	}
+	if k := kinds(trade("abc1", "FIAT_SENT", "SECOND_HALF")); len(k) != 1 || k[0] != KindPeriodHalf {
+		t.Fatalf("wrong events: %v", k)
+	}
+	// we are the seller
+	tr := trade("abc1", "FIAT_SENT", "TRADE_PERIOD_OVER")
+	tr.Contract.IsBuyerMakerAndSellerTaker = false
+	if k := kinds(tr); len(k) != 2 || k[0] != KindSellerMustVerify || k[1] != KindPeriodOver {
+		t.Fatalf("wrong events: %v", k)
+	}
+	tr.IsPaymentReceivedMessageSent = true
+	tr.IsCompleted = true
+	if k := kinds(tr); len(k) != 0 {
+		t.Fatalf("wrong events: %v", k)
+	}
+	n := Events(trade("abc1", "DEPOSIT_CONFIRMED", ""), now)[0]
+	if n.ID != "abc1/buyer-must-pay/DEPOSIT_CONFIRMED" || n.Currency != "EUR" || len(n.Message) == 0 {
+		t.Fatalf("wrong notification: %v", n)
+	}
+	// period notifications don't depend on the phase
+	a := Events(trade("abc1", "DEPOSIT_CONFIRMED", "SECOND_HALF"), now)
+	b := Events(trade("abc1", "FIAT_SENT", "SECOND_HALF"), now)
+	if id := a[len(a)-1].ID; id != "abc1/period-half/SECOND_HALF" || b[len(b)-1].ID != id {
+		t.Fatalf("wrong notification IDs: %s, %s", id, b[len(b)-1].ID)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	d, err := NewDispatcher(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := Events(trade("abc1", "DEPOSIT_CONFIRMED", ""), time.Now())[0]
+	if _, err = d.Enqueue(n); err != ErrNotifyNoBackend {
+		t.Fatal("missing backend accepted")
+	}
+	var (
+		good []string
+		fail = true
+	)
+	d.AddNotifier("good", NotifierFunc(func(ctx context.Context, n *Notification) error {
+		good = append(good, n.ID)
+		return nil
+	}))
+	d.AddNotifier("bad", NotifierFunc(func(ctx context.Context, n *Notification) error {
+		if fail {
+			return errors.New("unreachable")
+		}
+		return nil
+	}))
+	d.SetRetry(2, time.Millisecond, time.Millisecond)
+
+	// queue once per trade phase
+	if ok, err := d.Enqueue(n); !ok || err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if ok, _ := d.Enqueue(n); ok {
+		t.Fatal("duplicate queued")
+	}
+	if cnt, err := d.Deliver(ctx); cnt != 1 || err != nil {
+		t.Fatalf("delivered %d (%v)", cnt, err)
+	}
+	if p := d.Pending(); len(p) != 1 || p[0].Backend != "bad" || p[0].Attempts != 1 || p[0].Dead {
+		t.Fatalf("wrong pending: %v", p)
+	}
+
+	// outbox survives restart
+	if d, err = NewDispatcher(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	d.AddNotifier("bad", NotifierFunc(func(ctx context.Context, n *Notification) error {
+		if fail {
+			return errors.New("unreachable")
+		}
+		return nil
+	}))
+	d.SetRetry(2, time.Millisecond, time.Millisecond)
+	if ok, _ := d.Enqueue(n); ok {
+		t.Fatal("duplicate queued after restart")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if cnt, _ := d.Deliver(ctx); cnt != 0 {
+		t.Fatalf("delivered %d", cnt)
+	}
+	if p := d.Pending(); len(p) != 1 || !p[0].Dead || p[0].Error != "unreachable" {
+		t.Fatalf("wrong pending: %v", p)
+	}
+
+	// dead deliveries are revived on request
+	fail = false
+	if cnt, _ := d.Retry(); cnt != 1 {
+		t.Fatalf("revived %d", cnt)
+	}
+	if cnt, _ := d.Deliver(ctx); cnt != 1 {
+		t.Fatalf("delivered %d", cnt)
+	}
+	if p := d.Pending(); len(p) != 0 || len(good) != 1 {
+		t.Fatalf("wrong pending: %v", p)
+	}
+}
+
+func TestFailedTrades(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	d, err := NewDispatcher(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.AddNotifier("good", NotifierFunc(func(ctx context.Context, n *Notification) error {
+		return nil
+	}))
+	queued := func() (list []string) {
+		for _, e := range d.Pending() {
+			list = append(list, e.Notification.ID)
+		}
+		return
+	}
+	now := time.Now()
+	old := trade("old1", "DEPOSIT_PUBLISHED", "")
+
+	// known failed trades are not reported on first run
+	if err = d.checkFailed([]*bisquit.TradeInfo{old}, now); err != nil {
+		t.Fatal(err)
+	}
+	if q := queued(); len(q) != 0 {
+		t.Fatalf("seeding queued %v", q)
+	}
+	// newly failed trades are reported once
+	tr := trade("new1", "DEPOSIT_PUBLISHED", "")
+	if err = d.checkFailed([]*bisquit.TradeInfo{old, tr}, now); err != nil {
+		t.Fatal(err)
+	}
+	if q := queued(); len(q) != 1 || q[0] != "new1/"+KindTradeFailed+"/DEPOSIT_PUBLISHED" {
+		t.Fatalf("wrong queue: %v", q)
+	}
+	if _, err = d.Deliver(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// no repeated notifications after the dedup period (and a restart)
+	later := now.Add(91 * 24 * time.Hour)
+	d.mtx.Lock()
+	d.prune(later)
+	seen := len(d.box.Seen)
+	d.mtx.Unlock()
+	if seen != 0 {
+		t.Fatalf("%d dedup entries left", seen)
+	}
+	if d, err = NewDispatcher(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	d.AddNotifier("good", NotifierFunc(func(ctx context.Context, n *Notification) error {
+		return nil
+	}))
+	if err = d.checkFailed([]*bisquit.TradeInfo{old, tr}, later); err != nil {
+		t.Fatal(err)
+	}
+	if q := queued(); len(q) != 0 {
+		t.Fatalf("failed trades reported again: %v", q)
+	}
+	// trades leaving the list are forgotten
+	if err = d.checkFailed([]*bisquit.TradeInfo{tr}, later); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.box.Failed) != 1 {
+		t.Fatalf("wrong failed trades: %v", d.box.Failed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d, _ := NewDispatcher(nil, "")
+	d.SetRetry(10, time.Second, 10*time.Second)
+	for i, exp := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if delay := d.backoff(i + 1); delay != exp {
+			t.Fatalf("attempt %d: %s", i+1, delay)
+		}
+	}
+}
@@ -22,6 +22,7 @@ package bisquit
 
 import (
 	"context"
+	"strings"
 )
 
 // GetOfferCategory returns the category of the offer with given ID
@@ -175,11 +176,15 @@ func (c *Client) GetMyBsqSwapOffer(ctx context.Context, ID string) (*OfferInfo,
 
 }
 
-// GetBsqSwapOffers returns a list of BSQ swap offers
+// GetBsqSwapOffers returns a list of BSQ swap offers. All swap offers
+// are BSQ/BTC offers, so the currency must be "BSQ", "BTC" or empty.
 func (c *Client) GetBsqSwapOffers(ctx context.Context, dir, curr string) ([]*OfferInfo, error) {
 	if c.conn == nil {
 		return nil, ErrClientNotConnected
 	}
+	if err := swapCurrency(curr); err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 	req := &GetBsqSwapOffersRequest{
@@ -192,11 +197,15 @@ func (c *Client) GetBsqSwapOffers(ctx context.Context, dir, curr string) ([]*Off
 	return resp.BsqSwapOffers, nil
 }
 
-// GetMyBsqSwapOffers returns a list of BSQ swap offers
+// GetMyBsqSwapOffers returns a list of own BSQ swap offers. All swap
+// offers are BSQ/BTC offers, so the currency must be "BSQ", "BTC" or empty.
 func (c *Client) GetMyBsqSwapOffers(ctx context.Context, dir, curr string) ([]*OfferInfo, error) {
 	if c.conn == nil {
 		return nil, ErrClientNotConnected
 	}
+	if err := swapCurrency(curr); err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 	req := &GetBsqSwapOffersRequest{
@@ -222,3 +231,39 @@ func (c *Client) CreateBsqSwapOffer(ctx context.Context, req *CreateBsqSwapOffer
 	}
 	return resp.BsqSwapOffer, nil
 }
+
+// EditOffer changes price, margin, trigger price or activation state of
+// an open offer.
+func (c *Client) EditOffer(ctx context.Context, req *EditOfferRequest) error {
+	if c.conn == nil {
+		return ErrClientNotConnected
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	_, err := c.oc.EditOffer(ctx, req)
+	return err
+}
+
+// swapCurrency checks the currency of a BSQ swap offer query.
+func swapCurrency(curr string) error {
+	switch strings.ToUpper(curr) {
+	case "", AssetBSQ, AssetBTC:
+		return nil
+	}
+	return ErrSwapCurrency
+}
+
+// filterCurrency returns the offers with given base or counter currency
+// (all offers if the currency is empty).
+func filterCurrency(list []*OfferInfo, curr string) []*OfferInfo {
+	if len(curr) == 0 {
+		return list
+	}
+	var res []*OfferInfo
+	for _, o := range list {
+		if strings.EqualFold(o.BaseCurrencyCode, curr) || strings.EqualFold(o.CounterCurrencyCode, curr) {
+			res = append(res, o)
+		}
+	}
+	return res
+}
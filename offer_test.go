@@ -27,6 +27,7 @@ import (
 )
 
 func TestGetOffers(t *testing.T) {
+	needDaemon(t)
 	ctx := context.Background()
 	offers, err := testClient.GetOffers(ctx, "buy", "EUR")
 	if err != nil {
@@ -0,0 +1,344 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Error codes
+var (
+	ErrOfferDirection   = fmt.Errorf("Invalid offer direction (BUY or SELL)")
+	ErrOfferCurrency    = fmt.Errorf("Missing offer currency")
+	ErrOfferAmount      = fmt.Errorf("Invalid offer amount")
+	ErrOfferPrice       = fmt.Errorf("Invalid offer price")
+	ErrOfferTrigger     = fmt.Errorf("Invalid trigger price")
+	ErrOfferDeposit     = fmt.Errorf("Security deposit out of range")
+	ErrOfferFeeCurrency = fmt.Errorf("Invalid maker fee currency (BTC or BSQ)")
+	ErrOfferAccount     = fmt.Errorf("Payment account not usable for offer")
+	ErrOfferFunds       = fmt.Errorf("Insufficient funds for offer")
+)
+
+// Limits of offers (as enforced by Bisq)
+const (
+	MinOfferAmount        = 10000 // min. trade amount (sats)
+	MinSecurityDeposit    = 60000 // min. security deposit (sats)
+	MinSecurityDepositPct = 15.0  // min. buyer security deposit (percent)
+	MaxSecurityDepositPct = 50.0  // max. buyer security deposit (percent)
+)
+
+// Parameters for the estimation of offer funding. The maker fee is only
+// estimated if paid in BTC; the transaction fee covers the maker fee and
+// deposit transactions.
+var (
+	MakerFeePct      = 0.15 // maker fee in percent of the amount
+	MinMakerFee      = uint64(5000)
+	OfferTxSize      = uint64(175 + 233) // vbytes of maker fee and deposit tx
+	DefaultTxFeeRate = uint64(10)        // sats/vbyte if daemon has no rate
+)
+
+// OfferSpec builds a validated request for a new offer. All settings are
+// checked locally before the request is sent to the daemon:
+//
+//	spec := NewOfferSpec("SELL", "EUR").Amount(0, 1000000).MarketPrice(1.5).
+//		PaymentAccount(accountID).SecurityDeposit(20)
+//	offer, err := spec.Create(ctx, client)
+type OfferSpec struct {
+	req *CreateOfferRequest // request to build
+}
+
+// NewOfferSpec starts a new offer for given direction (of BTC) and the
+// fiat or altcoin currency. Defaults are a minimal security deposit and
+// maker fee paid in BTC.
+func NewOfferSpec(direction, currency string) *OfferSpec {
+	return &OfferSpec{
+		req: &CreateOfferRequest{
+			Direction:               strings.ToUpper(direction),
+			CurrencyCode:            strings.ToUpper(currency),
+			BuyerSecurityDepositPct: MinSecurityDepositPct,
+			MakerFeeCurrencyCode:    "BTC",
+		},
+	}
+}
+
+// Amount sets the BTC amount range (sats). If min is zero, the offer can
+// only be taken for the full amount.
+func (s *OfferSpec) Amount(min, max uint64) *OfferSpec {
+	if min == 0 {
+		min = max
+	}
+	s.req.Amount, s.req.MinAmount = max, min
+	return s
+}
+
+// FixedPrice sets a fixed price.
+func (s *OfferSpec) FixedPrice(price string) *OfferSpec {
+	s.req.Price = strings.TrimSpace(price)
+	s.req.UseMarketBasedPrice = false
+	s.req.MarketPriceMarginPct = 0
+	return s
+}
+
+// MarketPrice uses the market price with a margin (percent) as price.
+func (s *OfferSpec) MarketPrice(margin float64) *OfferSpec {
+	s.req.Price = ""
+	s.req.UseMarketBasedPrice = true
+	s.req.MarketPriceMarginPct = margin
+	return s
+}
+
+// TriggerPrice sets the market price at which a market-based offer is
+// deactivated.
+func (s *OfferSpec) TriggerPrice(price string) *OfferSpec {
+	s.req.TriggerPrice = strings.TrimSpace(price)
+	return s
+}
+
+// SecurityDeposit sets the buyer security deposit (percent of amount).
+func (s *OfferSpec) SecurityDeposit(pct float64) *OfferSpec {
+	s.req.BuyerSecurityDepositPct = pct
+	return s
+}
+
+// PaymentAccount sets the payment account for the offer.
+func (s *OfferSpec) PaymentAccount(id string) *OfferSpec {
+	s.req.PaymentAccountId = id
+	return s
+}
+
+// MakerFeeCurrency sets the currency of the maker fee (BTC or BSQ).
+func (s *OfferSpec) MakerFeeCurrency(curr string) *OfferSpec {
+	s.req.MakerFeeCurrencyCode = strings.ToUpper(curr)
+	return s
+}
+
+// parsePrice returns a positive price (0 if empty)
+func parsePrice(s string) (float64, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	p, err := strconv.ParseFloat(s, 64)
+	if err != nil || p <= 0 || math.IsInf(p, 0) {
+		return 0, fmt.Errorf("'%s' is not a valid price", s)
+	}
+	return p, nil
+}
+
+// Validate checks the settings of the offer without contacting the daemon.
+// All problems found are returned (joined).
+func (s *OfferSpec) Validate() error {
+	var errs []error
+	fail := func(err error, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%w: %s", err, fmt.Sprintf(format, args...)))
+	}
+	r := s.req
+	if r.Direction != "BUY" && r.Direction != "SELL" {
+		fail(ErrOfferDirection, "'%s'", r.Direction)
+	}
+	if len(r.CurrencyCode) == 0 {
+		errs = append(errs, ErrOfferCurrency)
+	}
+	if r.Amount < MinOfferAmount {
+		fail(ErrOfferAmount, "amount %d below %d sats", r.Amount, MinOfferAmount)
+	}
+	if r.MinAmount < MinOfferAmount {
+		fail(ErrOfferAmount, "min. amount %d below %d sats", r.MinAmount, MinOfferAmount)
+	}
+	if r.MinAmount > r.Amount {
+		fail(ErrOfferAmount, "min. amount %d above amount %d", r.MinAmount, r.Amount)
+	}
+	if r.UseMarketBasedPrice {
+		if math.IsNaN(r.MarketPriceMarginPct) || r.MarketPriceMarginPct <= -100 || r.MarketPriceMarginPct >= 100 {
+			fail(ErrOfferPrice, "margin %f%% out of range", r.MarketPriceMarginPct)
+		}
+		if _, err := parsePrice(r.TriggerPrice); err != nil {
+			fail(ErrOfferTrigger, "%s", err.Error())
+		}
+	} else {
+		if p, err := parsePrice(r.Price); err != nil {
+			fail(ErrOfferPrice, "%s", err.Error())
+		} else if p == 0 {
+			fail(ErrOfferPrice, "missing fixed price")
+		}
+		if len(r.TriggerPrice) > 0 {
+			fail(ErrOfferTrigger, "only allowed for market-based prices")
+		}
+	}
+	if pct := r.BuyerSecurityDepositPct; pct < MinSecurityDepositPct || pct > MaxSecurityDepositPct {
+		fail(ErrOfferDeposit, "%.2f%% not in range %.0f%%-%.0f%%", pct, MinSecurityDepositPct, MaxSecurityDepositPct)
+	}
+	if r.MakerFeeCurrencyCode != "BTC" && r.MakerFeeCurrencyCode != "BSQ" {
+		fail(ErrOfferFeeCurrency, "'%s'", r.MakerFeeCurrencyCode)
+	}
+	if len(r.PaymentAccountId) == 0 {
+		fail(ErrOfferAccount, "no payment account")
+	}
+	return errors.Join(errs...)
+}
+
+// check the payment account and trigger price against daemon data
+func (s *OfferSpec) check(ctx context.Context, c *Client) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	r := s.req
+	accnts, err := c.GetPaymentAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	var accnt *PaymentAccount
+	for _, a := range accnts {
+		if a.Id == r.PaymentAccountId {
+			accnt = a
+			break
+		}
+	}
+	if accnt == nil {
+		return fmt.Errorf("%w: unknown account '%s'", ErrOfferAccount, r.PaymentAccountId)
+	}
+	if matchAccount([]*PaymentAccount{accnt}, accnt.PaymentMethod.GetId(), r.CurrencyCode) == nil {
+		return fmt.Errorf("%w: account '%s' does not support %s", ErrOfferAccount, accnt.AccountName, r.CurrencyCode)
+	}
+	if limit := accnt.PaymentMethod.GetMaxTradeLimit(); limit > 0 && r.Amount > uint64(limit) {
+		return fmt.Errorf("%w: amount %d above trade limit %d of payment method", ErrOfferAmount, r.Amount, limit)
+	}
+	if trigger, _ := parsePrice(r.TriggerPrice); trigger > 0 {
+		market, err := c.GetMarketPrice(ctx, r.CurrencyCode)
+		if err != nil {
+			return err
+		}
+		if !triggerValid(r.Direction, trigger, market, cryptoAccount(accnt, r.CurrencyCode)) {
+			return fmt.Errorf("%w: %s for %s offer at market price %.8g", ErrOfferTrigger, r.TriggerPrice, r.Direction, market)
+		}
+	}
+	return nil
+}
+
+// triggerValid returns true if the trigger price doesn't deactivate an
+// offer at the current market price: sell offers are deactivated if the
+// market price falls below the trigger price, buy offers if it rises
+// above. Altcoin prices are quoted in BTC (inverse to fiat prices), so
+// the directions are swapped.
+func triggerValid(dir string, trigger, market float64, crypto bool) bool {
+	sell := dir == "SELL"
+	if crypto {
+		sell = !sell
+	}
+	if sell {
+		return trigger < market
+	}
+	return trigger > market
+}
+
+// cryptoAccount returns true if an account trades the currency as an
+// altcoin.
+func cryptoAccount(accnt *PaymentAccount, curr string) bool {
+	list := append([]*TradeCurrency{accnt.SelectedTradeCurrency}, accnt.TradeCurrencies...)
+	for _, tc := range list {
+		if tc != nil && strings.EqualFold(tc.Code, curr) {
+			return tc.GetCryptoCurrency() != nil
+		}
+	}
+	return strings.HasPrefix(accnt.PaymentMethod.GetId(), "BLOCK_CHAINS")
+}
+
+// Request returns the validated request; the payment account and trigger
+// price are checked against the daemon data.
+func (s *OfferSpec) Request(ctx context.Context, c *Client) (*CreateOfferRequest, error) {
+	if err := s.check(ctx, c); err != nil {
+		return nil, err
+	}
+	return proto.Clone(s.req).(*CreateOfferRequest), nil
+}
+
+// OfferFunds is the estimated funding of an offer (all values in sats).
+type OfferFunds struct {
+	Amount    uint64 `json:"amount"`    // BTC sold (sell offers only)
+	Deposit   uint64 `json:"deposit"`   // security deposit
+	MakerFee  uint64 `json:"makerFee"`  // maker fee (if paid in BTC)
+	TxFee     uint64 `json:"txFee"`     // mining fees
+	Total     uint64 `json:"total"`     // total funds required
+	Available uint64 `json:"available"` // available wallet balance
+}
+
+// Funds estimates the BTC required to fund the offer and returns it with
+// the available balance of the wallet.
+func (s *OfferSpec) Funds(ctx context.Context, c *Client) (*OfferFunds, error) {
+	r := s.req
+	f := new(OfferFunds)
+	if r.Direction == "SELL" {
+		f.Amount = r.Amount
+	}
+	f.Deposit = uint64(math.Ceil(float64(r.Amount) * r.BuyerSecurityDepositPct / 100))
+	if f.Deposit < MinSecurityDeposit {
+		f.Deposit = MinSecurityDeposit
+	}
+	if r.MakerFeeCurrencyCode == "BTC" {
+		f.MakerFee = uint64(math.Ceil(float64(r.Amount) * MakerFeePct / 100))
+		if f.MakerFee < MinMakerFee {
+			f.MakerFee = MinMakerFee
+		}
+	}
+	rate, err := c.GetTxFeeRate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	feeRate := rate.FeeServiceRate
+	if rate.UseCustomTxFeeRate {
+		feeRate = rate.CustomTxFeeRate
+	}
+	if feeRate == 0 {
+		feeRate = DefaultTxFeeRate
+	}
+	f.TxFee = feeRate * OfferTxSize
+	f.Total = f.Amount + f.Deposit + f.MakerFee + f.TxFee
+
+	bal, err := c.GetBalances(ctx, "BTC")
+	if err != nil {
+		return nil, err
+	}
+	f.Available = bal.Btc.GetAvailableBalance()
+	return f, nil
+}
+
+// Create checks the offer (locally and against the daemon data), verifies
+// that the wallet can fund it and creates the offer.
+func (s *OfferSpec) Create(ctx context.Context, c *Client) (*OfferInfo, error) {
+	req, err := s.Request(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	f, err := s.Funds(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if f.Total > f.Available {
+		return nil, fmt.Errorf("%w: %d sats required, %d available", ErrOfferFunds, f.Total, f.Available)
+	}
+	return c.CreateOffer(ctx, req)
+}
@@ -0,0 +1,146 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestOfferSpecValidate(t *testing.T) {
+	for _, tc := range []struct {
+		spec *OfferSpec
+		err  error
+	}{
+		{NewOfferSpec("hold", "EUR").Amount(0, 1000000).FixedPrice("30000").PaymentAccount("acc1"), ErrOfferDirection},
+		{NewOfferSpec("sell", "").Amount(0, 1000000).FixedPrice("30000").PaymentAccount("acc1"), ErrOfferCurrency},
+		{NewOfferSpec("sell", "EUR").Amount(2000000, 1000000).FixedPrice("30000").PaymentAccount("acc1"), ErrOfferAmount},
+		{NewOfferSpec("sell", "EUR").Amount(0, 5000).FixedPrice("30000").PaymentAccount("acc1"), ErrOfferAmount},
+		{NewOfferSpec("sell", "EUR").Amount(0, 1000000).PaymentAccount("acc1"), ErrOfferPrice},
+		{NewOfferSpec("sell", "EUR").Amount(0, 1000000).FixedPrice("-1").PaymentAccount("acc1"), ErrOfferPrice},
+		{NewOfferSpec("sell", "EUR").Amount(0, 1000000).FixedPrice("30000").TriggerPrice("29000").PaymentAccount("acc1"), ErrOfferTrigger},
+		{NewOfferSpec("sell", "EUR").Amount(0, 1000000).MarketPrice(1).SecurityDeposit(60).PaymentAccount("acc1"), ErrOfferDeposit},
+		{NewOfferSpec("sell", "EUR").Amount(0, 1000000).MarketPrice(1).MakerFeeCurrency("XMR").PaymentAccount("acc1"), ErrOfferFeeCurrency},
+		{NewOfferSpec("sell", "EUR").Amount(0, 1000000).MarketPrice(1), ErrOfferAccount},
+	} {
+		if err := tc.spec.Validate(); !errors.Is(err, tc.err) {
+			t.Fatalf("expected %v, got %v: %v", tc.err, err, tc.spec.req)
+		}
+	}
+	// all problems are reported
+	err := NewOfferSpec("hold", "EUR").Amount(0, 5000).Validate()
+	if !errors.Is(err, ErrOfferDirection) || !errors.Is(err, ErrOfferAmount) || !errors.Is(err, ErrOfferPrice) {
+		t.Fatalf("missing errors: %v", err)
+	}
+	spec := NewOfferSpec("sell", "EUR").Amount(500000, 1000000).MarketPrice(1.5).TriggerPrice("29000").PaymentAccount("acc1")
+	if err = spec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTriggerPrice(t *testing.T) {
+	for _, tc := range []struct {
+		dir             string
+		trigger, market float64
+		crypto, valid   bool
+	}{
+		{"SELL", 29000, 30000, false, true},
+		{"SELL", 31000, 30000, false, false},
+		{"BUY", 31000, 30000, false, true},
+		{"BUY", 29000, 30000, false, false},
+		// altcoin prices in BTC
+		{"SELL", 0.0050, 0.0047, true, true},
+		{"SELL", 0.0045, 0.0047, true, false},
+		{"BUY", 0.0045, 0.0047, true, true},
+		{"BUY", 0.0050, 0.0047, true, false},
+	} {
+		if v := triggerValid(tc.dir, tc.trigger, tc.market, tc.crypto); v != tc.valid {
+			t.Fatalf("%+v: got %v", tc, v)
+		}
+	}
+	xmr := &PaymentAccount{
+		PaymentMethod:   &PaymentMethod{Id: "BLOCK_CHAINS"},
+		TradeCurrencies: []*TradeCurrency{{Code: "XMR", Message: &TradeCurrency_CryptoCurrency{CryptoCurrency: &CryptoCurrency{}}}},
+	}
+	sepa := &PaymentAccount{
+		PaymentMethod:   &PaymentMethod{Id: "SEPA"},
+		TradeCurrencies: []*TradeCurrency{{Code: "EUR", Message: &TradeCurrency_FiatCurrency{FiatCurrency: &FiatCurrency{}}}},
+	}
+	if !cryptoAccount(xmr, "xmr") || cryptoAccount(sepa, "EUR") {
+		t.Fatal("wrong currency type")
+	}
+}
+
+func TestOfferSpecRequest(t *testing.T) {
+	needDaemon(t)
+	ctx := context.Background()
+	// market price of fake daemon is 30500
+	for _, tc := range []struct {
+		spec *OfferSpec
+		err  error
+	}{
+		{NewOfferSpec("sell", "EUR").Amount(0, 1000000).MarketPrice(1).PaymentAccount("unknown"), ErrOfferAccount},
+		{NewOfferSpec("sell", "USD").Amount(0, 1000000).MarketPrice(1).PaymentAccount("acc1"), ErrOfferAccount},
+		{NewOfferSpec("sell", "EUR").Amount(0, 1000000).MarketPrice(1).TriggerPrice("31000").PaymentAccount("acc1"), ErrOfferTrigger},
+		{NewOfferSpec("buy", "EUR").Amount(0, 1000000).MarketPrice(-1).TriggerPrice("30000").PaymentAccount("acc1"), ErrOfferTrigger},
+	} {
+		if _, err := tc.spec.Request(ctx, testClient); !errors.Is(err, tc.err) {
+			t.Fatalf("expected %v, got %v: %v", tc.err, err, tc.spec.req)
+		}
+	}
+	spec := NewOfferSpec("sell", "eur").Amount(0, 1000000).MarketPrice(1.5).TriggerPrice("29000").PaymentAccount("acc1")
+	req, err := spec.Request(ctx, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.CurrencyCode != "EUR" || req.MinAmount != 1000000 || !req.UseMarketBasedPrice || req.MakerFeeCurrencyCode != "BTC" {
+		t.Fatalf("wrong request: %v", req)
+	}
+}
+
+func TestOfferSpecFunds(t *testing.T) {
+	needDaemon(t)
+	ctx := context.Background()
+	spec := NewOfferSpec("sell", "EUR").Amount(0, 1000000).FixedPrice("30000").PaymentAccount("acc1")
+	f, err := spec.Funds(ctx, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fake daemon: fee service rate 20 sats/vbyte, 0.5 BTC available
+	if f.Amount != 1000000 || f.Deposit != 150000 || f.MakerFee != MinMakerFee ||
+		f.TxFee != 20*OfferTxSize || f.Total != 1000000+150000+MinMakerFee+20*OfferTxSize || f.Available != 50000000 {
+		t.Fatalf("wrong funds: %v", f)
+	}
+	// buyer only funds the deposit; no BTC maker fee if paid in BSQ
+	f, err = NewOfferSpec("buy", "EUR").Amount(0, 100000).FixedPrice("30000").MakerFeeCurrency("BSQ").PaymentAccount("acc1").Funds(ctx, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Amount != 0 || f.Deposit != MinSecurityDeposit || f.MakerFee != 0 {
+		t.Fatalf("wrong funds: %v", f)
+	}
+	// offer exceeding the wallet balance is not created
+	_, err = NewOfferSpec("sell", "EUR").Amount(0, 60000000).FixedPrice("30000").PaymentAccount("acc1").Create(ctx, testClient)
+	if !errors.Is(err, ErrOfferFunds) {
+		t.Fatalf("unfunded offer created: %v", err)
+	}
+}
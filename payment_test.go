@@ -26,6 +26,7 @@ import (
 )
 
 func TestGetPaymentAccounts(t *testing.T) {
+	needDaemon(t)
 	ctx := context.Background()
 	accnts, err := testClient.GetPaymentAccounts(ctx)
 	if err != nil {
@@ -37,6 +38,7 @@ func TestGetPaymentAccounts(t *testing.T) {
 }
 
 func TestGetPaymentMethods(t *testing.T) {
+	needDaemon(t)
 	ctx := context.Background()
 	mthds, err := testClient.GetPaymentMethods(ctx)
 	if err != nil {
@@ -48,6 +50,7 @@ func TestGetPaymentMethods(t *testing.T) {
 }
 
 func TestGetPaymentAccountForm(t *testing.T) {
+	needDaemon(t)
 	ctx := context.Background()
 	form, err := testClient.GetPaymentAccountForm(ctx, "SEPA")
 	if err != nil {
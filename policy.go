@@ -0,0 +1,315 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policy rules
+const (
+	RuleMaxPerTx   = "max-per-tx"   // per-transaction limit
+	RuleMaxDaily   = "max-daily"    // rolling 24h limit
+	RuleAllowlist  = "allowlist"    // destination address not allowed
+	RuleMaxFeeRate = "max-fee-rate" // fee rate ceiling
+	RuleMemo       = "memo"         // memo required
+	RuleAmount     = "amount"       // invalid amount
+)
+
+// Assets guarded by a policy
+const (
+	AssetBTC = "BTC"
+	AssetBSQ = "BSQ"
+)
+
+// PolicyViolationError is returned if a wallet operation is rejected
+// by the spending policy.
+type PolicyViolationError struct {
+	Rule string // violated rule
+	Msg  string // description of the violation
+}
+
+// Error returns a human-readable error message
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("policy violation (%s): %s", e.Rule, e.Msg)
+}
+
+// violation creates a new policy violation error
+func violation(rule, format string, args ...interface{}) error {
+	return &PolicyViolationError{
+		Rule: rule,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// PolicyLimits for spending an asset (amounts in satoshis; 0 = no limit)
+type PolicyLimits struct {
+	MaxPerTx uint64 `json:"maxPerTx"` // max. amount per transaction
+	MaxDaily uint64 `json:"maxDaily"` // max. amount in 24 hours
+}
+
+// PolicyConfig defines the rules of a spending policy.
+type PolicyConfig struct {
+	BTC         PolicyLimits `json:"btc"`         // limits for BTC (satoshis)
+	BSQ         PolicyLimits `json:"bsq"`         // limits for BSQ (1/100 BSQ)
+	Allowlist   []string     `json:"allowlist"`   // allowed destinations (empty = any)
+	MaxFeeRate  uint64       `json:"maxFeeRate"`  // fee rate ceiling in sats/vbyte (0 = none)
+	RequireMemo bool         `json:"requireMemo"` // memo required for BTC transactions
+	StatePath   string       `json:"statePath"`   // file for persistent spending state
+}
+
+// policySpend is a record of an amount spent (or reserved)
+type policySpend struct {
+	Time   time.Time `json:"time"`
+	Asset  string    `json:"asset"`
+	Amount uint64    `json:"amount"`
+}
+
+// Policy guards the mutating wallet operations (SendBtc, SendBsq and
+// WithdrawFunds) of a client. The amounts spent in the last 24 hours
+// are persisted in a state file to survive restarts.
+type Policy struct {
+	cfg    *PolicyConfig   // policy rules
+	spends []*policySpend  // spends in the last 24 hours
+	allow  map[string]bool // allowed destinations
+	mtx    sync.Mutex      // serialize access
+}
+
+// NewPolicy creates a new spending policy and reads the spending state
+// from file (if defined).
+func NewPolicy(cfg *PolicyConfig) (*Policy, error) {
+	p := &Policy{
+		cfg:   cfg,
+		allow: make(map[string]bool),
+	}
+	for _, addr := range cfg.Allowlist {
+		p.allow[addr] = true
+	}
+	if len(cfg.StatePath) == 0 {
+		return p, nil
+	}
+	data, err := os.ReadFile(cfg.StatePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &p.spends); err != nil {
+		return nil, err
+	}
+	p.prune(time.Now())
+	return p, nil
+}
+
+// Spent returns the amount of an asset spent in the last 24 hours.
+func (p *Policy) Spent(asset string) uint64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.prune(time.Now())
+	return p.spent(asset)
+}
+
+// spent amount of asset (unlocked)
+func (p *Policy) spent(asset string) (sum uint64) {
+	for _, s := range p.spends {
+		if s.Asset == asset {
+			sum += s.Amount
+		}
+	}
+	return
+}
+
+// prune spends older than 24 hours
+func (p *Policy) prune(now time.Time) {
+	list := make([]*policySpend, 0, len(p.spends))
+	for _, s := range p.spends {
+		if now.Sub(s.Time) < 24*time.Hour {
+			list = append(list, s)
+		}
+	}
+	p.spends = list
+}
+
+// save spending state to file
+func (p *Policy) save() error {
+	if len(p.cfg.StatePath) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(p.spends)
+	if err != nil {
+		return err
+	}
+	tmp := p.cfg.StatePath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.cfg.StatePath)
+}
+
+// reserve checks a spend against the policy rules and reserves the
+// amount in the rolling limit. The fee rate is only checked if it is
+// not zero.
+func (p *Policy) reserve(asset, addr string, amount, feeRate uint64, memo string, needMemo bool) (*policySpend, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if len(p.allow) > 0 && !p.allow[addr] {
+		return nil, violation(RuleAllowlist, "address '%s' not in allowlist", addr)
+	}
+	if needMemo && p.cfg.RequireMemo && len(strings.TrimSpace(memo)) == 0 {
+		return nil, violation(RuleMemo, "memo required")
+	}
+	if p.cfg.MaxFeeRate > 0 && feeRate > p.cfg.MaxFeeRate {
+		return nil, violation(RuleMaxFeeRate, "fee rate %d sats/vbyte exceeds %d", feeRate, p.cfg.MaxFeeRate)
+	}
+	limits := p.cfg.BTC
+	if asset == AssetBSQ {
+		limits = p.cfg.BSQ
+	}
+	if limits.MaxPerTx > 0 && amount > limits.MaxPerTx {
+		return nil, violation(RuleMaxPerTx, "amount %d %s exceeds %d", amount, asset, limits.MaxPerTx)
+	}
+	now := time.Now()
+	p.prune(now)
+	if limits.MaxDaily > 0 && p.spent(asset)+amount > limits.MaxDaily {
+		return nil, violation(RuleMaxDaily, "amount %d %s exceeds 24h limit (%d of %d spent)",
+			amount, asset, p.spent(asset), limits.MaxDaily)
+	}
+	s := &policySpend{
+		Time:   now,
+		Asset:  asset,
+		Amount: amount,
+	}
+	p.spends = append(p.spends, s)
+	if err := p.save(); err != nil {
+		p.spends = p.spends[:len(p.spends)-1]
+		return nil, err
+	}
+	return s, nil
+}
+
+// release a reserved spend (operation failed)
+func (p *Policy) release(s *policySpend) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for i, e := range p.spends {
+		if e == s {
+			p.spends = append(p.spends[:i], p.spends[i+1:]...)
+			break
+		}
+	}
+	return p.save()
+}
+
+//----------------------------------------------------------------------
+// Helper methods
+//----------------------------------------------------------------------
+
+// ParseUnits parses a decimal amount string (with '.' or ',' as decimal
+// separator) into an integer number of units with given decimals (e.g.
+// "0.5" with 8 decimals is 50000000 satoshis).
+func ParseUnits(s string, decimals int) (uint64, error) {
+	s = strings.Replace(strings.TrimSpace(s), ",", ".", 1)
+	parts := strings.SplitN(s, ".", 2)
+	frac := ""
+	if len(parts) == 2 {
+		frac = parts[1]
+	}
+	if len(parts[0]) == 0 && len(frac) == 0 {
+		return 0, violation(RuleAmount, "missing amount")
+	}
+	if len(frac) > decimals {
+		return 0, violation(RuleAmount, "too many decimals in '%s'", s)
+	}
+	frac += strings.Repeat("0", decimals-len(frac))
+	v, err := strconv.ParseUint(parts[0]+frac, 10, 64)
+	if err != nil {
+		return 0, violation(RuleAmount, "invalid amount '%s'", s)
+	}
+	return v, nil
+}
+
+// feeRate returns the fee rate used for a transaction: an explicit rate
+// or the current rate of the daemon.
+func (c *Client) feeRate(ctx context.Context, rate string) (uint64, error) {
+	if len(rate) > 0 {
+		return strconv.ParseUint(rate, 10, 64)
+	}
+	info, err := c.GetTxFeeRate(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if info.UseCustomTxFeeRate {
+		return info.CustomTxFeeRate, nil
+	}
+	return info.FeeServiceRate, nil
+}
+
+// policyCheck reserves a spend in the client policy.
+func (c *Client) policyCheck(ctx context.Context, asset, addr string, amount uint64, rate, memo string, needMemo bool) (s *policySpend, err error) {
+	var fee uint64
+	if c.policy.cfg.MaxFeeRate > 0 {
+		if fee, err = c.feeRate(ctx, rate); err != nil {
+			return
+		}
+	}
+	return c.policy.reserve(asset, addr, amount, fee, memo, needMemo)
+}
+
+// policyRelease releases a reserved spend (if any) after a failed
+// operation. The spend stays reserved unless the daemon rejected the
+// operation: after a timeout or a lost connection the transaction might
+// have been broadcast. Returns the error of the operation (and of saving
+// the policy state).
+func (c *Client) policyRelease(s *policySpend, opErr error) error {
+	if s == nil || !rejected(opErr) {
+		return opErr
+	}
+	if err := c.policy.release(s); err != nil {
+		return errors.Join(opErr, err)
+	}
+	return opErr
+}
+
+// rejected returns true if the daemon rejected an operation (and nothing
+// was sent).
+func rejected(err error) bool {
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.InvalidArgument, codes.FailedPrecondition, codes.PermissionDenied,
+			codes.Unauthenticated, codes.NotFound:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseUnits(t *testing.T) {
+	for _, tc := range []struct {
+		s   string
+		dec int
+		v   uint64
+	}{
+		{"0.5", 8, 50000000},
+		{"1", 8, 100000000},
+		{"0.00000001", 8, 1},
+		{"12,34", 2, 1234},
+	} {
+		v, err := ParseUnits(tc.s, tc.dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != tc.v {
+			t.Fatalf("'%s': expected %d, got %d", tc.s, tc.v, v)
+		}
+	}
+	if _, err := ParseUnits("0.000000001", 8); err == nil {
+		t.Fatal("too many decimals accepted")
+	}
+	for _, in := range []string{"", "  ", "."} {
+		var pv *PolicyViolationError
+		if _, err := ParseUnits(in, 8); !errors.As(err, &pv) || pv.Rule != RuleAmount {
+			t.Fatalf("empty amount '%s' accepted: %v", in, err)
+		}
+	}
+}
+
+func TestPolicyRules(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "policy.json")
+	cfg := &PolicyConfig{
+		BTC:         PolicyLimits{MaxPerTx: 1000, MaxDaily: 1500},
+		Allowlist:   []string{"bc1qcold"},
+		MaxFeeRate:  50,
+		RequireMemo: true,
+		StatePath:   state,
+	}
+	p, err := NewPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := func(err error) string {
+		var pv *PolicyViolationError
+		if errors.As(err, &pv) {
+			return pv.Rule
+		}
+		return ""
+	}
+	if _, err = p.reserve(AssetBTC, "bc1qother", 100, 10, "memo", true); rule(err) != RuleAllowlist {
+		t.Fatalf("expected allowlist violation: %v", err)
+	}
+	if _, err = p.reserve(AssetBTC, "bc1qcold", 100, 10, "", true); rule(err) != RuleMemo {
+		t.Fatalf("expected memo violation: %v", err)
+	}
+	if _, err = p.reserve(AssetBTC, "bc1qcold", 100, 60, "memo", true); rule(err) != RuleMaxFeeRate {
+		t.Fatalf("expected fee rate violation: %v", err)
+	}
+	if _, err = p.reserve(AssetBTC, "bc1qcold", 1001, 10, "memo", true); rule(err) != RuleMaxPerTx {
+		t.Fatalf("expected per-tx violation: %v", err)
+	}
+	if _, err = p.reserve(AssetBTC, "bc1qcold", 1000, 10, "memo", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.reserve(AssetBTC, "bc1qcold", 600, 10, "memo", true); rule(err) != RuleMaxDaily {
+		t.Fatalf("expected daily violation: %v", err)
+	}
+	// released spends are not counted
+	s, err := p.reserve(AssetBTC, "bc1qcold", 400, 10, "memo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.release(s); err != nil {
+		t.Fatal(err)
+	}
+	// limits persist across restarts
+	if p, err = NewPolicy(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if p.Spent(AssetBTC) != 1000 {
+		t.Fatalf("unexpected spent amount %d", p.Spent(AssetBTC))
+	}
+}
+
+func TestPolicyRelease(t *testing.T) {
+	p, err := NewPolicy(&PolicyConfig{StatePath: filepath.Join(t.TempDir(), "policy.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{policy: p}
+	for _, tc := range []struct {
+		err   error
+		spent uint64
+	}{
+		// the transaction might have been sent
+		{status.Error(codes.DeadlineExceeded, "timeout"), 100},
+		{status.Error(codes.Unavailable, "connection lost"), 200},
+		{context.Canceled, 300},
+		// rejected by the daemon
+		{status.Error(codes.InvalidArgument, "bad address"), 300},
+		{status.Error(codes.FailedPrecondition, "insufficient funds"), 300},
+	} {
+		s, err := p.reserve(AssetBTC, "bc1qcold", 100, 0, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.policyRelease(s, tc.err); err != tc.err {
+			t.Fatalf("wrong error: %v", err)
+		}
+		if p.Spent(AssetBTC) != tc.spent {
+			t.Fatalf("%v: spent %d", tc.err, p.Spent(AssetBTC))
+		}
+	}
+}
+
+func TestPolicyFeeRate(t *testing.T) {
+	needDaemon(t)
+	rate, err := testClient.feeRate(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Effective fee rate: %d sats/vbyte\n", rate)
+}
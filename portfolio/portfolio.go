@@ -0,0 +1,351 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+// Package portfolio keeps track of positions and profits of a Bisq node:
+// realized P&L per currency and payment method (from lot matching of the
+// trade history), unrealized P&L of open positions marked to market
+// prices, fees paid in BTC and BSQ and wallet balances. Snapshots are
+// persisted to chart the performance over time.
+package portfolio
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"github.com/bfix/bisquit/tax"
+)
+
+// Balances of the wallet (in sats and BSQ units)
+type Balances struct {
+	BtcAvailable uint64 `json:"btcAvailable"` // available BTC
+	BtcReserved  uint64 `json:"btcReserved"`  // BTC reserved for offers
+	BtcLocked    uint64 `json:"btcLocked"`    // BTC locked in trades
+	BsqAvailable uint64 `json:"bsqAvailable"` // confirmed BSQ
+	BsqPending   uint64 `json:"bsqPending"`   // unverified and unconfirmed BSQ
+	BsqLocked    uint64 `json:"bsqLocked"`    // BSQ locked in votes and bonds
+}
+
+// BTC returns the total BTC balance.
+func (b *Balances) BTC() uint64 {
+	return b.BtcAvailable + b.BtcReserved + b.BtcLocked
+}
+
+// BSQ returns the total BSQ balance.
+func (b *Balances) BSQ() uint64 {
+	return b.BsqAvailable + b.BsqPending + b.BsqLocked
+}
+
+// NewBalances converts the balances reported by the daemon.
+func NewBalances(bi *bisquit.BalancesInfo) *Balances {
+	return &Balances{
+		BtcAvailable: bi.Btc.GetAvailableBalance(),
+		BtcReserved:  bi.Btc.GetReservedBalance(),
+		BtcLocked:    bi.Btc.GetLockedBalance(),
+		BsqAvailable: bi.Bsq.GetAvailableConfirmedBalance(),
+		BsqPending:   bi.Bsq.GetUnverifiedBalance() + bi.Bsq.GetUnconfirmedChangeBalance(),
+		BsqLocked: bi.Bsq.GetLockedForVotingBalance() + bi.Bsq.GetLockupBondsBalance() +
+			bi.Bsq.GetUnlockingBondsBalance(),
+	}
+}
+
+// Position is the BTC held from trades in a counter currency
+type Position struct {
+	Currency   string  `json:"currency"`   // counter currency
+	Amount     uint64  `json:"amount"`     // BTC from open lots (sats)
+	Cost       float64 `json:"cost"`       // cost basis of open lots
+	AvgPrice   float64 `json:"avgPrice"`   // average purchase price
+	Price      float64 `json:"price"`      // market price (0 = unknown)
+	Value      float64 `json:"value"`      // market value
+	Unrealized float64 `json:"unrealized"` // market value minus cost
+}
+
+// PnL is the realized profit in a currency for a payment method
+type PnL struct {
+	Currency string  `json:"currency"` // counter currency
+	Method   string  `json:"method"`   // payment method
+	Trades   int     `json:"trades"`   // number of sales
+	Amount   uint64  `json:"amount"`   // sold BTC (sats)
+	Proceeds float64 `json:"proceeds"` // net proceeds
+	Cost     float64 `json:"cost"`     // cost basis
+	Realized float64 `json:"realized"` // proceeds minus cost
+}
+
+// Fees paid in trades
+type Fees struct {
+	TradeBtc uint64 `json:"tradeBtc"` // trade fees paid in BTC (sats)
+	TradeBsq uint64 `json:"tradeBsq"` // trade fees paid in BSQ (units)
+	Mining   uint64 `json:"mining"`   // mining fees (sats)
+}
+
+// Snapshot of the portfolio
+type Snapshot struct {
+	Time      time.Time          `json:"time"`      // time of snapshot
+	Balances  *Balances          `json:"balances"`  // wallet balances
+	Prices    map[string]float64 `json:"prices"`    // market prices
+	Positions []*Position        `json:"positions"` // open positions
+	Realized  []*PnL             `json:"realized"`  // realized P&L
+	Fees      *Fees              `json:"fees"`      // fees paid
+	Trades    int                `json:"trades"`    // number of closed trades
+}
+
+// RealizedIn returns the total realized P&L in a currency.
+func (s *Snapshot) RealizedIn(curr string) (sum float64) {
+	for _, p := range s.Realized {
+		if p.Currency == curr {
+			sum += p.Realized
+		}
+	}
+	return
+}
+
+// UnrealizedIn returns the unrealized P&L in a currency.
+func (s *Snapshot) UnrealizedIn(curr string) float64 {
+	for _, p := range s.Positions {
+		if p.Currency == curr {
+			return p.Unrealized
+		}
+	}
+	return 0
+}
+
+// fiat returns true if a record is a trade against a fiat currency
+// (altcoins are traded against BTC as counter currency).
+func fiat(r *tax.Record) bool {
+	return len(r.Currency) > 0 && r.Currency != "BTC"
+}
+
+// Compute a snapshot from trade records, balances and market prices
+// (counter currency per BTC). Lots are matched with the given method;
+// records of non-fiat trades are ignored. Positions in currencies without
+// a market price are not marked to market (price 0).
+func Compute(records []*tax.Record, bal *Balances, prices map[string]float64, method string, now time.Time) (*Snapshot, error) {
+	var list []*tax.Record
+	for _, r := range records {
+		if fiat(r) {
+			list = append(list, r)
+		}
+	}
+	records = list
+	disposals, lots, err := tax.Match(records, method)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		Time:     now,
+		Balances: bal,
+		Prices:   prices,
+		Fees:     new(Fees),
+	}
+	// fees and payment methods of trades
+	methods := make(map[string]string)
+	for _, r := range records {
+		methods[r.TradeID] = r.Method
+		if r.Status == tax.StatusClosed {
+			s.Trades++
+		}
+		if r.FeeCurrency == "BSQ" {
+			s.Fees.TradeBsq += r.TradeFee
+		} else {
+			s.Fees.TradeBtc += r.TradeFee
+		}
+		s.Fees.Mining += r.TxFee
+	}
+	// realized P&L per currency and payment method
+	pnl := make(map[[2]string]*PnL)
+	for _, d := range disposals {
+		key := [2]string{d.Currency, methods[d.TradeID]}
+		p, ok := pnl[key]
+		if !ok {
+			p = &PnL{Currency: key[0], Method: key[1]}
+			pnl[key] = p
+			s.Realized = append(s.Realized, p)
+		}
+		p.Trades++
+		p.Amount += d.Amount
+		p.Proceeds += d.Proceeds
+		p.Cost += d.Cost
+		p.Realized += d.Gain
+	}
+	sort.Slice(s.Realized, func(i, j int) bool {
+		if s.Realized[i].Currency == s.Realized[j].Currency {
+			return s.Realized[i].Method < s.Realized[j].Method
+		}
+		return s.Realized[i].Currency < s.Realized[j].Currency
+	})
+	// open positions
+	pos := make(map[string]*Position)
+	for _, l := range lots {
+		p, ok := pos[l.Currency]
+		if !ok {
+			p = &Position{Currency: l.Currency}
+			pos[l.Currency] = p
+			s.Positions = append(s.Positions, p)
+		}
+		p.Amount += l.Amount
+		p.Cost += l.Cost
+	}
+	for _, p := range s.Positions {
+		if p.Amount > 0 {
+			p.AvgPrice = p.Cost / (float64(p.Amount) / 1e8)
+		}
+		if price, ok := prices[p.Currency]; ok {
+			p.Price = price
+			p.Value = float64(p.Amount) / 1e8 * price
+			p.Unrealized = p.Value - p.Cost
+		}
+	}
+	sort.Slice(s.Positions, func(i, j int) bool {
+		return s.Positions[i].Currency < s.Positions[j].Currency
+	})
+	return s, nil
+}
+
+//----------------------------------------------------------------------
+// Tracker with persistent snapshots
+//----------------------------------------------------------------------
+
+// Tracker takes snapshots of the portfolio of a node and appends them to
+// a journal file (JSON lines).
+type Tracker struct {
+	client *bisquit.Client // client for API calls
+	path   string          // journal file
+	method string          // lot matching method
+	opts   *tax.Options    // options for trade records
+	mtx    sync.Mutex      // serialize journal access
+}
+
+// NewTracker creates a new tracker with a journal file and a lot matching
+// method (tax.FIFO or tax.LIFO).
+func NewTracker(c *bisquit.Client, path, method string, opts *tax.Options) (*Tracker, error) {
+	if method != tax.FIFO && method != tax.LIFO {
+		return nil, tax.ErrTaxMethod
+	}
+	return &Tracker{
+		client: c,
+		path:   path,
+		method: method,
+		opts:   opts,
+	}, nil
+}
+
+// Snapshot computes the current portfolio and appends it to the journal.
+// Positions are marked to the market prices of their currencies; if a
+// price is not available, the position is listed without market value.
+func (t *Tracker) Snapshot(ctx context.Context) (*Snapshot, error) {
+	h, err := tax.Collect(ctx, t.client, t.opts)
+	if err != nil {
+		return nil, err
+	}
+	bi, err := t.client.GetBalances(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	prices := make(map[string]float64)
+	for _, r := range h.Records {
+		if _, ok := prices[r.Currency]; ok || r.Status != tax.StatusClosed || !fiat(r) {
+			continue
+		}
+		price, err := t.client.GetMarketPrice(ctx, r.Currency)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		prices[r.Currency] = price
+	}
+	s, err := Compute(h.Records, NewBalances(bi), prices, t.method, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return s, t.append(s)
+}
+
+// append a snapshot to the journal
+func (t *Tracker) append(s *Snapshot) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// History returns the snapshots in the period [from,to) from the journal;
+// zero times leave the period open.
+func (t *Tracker) History(from, to time.Time) ([]*Snapshot, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	f, err := os.Open(t.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var list []*Snapshot
+	rdr := bufio.NewScanner(f)
+	rdr.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for rdr.Scan() {
+		s := new(Snapshot)
+		if err = json.Unmarshal(rdr.Bytes(), s); err != nil {
+			return nil, err
+		}
+		if (!from.IsZero() && s.Time.Before(from)) || (!to.IsZero() && !s.Time.Before(to)) {
+			continue
+		}
+		list = append(list, s)
+	}
+	return list, rdr.Err()
+}
+
+// Run takes snapshots in given intervals until the context is cancelled.
+// Errors are passed to the callback (if defined).
+func (t *Tracker) Run(ctx context.Context, interval time.Duration, errCb func(error)) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		if _, err := t.Snapshot(ctx); err != nil && errCb != nil {
+			errCb(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,150 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package portfolio
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bfix/bisquit"
+	"github.com/bfix/bisquit/tax"
+)
+
+// base time of test trades
+var t0 = time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// record creates a closed trade record
+func record(id, side, curr, method string, amount uint64, basis float64, day int) *tax.Record {
+	return &tax.Record{
+		Time:        t0.AddDate(0, 0, day),
+		TradeID:     id,
+		Status:      tax.StatusClosed,
+		Side:        side,
+		Amount:      amount,
+		Currency:    curr,
+		Method:      method,
+		Basis:       basis,
+		TradeFee:    1000,
+		FeeCurrency: "BTC",
+		TxFee:       500,
+	}
+}
+
+var records = []*tax.Record{
+	record("b1", tax.SideBuy, "EUR", "SEPA", 10000000, 3000, 0),
+	record("b2", tax.SideBuy, "EUR", "SEPA", 10000000, 3500, 1),
+	record("s1", tax.SideSell, "EUR", "REVOLUT", 5000000, 2000, 2),
+	record("s2", tax.SideSell, "EUR", "SEPA", 10000000, 4000, 3),
+	func() *tax.Record {
+		r := record("b3", tax.SideBuy, "USD", "ZELLE", 20000000, 6000, 4)
+		r.FeeCurrency = "BSQ"
+		return r
+	}(),
+}
+
+func TestCompute(t *testing.T) {
+	bal := NewBalances(&bisquit.BalancesInfo{
+		Btc: &bisquit.BtcBalanceInfo{AvailableBalance: 1000, ReservedBalance: 200, LockedBalance: 30},
+		Bsq: &bisquit.BsqBalanceInfo{AvailableConfirmedBalance: 100, UnverifiedBalance: 10, LockupBondsBalance: 1},
+	})
+	if bal.BTC() != 1230 || bal.BSQ() != 111 {
+		t.Fatalf("wrong balances: %+v", bal)
+	}
+	prices := map[string]float64{"EUR": 40000}
+	s, err := Compute(records, bal, prices, tax.FIFO, t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Trades != 5 || s.Fees.TradeBtc != 4000 || s.Fees.TradeBsq != 1000 || s.Fees.Mining != 2500 {
+		t.Fatalf("wrong fees: %+v", s.Fees)
+	}
+	// FIFO: s1 sells half of b1 (cost 1500), s2 sells rest of b1 and half of b2 (cost 1500+1750)
+	if len(s.Realized) != 2 || s.Realized[0].Method != "REVOLUT" || s.Realized[0].Realized != 500 ||
+		s.Realized[1].Method != "SEPA" || s.Realized[1].Realized != 750 {
+		t.Fatalf("wrong P&L: %+v %+v", s.Realized[0], s.Realized[1])
+	}
+	if s.RealizedIn("EUR") != 1250 || s.RealizedIn("USD") != 0 {
+		t.Fatal("wrong realized total")
+	}
+	// open: half of b2 (5000000 sats, cost 1750) and b3 (no price)
+	if len(s.Positions) != 2 {
+		t.Fatalf("wrong positions: %v", s.Positions)
+	}
+	eur, usd := s.Positions[0], s.Positions[1]
+	if eur.Amount != 5000000 || eur.Cost != 1750 || eur.AvgPrice != 35000 ||
+		eur.Value != 2000 || eur.Unrealized != 250 || s.UnrealizedIn("EUR") != 250 {
+		t.Fatalf("wrong EUR position: %+v", eur)
+	}
+	if usd.Amount != 20000000 || usd.Price != 0 || usd.Unrealized != 0 {
+		t.Fatalf("wrong USD position: %+v", usd)
+	}
+
+	// LIFO: s1 sells half of b2 (cost 1750), s2 sells rest of b2 and half of b1 (1750+1500)
+	if s, err = Compute(records, bal, prices, tax.LIFO, t0); err != nil {
+		t.Fatal(err)
+	}
+	if s.RealizedIn("EUR") != 1000 || math.Abs(s.UnrealizedIn("EUR")-500) > 1e-9 {
+		t.Fatalf("wrong LIFO P&L: %f %f", s.RealizedIn("EUR"), s.UnrealizedIn("EUR"))
+	}
+
+	// altcoin trades (BTC as counter currency) are ignored
+	xmr := record("x1", tax.SideBuy, "BTC", "BLOCK_CHAINS", 10000000, 0.6, 5)
+	if s, err = Compute(append([]*tax.Record{xmr}, records...), bal, prices, tax.FIFO, t0); err != nil {
+		t.Fatal(err)
+	}
+	if s.Trades != 5 || len(s.Positions) != 2 || s.Positions[0].Currency != "EUR" {
+		t.Fatalf("altcoin trade not ignored: %+v", s.Positions)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	if _, err := NewTracker(nil, "", "hifo", nil); err != tax.ErrTaxMethod {
+		t.Fatal("unknown method accepted")
+	}
+	path := filepath.Join(t.TempDir(), "snapshots.jsonl")
+	c := bisquit.NewClient("localhost:9998", "secret", time.Second)
+	tr, err := NewTracker(c, path, tax.FIFO, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tr.Snapshot(context.Background()); err != bisquit.ErrClientNotConnected {
+		t.Fatalf("wrong error: %v", err)
+	}
+	list, err := tr.History(time.Time{}, time.Time{})
+	if err != nil || len(list) != 0 {
+		t.Fatalf("wrong history: %v (%v)", list, err)
+	}
+	for day := 0; day < 3; day++ {
+		s, _ := Compute(records, &Balances{}, map[string]float64{"EUR": 40000}, tax.FIFO, t0.AddDate(0, 0, day))
+		if err = tr.append(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if list, err = tr.History(t0.AddDate(0, 0, 1), time.Time{}); err != nil || len(list) != 2 {
+		t.Fatalf("wrong history: %v (%v)", list, err)
+	}
+	if !list[0].Time.Equal(t0.AddDate(0, 0, 1)) || list[0].RealizedIn("EUR") != 1250 {
+		t.Fatalf("wrong snapshot: %+v", list[0])
+	}
+}
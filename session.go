@@ -0,0 +1,236 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Error codes
+var (
+	ErrSecretEmpty = fmt.Errorf("Empty secret")
+)
+
+//----------------------------------------------------------------------
+// Secret sources
+//----------------------------------------------------------------------
+
+// SecretSource provides a secret (like the wallet password) on demand.
+// The caller wipes the returned buffer after use.
+type SecretSource interface {
+	Secret(ctx context.Context) ([]byte, error)
+}
+
+// EnvSecret reads the secret from the named environment variable.
+type EnvSecret string
+
+// Secret returns the value of the environment variable
+func (s EnvSecret) Secret(ctx context.Context) ([]byte, error) {
+	val, ok := os.LookupEnv(string(s))
+	if !ok || len(val) == 0 {
+		return nil, ErrSecretEmpty
+	}
+	return []byte(val), nil
+}
+
+// FileSecret reads the secret from the named file (trailing line breaks
+// are removed).
+type FileSecret string
+
+// Secret returns the content of the file
+func (s FileSecret) Secret(ctx context.Context) ([]byte, error) {
+	data, err := os.ReadFile(string(s))
+	if err != nil {
+		return nil, err
+	}
+	secret := bytes.TrimRight(data, "\r\n")
+	if len(secret) == 0 {
+		return nil, ErrSecretEmpty
+	}
+	return secret, nil
+}
+
+// SecretFunc is a callback function implementing the SecretSource interface
+type SecretFunc func(ctx context.Context) ([]byte, error)
+
+// Secret returns the result of the callback
+func (f SecretFunc) Secret(ctx context.Context) ([]byte, error) {
+	return f(ctx)
+}
+
+// Wipe overwrites a secret buffer with zeros.
+func Wipe(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+//----------------------------------------------------------------------
+// Wallet session
+//----------------------------------------------------------------------
+
+// walletLocker locks and unlocks an encrypted wallet (implemented by
+// Client).
+type walletLocker interface {
+	UnlockWallet(ctx context.Context, passwd string, timeout uint64) error
+	LockWallet(ctx context.Context) error
+}
+
+// WalletSession unlocks an encrypted wallet for scoped operations. The
+// wallet stays unlocked as long as at least one operation is active; the
+// unlock period is extended for long-running operations and the wallet
+// is locked again when the last operation ends. The wallet password is
+// requested from the secret source on every unlock and never stored.
+type WalletSession struct {
+	client  walletLocker  // client for API calls
+	src     SecretSource  // source of wallet password
+	period  time.Duration // unlock period
+	users   int           // number of active operations
+	expires time.Time     // time the daemon locks the wallet
+	stop    chan struct{} // stop signal for refresher
+	mtx     sync.Mutex    // serialize access
+}
+
+// NewWalletSession creates a new session manager. The wallet is unlocked
+// for the given period (at least 10 seconds) and extended as needed.
+func NewWalletSession(c *Client, src SecretSource, period time.Duration) *WalletSession {
+	if period < 10*time.Second {
+		period = 10 * time.Second
+	}
+	return &WalletSession{
+		client: c,
+		src:    src,
+		period: period,
+	}
+}
+
+// Users returns the number of active operations.
+func (s *WalletSession) Users() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.users
+}
+
+// unlock the wallet for the session period and return the time the
+// daemon locks the wallet again.
+func (s *WalletSession) unlock(ctx context.Context) (time.Time, error) {
+	passwd, err := s.src.Secret(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer Wipe(passwd)
+	expires := time.Now().Add(s.period)
+	secs := uint64(s.period / time.Second)
+	if err = s.client.UnlockWallet(ctx, string(passwd), secs); err != nil {
+		return time.Time{}, err
+	}
+	return expires, nil
+}
+
+// acquire the unlocked wallet for an operation
+func (s *WalletSession) acquire(ctx context.Context) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	// unlock (or extend) if no operation is active or the unlock
+	// period is about to end.
+	if s.users == 0 || time.Until(s.expires) < s.period/2 {
+		expires, err := s.unlock(ctx)
+		if err != nil {
+			return err
+		}
+		s.expires = expires
+	}
+	s.users++
+	if s.users == 1 {
+		s.stop = make(chan struct{})
+		go s.refresh(s.stop)
+	}
+	return nil
+}
+
+// release the wallet after an operation; the last user locks the wallet
+// (even if the context of the operation is already cancelled).
+func (s *WalletSession) release() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.users--
+	if s.users > 0 {
+		return nil
+	}
+	close(s.stop)
+	s.expires = time.Time{}
+	return s.client.LockWallet(context.Background())
+}
+
+// refresh extends the unlock period while operations are active. The
+// wallet is unlocked without holding the session lock, so operations
+// can start and end during the call; if the session ended in the
+// meantime, the wallet is locked again.
+func (s *WalletSession) refresh(stop chan struct{}) {
+	tick := time.NewTicker(s.period / 4)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			s.mtx.Lock()
+			due := s.users > 0 && s.stop == stop && time.Until(s.expires) < s.period/2
+			s.mtx.Unlock()
+			if !due {
+				continue
+			}
+			// errors are handled by the next operation
+			expires, err := s.unlock(context.Background())
+			if err != nil {
+				continue
+			}
+			s.mtx.Lock()
+			if s.users > 0 && s.stop == stop {
+				if expires.After(s.expires) {
+					s.expires = expires
+				}
+			} else if s.users == 0 {
+				s.client.LockWallet(context.Background())
+			}
+			s.mtx.Unlock()
+		}
+	}
+}
+
+// WithUnlocked runs the function with an unlocked wallet. The wallet is
+// locked again when no other operation is active.
+func (s *WalletSession) WithUnlocked(ctx context.Context, fn func() error) (err error) {
+	if err = s.acquire(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if rErr := s.release(); err == nil {
+			err = rErr
+		}
+	}()
+	return fn()
+}
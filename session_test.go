@@ -0,0 +1,167 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSecretSources(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("BISQUIT_TEST_SECRET", "env-secret")
+	secret, err := EnvSecret("BISQUIT_TEST_SECRET").Secret(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != "env-secret" {
+		t.Fatalf("unexpected secret '%s'", secret)
+	}
+	Wipe(secret)
+	for _, b := range secret {
+		if b != 0 {
+			t.Fatal("secret not wiped")
+		}
+	}
+	if _, err = EnvSecret("BISQUIT_TEST_UNDEFINED").Secret(ctx); err != ErrSecretEmpty {
+		t.Fatal("expected empty secret")
+	}
+	path := filepath.Join(t.TempDir(), "passwd")
+	if err = os.WriteFile(path, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err = FileSecret(path).Secret(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != "file-secret" {
+		t.Fatalf("unexpected secret '%s'", secret)
+	}
+}
+
+func TestWalletSession(t *testing.T) {
+	needDaemon(t)
+	passwd := os.Getenv("BISQ_WALLET_PASSWORD")
+	if len(passwd) == 0 {
+		t.Skip("'BISQ_WALLET_PASSWORD' not defined")
+	}
+	calls := 0
+	src := SecretFunc(func(context.Context) ([]byte, error) {
+		calls++
+		return []byte(passwd), nil
+	})
+	sess := NewWalletSession(testClient, src, time.Minute)
+	err := sess.WithUnlocked(context.Background(), func() error {
+		return sess.WithUnlocked(context.Background(), func() error {
+			if sess.Users() != 2 {
+				t.Fatalf("unexpected number of users: %d", sess.Users())
+			}
+			_, err := testClient.GetBalances(context.Background(), "BTC")
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 || sess.Users() != 0 {
+		t.Fatalf("unexpected session state: %d unlocks, %d users", calls, sess.Users())
+	}
+}
+
+// fakeWallet counts lock and unlock calls; unlocks after the first one
+// are blocked until released.
+type fakeWallet struct {
+	unlocks, locks int
+	entered        chan struct{} // refresh unlock started
+	block          chan struct{} // release blocked unlock
+	mtx            sync.Mutex
+}
+
+func (w *fakeWallet) UnlockWallet(ctx context.Context, passwd string, timeout uint64) error {
+	w.mtx.Lock()
+	w.unlocks++
+	n := w.unlocks
+	w.mtx.Unlock()
+	if n > 1 {
+		w.entered <- struct{}{}
+		<-w.block
+	}
+	return nil
+}
+
+func (w *fakeWallet) LockWallet(ctx context.Context) error {
+	w.mtx.Lock()
+	w.locks++
+	w.mtx.Unlock()
+	return nil
+}
+
+func (w *fakeWallet) count() (int, int) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.unlocks, w.locks
+}
+
+func TestWalletSessionRefresh(t *testing.T) {
+	wallet := &fakeWallet{
+		entered: make(chan struct{}),
+		block:   make(chan struct{}),
+	}
+	src := SecretFunc(func(context.Context) ([]byte, error) {
+		return []byte("secret"), nil
+	})
+	sess := &WalletSession{client: wallet, src: src, period: 40 * time.Millisecond}
+	done := make(chan error)
+	go func() {
+		done <- sess.WithUnlocked(context.Background(), func() error {
+			// the session is not blocked by a running refresh
+			<-wallet.entered
+			if n := sess.Users(); n != 1 {
+				t.Errorf("unexpected number of users: %d", n)
+			}
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session blocked by refresh")
+	}
+	if unlocks, locks := wallet.count(); unlocks != 2 || locks != 1 {
+		t.Fatalf("unexpected calls: %d unlocks, %d locks", unlocks, locks)
+	}
+	// session ended during refresh: the wallet is locked again
+	close(wallet.block)
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		if _, locks := wallet.count(); locks == 2 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("wallet not locked after refresh")
+		}
+	}
+}
@@ -0,0 +1,314 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+// Package store reads the files in the "db/" folder of a Bisq data
+// directory without a running daemon. Each file holds a single
+// PersistableEnvelope message (length-delimited).
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bfix/bisquit"
+	"google.golang.org/protobuf/proto"
+)
+
+// Error codes
+var (
+	ErrStoreType = fmt.Errorf("Unexpected envelope type")
+	ErrStoreNoDB = fmt.Errorf("No db folder found")
+)
+
+// Network folders in the Bisq application directory
+const (
+	MainNet = "btc_mainnet"
+	TestNet = "btc_testnet"
+	RegTest = "btc_regtest"
+)
+
+// Names of db files
+const (
+	FileTradeStatistics  = "TradeStatistics3Store"
+	FileAccountAge       = "AccountAgeWitnessStore"
+	FileSignedWitness    = "SignedWitnessStore"
+	FileUser             = "UserPayload"
+	FilePreferences      = "PreferencesPayload"
+	FileAddressEntries   = "AddressEntryList"
+	FileOpenOffers       = "OpenOffers"
+	FilePendingTrades    = "PendingTrades"
+	FileClosedTrades     = "ClosedTrades"
+	FileFailedTrades     = "FailedTrades"
+	FileBsqSwapTrades    = "BsqSwapTrades"
+	FileSequenceNumbers  = "SequenceNumberMap"
+	FileNavigationPath   = "NavigationPath"
+	FileMediationDispute = "MediationDisputeList"
+	FileRefundDispute    = "RefundDisputeList"
+)
+
+// DefaultAppDir returns the default Bisq application directory.
+func DefaultAppDir() string {
+	return bisquit.DefaultDataDir()
+}
+
+//----------------------------------------------------------------------
+// Envelope decoding
+//----------------------------------------------------------------------
+
+// Decode a PersistableEnvelope. Bisq writes envelopes with a varint length
+// prefix; data without prefix is accepted too.
+func Decode(data []byte) (*bisquit.PersistableEnvelope, error) {
+	if size, n := binary.Uvarint(data); n > 0 && uint64(len(data)-n) == size {
+		data = data[n:]
+	}
+	env := new(bisquit.PersistableEnvelope)
+	if err := proto.Unmarshal(data, env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// Encode a PersistableEnvelope with length prefix (as written by Bisq).
+func Encode(env *bisquit.PersistableEnvelope) ([]byte, error) {
+	data, err := proto.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	var hdr [binary.MaxVarintLen64]byte
+	buf.Write(hdr[:binary.PutUvarint(hdr[:], uint64(len(data)))])
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// ReadFile reads an envelope from file.
+func ReadFile(path string) (*bisquit.PersistableEnvelope, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+//----------------------------------------------------------------------
+// Store (db folder)
+//----------------------------------------------------------------------
+
+// Store is the db folder of a Bisq node.
+type Store struct {
+	dir string // path to db folder
+}
+
+// Open a store. The path is either the db folder itself, a network folder
+// (like "btc_mainnet") or the application directory (mainnet is used).
+func Open(path string) (*Store, error) {
+	for _, dir := range []string{
+		path,
+		filepath.Join(path, "db"),
+		filepath.Join(path, MainNet, "db"),
+	} {
+		if filepath.Base(dir) != "db" {
+			continue
+		}
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return &Store{dir: dir}, nil
+		}
+	}
+	return nil, ErrStoreNoDB
+}
+
+// OpenNetwork opens the store of a network in the application directory.
+func OpenNetwork(appDir, network string) (*Store, error) {
+	return Open(filepath.Join(appDir, network, "db"))
+}
+
+// Dir returns the path of the db folder.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Files returns the names of all files in the db folder.
+func (s *Store) Files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, e := range entries {
+		// skip backups and temporary files
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		list = append(list, e.Name())
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// Read the envelope in a db file.
+func (s *Store) Read(name string) (*bisquit.PersistableEnvelope, error) {
+	return ReadFile(filepath.Join(s.dir, name))
+}
+
+// typeError returns an error for an unexpected envelope type
+func typeError(name string) error {
+	return fmt.Errorf("%w in '%s'", ErrStoreType, name)
+}
+
+// TradeStatistics returns the trade statistics of the node: the live
+// store and all historical stores ("TradeStatistics3Store_<version>_...")
+// found in the db folder; duplicates are removed.
+func (s *Store) TradeStatistics() ([]*bisquit.TradeStatistics3, error) {
+	files, err := s.Files()
+	if err != nil {
+		return nil, err
+	}
+	var list []*bisquit.TradeStatistics3
+	seen := make(map[string]bool)
+	for _, name := range files {
+		if name != FileTradeStatistics && !strings.HasPrefix(name, FileTradeStatistics+"_") {
+			continue
+		}
+		env, err := s.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		st := env.GetTradeStatistics3Store()
+		if st == nil {
+			return nil, typeError(name)
+		}
+		for _, item := range st.Items {
+			key := string(item.Hash)
+			if len(key) > 0 && seen[key] {
+				continue
+			}
+			seen[key] = true
+			list = append(list, item)
+		}
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("%s: %w", FileTradeStatistics, os.ErrNotExist)
+	}
+	return list, nil
+}
+
+// User returns the user payload.
+func (s *Store) User() (*bisquit.UserPayload, error) {
+	env, err := s.Read(FileUser)
+	if err != nil {
+		return nil, err
+	}
+	if env.GetUserPayload() == nil {
+		return nil, typeError(FileUser)
+	}
+	return env.GetUserPayload(), nil
+}
+
+// PaymentAccounts returns the payment accounts of the user.
+func (s *Store) PaymentAccounts() ([]*bisquit.PaymentAccount, error) {
+	user, err := s.User()
+	if err != nil {
+		return nil, err
+	}
+	return user.PaymentAccounts, nil
+}
+
+// Preferences returns the user preferences.
+func (s *Store) Preferences() (*bisquit.PreferencesPayload, error) {
+	env, err := s.Read(FilePreferences)
+	if err != nil {
+		return nil, err
+	}
+	if env.GetPreferencesPayload() == nil {
+		return nil, typeError(FilePreferences)
+	}
+	return env.GetPreferencesPayload(), nil
+}
+
+// AddressEntries returns the wallet address entries.
+func (s *Store) AddressEntries() ([]*bisquit.AddressEntry, error) {
+	env, err := s.Read(FileAddressEntries)
+	if err != nil {
+		return nil, err
+	}
+	if env.GetAddressEntryList() == nil {
+		return nil, typeError(FileAddressEntries)
+	}
+	return env.GetAddressEntryList().AddressEntry, nil
+}
+
+// Tradables returns the entries of a tradable list (FileOpenOffers,
+// FilePendingTrades, FileClosedTrades, FileFailedTrades or
+// FileBsqSwapTrades).
+func (s *Store) Tradables(name string) ([]*bisquit.Tradable, error) {
+	env, err := s.Read(name)
+	if err != nil {
+		return nil, err
+	}
+	if env.GetTradableList() == nil {
+		return nil, typeError(name)
+	}
+	return env.GetTradableList().Tradable, nil
+}
+
+// Trades returns the (v1 protocol) trades in a tradable list.
+func (s *Store) Trades(name string) ([]*bisquit.Trade, error) {
+	list, err := s.Tradables(name)
+	if err != nil {
+		return nil, err
+	}
+	var trades []*bisquit.Trade
+	for _, t := range list {
+		if trade := TradeOf(t); trade != nil {
+			trades = append(trades, trade)
+		}
+	}
+	return trades, nil
+}
+
+// TradeOf returns the trade in a tradable (or nil for offers and BSQ swaps).
+func TradeOf(t *bisquit.Tradable) *bisquit.Trade {
+	switch {
+	case t.GetBuyerAsMakerTrade() != nil:
+		return t.GetBuyerAsMakerTrade().Trade
+	case t.GetBuyerAsTakerTrade() != nil:
+		return t.GetBuyerAsTakerTrade().Trade
+	case t.GetSellerAsMakerTrade() != nil:
+		return t.GetSellerAsMakerTrade().Trade
+	case t.GetSellerAsTakerTrade() != nil:
+		return t.GetSellerAsTakerTrade().Trade
+	}
+	return nil
+}
+
+// Kind returns the name of the message type in an envelope (like
+// "TradeStatistics3Store").
+func Kind(env *bisquit.PersistableEnvelope) string {
+	od := env.ProtoReflect().WhichOneof(env.ProtoReflect().Descriptor().Oneofs().Get(0))
+	if od == nil {
+		return ""
+	}
+	return string(od.Message().Name())
+}
@@ -0,0 +1,144 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bfix/bisquit"
+	"google.golang.org/protobuf/proto"
+)
+
+// write an envelope to a db file
+func write(t *testing.T, dir, name string, env *bisquit.PersistableEnvelope) {
+	data, err := Encode(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stats returns a trade statistics envelope
+func stats(items ...*bisquit.TradeStatistics3) *bisquit.PersistableEnvelope {
+	return &bisquit.PersistableEnvelope{
+		Message: &bisquit.PersistableEnvelope_TradeStatistics3Store{
+			TradeStatistics3Store: &bisquit.TradeStatistics3Store{Items: items},
+		},
+	}
+}
+
+func TestStore(t *testing.T) {
+	app := t.TempDir()
+	db := filepath.Join(app, MainNet, "db")
+	if err := os.MkdirAll(db, 0700); err != nil {
+		t.Fatal(err)
+	}
+	t1 := &bisquit.TradeStatistics3{Currency: "EUR", Price: 300000000, Amount: 1000000, Hash: []byte{1}}
+	t2 := &bisquit.TradeStatistics3{Currency: "USD", Price: 310000000, Amount: 2000000, Hash: []byte{2}}
+	write(t, db, FileTradeStatistics, stats(t1, t2))
+	write(t, db, FileTradeStatistics+"_1.9.0_BTC_MAINNET", stats(t1))
+	write(t, db, FileUser, &bisquit.PersistableEnvelope{
+		Message: &bisquit.PersistableEnvelope_UserPayload{
+			UserPayload: &bisquit.UserPayload{
+				PaymentAccounts: []*bisquit.PaymentAccount{{Id: "acc1", AccountName: "SEPA"}},
+			},
+		},
+	})
+	trade := &bisquit.Trade{TradeAmountAsLong: 1000000}
+	write(t, db, FileClosedTrades, &bisquit.PersistableEnvelope{
+		Message: &bisquit.PersistableEnvelope_TradableList{
+			TradableList: &bisquit.TradableList{
+				Tradable: []*bisquit.Tradable{
+					{Message: &bisquit.Tradable_OpenOffer{OpenOffer: &bisquit.OpenOffer{}}},
+					{Message: &bisquit.Tradable_SellerAsTakerTrade{SellerAsTakerTrade: &bisquit.SellerAsTakerTrade{Trade: trade}}},
+				},
+			},
+		},
+	})
+
+	// open from application directory
+	s, err := Open(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Dir() != db {
+		t.Fatalf("wrong dir: %s", s.Dir())
+	}
+	if _, err = Open(filepath.Join(app, "unknown")); err != ErrStoreNoDB {
+		t.Fatal("missing db folder accepted")
+	}
+	files, err := s.Files()
+	if err != nil || len(files) != 4 {
+		t.Fatalf("wrong files: %v (%v)", files, err)
+	}
+
+	// typed access
+	list, err := s.TradeStatistics()
+	if err != nil || len(list) != 2 || !proto.Equal(list[0], t1) {
+		t.Fatalf("wrong statistics: %v (%v)", list, err)
+	}
+	accs, err := s.PaymentAccounts()
+	if err != nil || len(accs) != 1 || accs[0].Id != "acc1" {
+		t.Fatalf("wrong accounts: %v (%v)", accs, err)
+	}
+	trades, err := s.Trades(FileClosedTrades)
+	if err != nil || len(trades) != 1 || trades[0].TradeAmountAsLong != 1000000 {
+		t.Fatalf("wrong trades: %v (%v)", trades, err)
+	}
+	if _, err = s.Tradables(FileTradeStatistics); !errors.Is(err, ErrStoreType) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if _, err = s.Preferences(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	env, err := s.Read(FileUser)
+	if err != nil || Kind(env) != "UserPayload" {
+		t.Fatalf("wrong kind: %s (%v)", Kind(env), err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	env := stats(&bisquit.TradeStatistics3{Currency: "EUR", Price: 1})
+	data, err := proto.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without length prefix
+	res, err := Decode(data)
+	if err != nil || !proto.Equal(res, env) {
+		t.Fatalf("decode failed: %v", err)
+	}
+	// with length prefix
+	if data, err = Encode(env); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = Decode(data); err != nil || !proto.Equal(res, env) {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if _, err = Decode(data[:len(data)-1]); err == nil {
+		t.Fatal("truncated data accepted")
+	}
+}
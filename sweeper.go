@@ -0,0 +1,301 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Error codes
+var (
+	ErrSweepNoAddress = fmt.Errorf("No unused withdrawal address left")
+)
+
+// DefaultSweepMemo is the memo template used if none is specified.
+const DefaultSweepMemo = "Bisq trade {{.ShortId}}"
+
+// sweepPending marks journal entries of withdrawals in progress
+const sweepPending = "pending"
+
+// SweepEntry is a journal record of a withdrawal for a trade.
+type SweepEntry struct {
+	Time    time.Time `json:"time"`            // time of withdrawal
+	TradeID string    `json:"tradeId"`         // trade identifier
+	ShortID string    `json:"shortId"`         // short trade identifier
+	Address string    `json:"address"`         // withdrawal address
+	Memo    string    `json:"memo"`            // transaction memo
+	Amount  uint64    `json:"amount"`          // payout amount (satoshis)
+	Error   string    `json:"error,omitempty"` // error message of failed withdrawal
+}
+
+// LoadAddressList reads withdrawal addresses (one per line) from a file.
+// The list is usually exported from the cold storage wallet (derived from
+// its xpub); empty lines and lines starting with '#' are ignored.
+func LoadAddressList(path string) (list []string, err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list = append(list, line)
+	}
+	err = scan.Err()
+	return
+}
+
+// Sweeper withdraws the proceeds of completed trades to cold storage
+// addresses. Every address is used for one trade only; the assignment
+// of addresses to trades is recorded in a local journal (JSON lines).
+type Sweeper struct {
+	client  *Client                // client for API calls
+	addrs   []string               // list of withdrawal addresses
+	memo    *template.Template     // memo template
+	path    string                 // path to journal file
+	entries map[string]*SweepEntry // latest journal entry per trade
+	used    map[string]string      // used addresses (address -> trade)
+	mtx     sync.Mutex             // serialize access
+}
+
+// NewSweeper creates a new sweeper with given withdrawal addresses, memo
+// template (see text/template; fields of TradeInfo like {{.ShortId}} can
+// be used) and path to the journal file. An existing journal is read.
+func NewSweeper(c *Client, addrs []string, memo, journal string) (*Sweeper, error) {
+	if len(memo) == 0 {
+		memo = DefaultSweepMemo
+	}
+	tpl, err := template.New("memo").Parse(memo)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sweeper{
+		client:  c,
+		addrs:   addrs,
+		memo:    tpl,
+		path:    journal,
+		entries: make(map[string]*SweepEntry),
+		used:    make(map[string]string),
+	}
+	// read journal
+	f, err := os.Open(journal)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		entry := new(SweepEntry)
+		if err = dec.Decode(entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		s.entries[entry.TradeID] = entry
+		s.used[entry.Address] = entry.TradeID
+	}
+	return s, nil
+}
+
+// Entries returns the journal entries of all swept trades.
+func (s *Sweeper) Entries() (list []*SweepEntry) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, entry := range s.entries {
+		list = append(list, entry)
+	}
+	return
+}
+
+// Address returns the withdrawal address used for a trade.
+func (s *Sweeper) Address(tradeID string) (string, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if entry, ok := s.entries[tradeID]; ok {
+		return entry.Address, true
+	}
+	return "", false
+}
+
+// Pending returns closed trades with published payout whose funds are
+// still in the Bisq wallet. Interrupted withdrawals of trades that have
+// been withdrawn are completed in the journal.
+func (s *Sweeper) Pending(ctx context.Context) ([]*TradeInfo, error) {
+	trades, err := s.client.GetTrades(ctx, int(GetTradesRequest_CLOSED))
+	if err != nil {
+		return nil, err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if err = s.reconcile(trades); err != nil {
+		return nil, err
+	}
+	return s.pending(trades), nil
+}
+
+// reconcile completes interrupted withdrawals of withdrawn trades (locked)
+func (s *Sweeper) reconcile(trades []*TradeInfo) error {
+	for _, trade := range trades {
+		if entry, ok := s.entries[trade.TradeId]; ok && entry.Error == sweepPending && trade.Phase == "WITHDRAWN" {
+			done := *entry
+			done.Time = time.Now().UTC()
+			done.Error = ""
+			if err := s.record(&done); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pending trades from list (unlocked)
+func (s *Sweeper) pending(trades []*TradeInfo) (list []*TradeInfo) {
+	for _, trade := range trades {
+		if !trade.IsPayoutPublished || trade.Phase == "WITHDRAWN" {
+			continue
+		}
+		if entry, ok := s.entries[trade.TradeId]; ok && len(entry.Error) == 0 {
+			continue
+		}
+		list = append(list, trade)
+	}
+	return
+}
+
+// address returns the withdrawal address for a trade: a failed previous
+// withdrawal keeps its address, otherwise the next unused one is taken.
+func (s *Sweeper) address(tradeID string) (string, error) {
+	if entry, ok := s.entries[tradeID]; ok {
+		return entry.Address, nil
+	}
+	for _, addr := range s.addrs {
+		if _, ok := s.used[addr]; !ok {
+			return addr, nil
+		}
+	}
+	return "", ErrSweepNoAddress
+}
+
+// record a journal entry
+func (s *Sweeper) record(entry *SweepEntry) error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = json.NewEncoder(f).Encode(entry); err != nil {
+		return err
+	}
+	s.entries[entry.TradeID] = entry
+	s.used[entry.Address] = entry.TradeID
+	return nil
+}
+
+// Withdraw the funds of a trade to the next unused address. A withdrawal
+// interrupted before its outcome was recorded is only repeated if the
+// trade has not been withdrawn in the meantime.
+func (s *Sweeper) Withdraw(ctx context.Context, trade *TradeInfo) (*SweepEntry, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// an interrupted withdrawal might have succeeded: check trade state
+	if entry, ok := s.entries[trade.TradeId]; ok && entry.Error == sweepPending {
+		current, err := s.client.GetTrade(ctx, trade.TradeId)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.reconcile([]*TradeInfo{current}); err != nil {
+			return nil, err
+		}
+		if entry = s.entries[trade.TradeId]; entry.Error != sweepPending {
+			done := *entry
+			return &done, nil
+		}
+		trade = current
+	}
+	addr, err := s.address(trade.TradeId)
+	if err != nil {
+		return nil, err
+	}
+	memo := new(strings.Builder)
+	if err = s.memo.Execute(memo, trade); err != nil {
+		return nil, err
+	}
+	entry := &SweepEntry{
+		Time:    time.Now().UTC(),
+		TradeID: trade.TradeId,
+		ShortID: trade.ShortId,
+		Address: addr,
+		Memo:    memo.String(),
+		Amount:  Payout(trade),
+	}
+	// reserve address in journal before withdrawing
+	entry.Error = sweepPending
+	if err = s.record(entry); err != nil {
+		return nil, err
+	}
+	wErr := s.client.WithdrawFunds(ctx, trade.TradeId, addr, entry.Memo)
+	done := *entry
+	done.Error = ""
+	if wErr != nil {
+		done.Error = wErr.Error()
+	}
+	if err = s.record(&done); err != nil {
+		return nil, err
+	}
+	return &done, wErr
+}
+
+// Sweep withdraws the funds of all pending trades. Returns the journal
+// entries of all attempted withdrawals; failed withdrawals are listed
+// with an error message and are retried on the next sweep.
+func (s *Sweeper) Sweep(ctx context.Context) ([]*SweepEntry, error) {
+	trades, err := s.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []*SweepEntry
+	for _, trade := range trades {
+		entry, err := s.Withdraw(ctx, trade)
+		if entry == nil {
+			return list, err
+		}
+		list = append(list, entry)
+	}
+	return list, nil
+}
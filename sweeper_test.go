@@ -0,0 +1,126 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSweeperJournal(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "addrs.txt")
+	if err := os.WriteFile(list, []byte("# cold storage\nbc1qaaa\n\nbc1qbbb\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := LoadAddressList(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 addresses, got %d", len(addrs))
+	}
+	journal := filepath.Join(dir, "sweep.journal")
+	s, err := NewSweeper(testClient, addrs, "", journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trades := []*TradeInfo{
+		{TradeId: "t1", ShortId: "s1", IsPayoutPublished: true, Phase: "PAYOUT_PUBLISHED"},
+		{TradeId: "t2", ShortId: "s2", IsPayoutPublished: true, Phase: "WITHDRAWN"},
+		{TradeId: "t3", ShortId: "s3", Phase: "DEPOSIT_CONFIRMED"},
+	}
+	if p := s.pending(trades); len(p) != 1 || p[0].TradeId != "t1" {
+		t.Fatalf("unexpected pending trades: %v", p)
+	}
+	// assign address to trade
+	addr, err := s.address("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.record(&SweepEntry{TradeID: "t1", ShortID: "s1", Address: addr, Memo: "Bisq trade s1"}); err != nil {
+		t.Fatal(err)
+	}
+	// reload journal: address must not be reused
+	if s, err = NewSweeper(testClient, addrs, "", journal); err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := s.Address("t1"); !ok || a != "bc1qaaa" {
+		t.Fatalf("unexpected address for t1: %s", a)
+	}
+	if len(s.pending(trades)) != 0 {
+		t.Fatal("swept trade still pending")
+	}
+	if addr, _ = s.address("t4"); addr != "bc1qbbb" {
+		t.Fatalf("unexpected address for t4: %s", addr)
+	}
+	s.used[addr] = "t4"
+	if _, err = s.address("t5"); err != ErrSweepNoAddress {
+		t.Fatal("expected address list to be exhausted")
+	}
+
+	// interrupted withdrawal of a withdrawn trade is completed
+	if err = s.record(&SweepEntry{TradeID: "t2", ShortID: "s2", Address: addr, Error: sweepPending}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.reconcile(trades); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = NewSweeper(testClient, addrs, "", journal); err != nil {
+		t.Fatal(err)
+	}
+	if e := s.entries["t2"]; e.Error != "" || e.Address != addr {
+		t.Fatalf("interrupted withdrawal not completed: %+v", e)
+	}
+}
+
+func TestPayout(t *testing.T) {
+	trade := &TradeInfo{
+		TradeAmountAsLong: 10000000,
+		Role:              "BTC buyer as maker",
+		Offer:             &OfferInfo{IsMyOffer: true, BuyerSecurityDeposit: 1500000, SellerSecurityDeposit: 1500000},
+		Contract:          &ContractInfo{IsBuyerMakerAndSellerTaker: true},
+	}
+	if p := Payout(trade); p != 11500000 {
+		t.Fatalf("wrong buyer payout: %d", p)
+	}
+	trade.Contract.IsBuyerMakerAndSellerTaker = false
+	if p := Payout(trade); p != 1500000 {
+		t.Fatalf("wrong seller payout: %d", p)
+	}
+}
+
+func TestSweeperPending(t *testing.T) {
+	needDaemon(t)
+	s, err := NewSweeper(testClient, nil, "Trade {{.ShortId}} ({{.Offer.CounterCurrencyCode}})", filepath.Join(t.TempDir(), "sweep.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trades, err := s.Pending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, trade := range trades {
+		t.Logf("Pending#%d: %s\n", i, trade.ShortId)
+	}
+}
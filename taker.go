@@ -0,0 +1,311 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error codes
+var (
+	ErrTakerBudget   = fmt.Errorf("Taker budget exhausted")
+	ErrTakerNoOffer  = fmt.Errorf("No matching offer found")
+	ErrTakerNoMarket = fmt.Errorf("No market price available")
+)
+
+// TakerConfig holds the selection criteria and limits of a Taker.
+type TakerConfig struct {
+	Direction        string        // direction of offers to take ("BUY" or "SELL")
+	Currency         string        // fiat or altcoin currency code
+	MinAmount        uint64        // minimum amount to take (satoshis)
+	MaxAmount        uint64        // maximum amount to take per trade (satoshis)
+	MaxDeviation     float64       // max. deviation from market price (percent)
+	MakerFeeCurrency string        // required maker fee currency ("BTC", "BSQ" or "" for any)
+	TakerFeeCurrency string        // currency used to pay our taker fee ("BTC" or "BSQ")
+	Budget           uint64        // total amount to take over all trades (satoshis; required)
+	MaxTrades        int           // max. number of trades (0 = unlimited)
+	CoolDown         time.Duration // min. time between trades with the same maker
+}
+
+// Candidate is an offer that passed all filters of a Taker.
+type Candidate struct {
+	Offer     *OfferInfo      // offer to take
+	Account   *PaymentAccount // our payment account for the offer
+	Price     float64         // offer price
+	Deviation float64         // deviation from market price (percent)
+	Amount    uint64          // amount to take (satoshis)
+}
+
+//----------------------------------------------------------------------
+// Ranking strategies
+//----------------------------------------------------------------------
+
+// Strategy ranks candidate offers; the best candidate is first in the
+// returned list.
+type Strategy interface {
+	Rank(list []*Candidate) []*Candidate
+}
+
+// BestPrice ranks candidates by price: lowest price first for SELL offers
+// (we buy BTC) and highest price first for BUY offers (we sell BTC).
+type BestPrice struct{}
+
+// Rank candidates by price
+func (s BestPrice) Rank(list []*Candidate) []*Candidate {
+	sort.SliceStable(list, func(i, j int) bool {
+		if strings.EqualFold(list[i].Offer.Direction, "BUY") {
+			return list[i].Price > list[j].Price
+		}
+		return list[i].Price < list[j].Price
+	})
+	return list
+}
+
+// LargestAmount ranks candidates by the amount we can take (largest first).
+type LargestAmount struct{}
+
+// Rank candidates by amount
+func (s LargestAmount) Rank(list []*Candidate) []*Candidate {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Amount > list[j].Amount
+	})
+	return list
+}
+
+// OldestOffer ranks candidates by offer creation date (oldest first).
+type OldestOffer struct{}
+
+// Rank candidates by offer date
+func (s OldestOffer) Rank(list []*Candidate) []*Candidate {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Offer.Date < list[j].Offer.Date
+	})
+	return list
+}
+
+//----------------------------------------------------------------------
+// Taker engine
+//----------------------------------------------------------------------
+
+// Taker scans the offer book for matching offers and takes the best
+// candidate (as ranked by a strategy) within the configured limits.
+type Taker struct {
+	client   *Client              // client for API calls
+	cfg      *TakerConfig         // selection criteria and limits
+	strategy Strategy             // ranking strategy
+	spent    uint64               // amount taken so far
+	trades   int                  // number of trades so far
+	makers   map[string]time.Time // time of last trade per maker
+	mtx      sync.Mutex           // serialize engine steps
+}
+
+// NewTaker creates a new taker engine for given configuration. If no
+// strategy is specified, offers are ranked by best price.
+func NewTaker(c *Client, cfg *TakerConfig, s Strategy) *Taker {
+	if s == nil {
+		s = BestPrice{}
+	}
+	return &Taker{
+		client:   c,
+		cfg:      cfg,
+		strategy: s,
+		makers:   make(map[string]time.Time),
+	}
+}
+
+// Remaining returns the amount left in the budget (satoshis).
+func (t *Taker) Remaining() uint64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.remaining()
+}
+
+// remaining budget (unlocked)
+func (t *Taker) remaining() uint64 {
+	if t.spent >= t.cfg.Budget {
+		return 0
+	}
+	return t.cfg.Budget - t.spent
+}
+
+// Candidates returns a ranked list of offers that can be taken now.
+func (t *Taker) Candidates(ctx context.Context) ([]*Candidate, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.candidates(ctx)
+}
+
+// candidates (unlocked)
+func (t *Taker) candidates(ctx context.Context) ([]*Candidate, error) {
+	offers, err := t.client.GetOffers(ctx, t.cfg.Direction, t.cfg.Currency)
+	if err != nil {
+		return nil, err
+	}
+	accnts, err := t.client.GetPaymentAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	market, err := t.client.GetMarketPrice(ctx, t.cfg.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if market <= 0 {
+		return nil, ErrTakerNoMarket
+	}
+	list := t.filter(offers, accnts, market, time.Now())
+	return t.strategy.Rank(list), nil
+}
+
+// filter offers for criteria and limits
+func (t *Taker) filter(offers []*OfferInfo, accnts []*PaymentAccount, market float64, now time.Time) (list []*Candidate) {
+	budget := t.remaining()
+	for _, offer := range offers {
+		// check maker cool-down
+		if last, ok := t.makers[offer.OwnerNodeAddress]; ok && now.Sub(last) < t.cfg.CoolDown {
+			continue
+		}
+		// check maker fee currency
+		switch strings.ToUpper(t.cfg.MakerFeeCurrency) {
+		case "BTC":
+			if !offer.IsCurrencyForMakerFeeBtc {
+				continue
+			}
+		case "BSQ":
+			if offer.IsCurrencyForMakerFeeBtc {
+				continue
+			}
+		}
+		// check for payment account
+		accnt := matchAccount(accnts, offer.PaymentMethodId, t.cfg.Currency)
+		if accnt == nil {
+			continue
+		}
+		// check price deviation
+		price, err := strconv.ParseFloat(offer.Price, 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		dev := 100 * math.Abs(price-market) / market
+		if dev > t.cfg.MaxDeviation {
+			continue
+		}
+		// check amount range
+		amount := offer.Amount
+		if t.cfg.MaxAmount > 0 && amount > t.cfg.MaxAmount {
+			amount = t.cfg.MaxAmount
+		}
+		if amount > budget {
+			amount = budget
+		}
+		if amount == 0 || amount < offer.MinAmount || amount < t.cfg.MinAmount {
+			continue
+		}
+		list = append(list, &Candidate{
+			Offer:     offer,
+			Account:   accnt,
+			Price:     price,
+			Deviation: dev,
+			Amount:    amount,
+		})
+	}
+	return
+}
+
+// matchAccount returns a payment account for given payment method that
+// supports the currency (if the account lists trade currencies).
+func matchAccount(accnts []*PaymentAccount, mthdID, curr string) *PaymentAccount {
+	for _, accnt := range accnts {
+		if accnt.PaymentMethod.GetId() != mthdID {
+			continue
+		}
+		if len(accnt.TradeCurrencies) == 0 {
+			return accnt
+		}
+		for _, tc := range accnt.TradeCurrencies {
+			if strings.EqualFold(tc.Code, curr) {
+				return accnt
+			}
+		}
+	}
+	return nil
+}
+
+// Step scans the offer book once and takes the best candidate. Returns
+// ErrTakerNoOffer if no offer matches and ErrTakerBudget if the limits
+// of the taker are reached.
+func (t *Taker) Step(ctx context.Context) (*TradeInfo, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	// check limits
+	if t.remaining() == 0 || (t.cfg.MaxTrades > 0 && t.trades >= t.cfg.MaxTrades) {
+		return nil, ErrTakerBudget
+	}
+	list, err := t.candidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrTakerNoOffer
+	}
+	// take best offer
+	best := list[0]
+	trade, err := t.client.TakeOffer(ctx, int64(best.Amount), best.Offer.Id, best.Account.Id, t.cfg.TakerFeeCurrency)
+	if err != nil {
+		return nil, err
+	}
+	t.spent += best.Amount
+	t.trades++
+	t.makers[best.Offer.OwnerNodeAddress] = time.Now()
+	return trade, nil
+}
+
+// Run the taker engine in given intervals until the context is cancelled
+// or the budget is exhausted. Taken trades are passed to the callback
+// function (if defined); errors other than "no offer" terminate the loop.
+func (t *Taker) Run(ctx context.Context, interval time.Duration, cb func(*TradeInfo)) error {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		trade, err := t.Step(ctx)
+		switch err {
+		case nil:
+			if cb != nil {
+				cb(trade)
+			}
+		case ErrTakerNoOffer:
+		default:
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,82 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package bisquit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTakerFilter(t *testing.T) {
+	accnts := []*PaymentAccount{
+		{Id: "a1", PaymentMethod: &PaymentMethod{Id: "SEPA"}, TradeCurrencies: []*TradeCurrency{{Code: "EUR"}}},
+	}
+	offers := []*OfferInfo{
+		{Id: "o1", Direction: "SELL", Price: "30000", Amount: 1000000, MinAmount: 500000, PaymentMethodId: "SEPA", OwnerNodeAddress: "m1", IsCurrencyForMakerFeeBtc: true},
+		{Id: "o2", Direction: "SELL", Price: "29500", Amount: 2000000, MinAmount: 100000, PaymentMethodId: "SEPA", OwnerNodeAddress: "m2"},
+		{Id: "o3", Direction: "SELL", Price: "35000", Amount: 1000000, MinAmount: 100000, PaymentMethodId: "SEPA", OwnerNodeAddress: "m3"},
+		{Id: "o4", Direction: "SELL", Price: "30000", Amount: 1000000, MinAmount: 100000, PaymentMethodId: "ZELLE", OwnerNodeAddress: "m4"},
+		{Id: "o5", Direction: "SELL", Price: "30000", Amount: 5000000, MinAmount: 4000000, PaymentMethodId: "SEPA", OwnerNodeAddress: "m5"},
+	}
+	taker := NewTaker(nil, &TakerConfig{
+		Direction:    "SELL",
+		Currency:     "EUR",
+		MinAmount:    200000,
+		MaxAmount:    1500000,
+		MaxDeviation: 5,
+		Budget:       3000000,
+		CoolDown:     time.Hour,
+	}, nil)
+	now := time.Now()
+	taker.makers["m1"] = now.Add(-2 * time.Hour)
+	list := taker.strategy.Rank(taker.filter(offers, accnts, 30000, now))
+	if len(list) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(list))
+	}
+	if list[0].Offer.Id != "o2" || list[0].Amount != 1500000 {
+		t.Fatalf("unexpected best candidate: %v", list[0])
+	}
+	// maker in cool-down and BSQ maker fee filter
+	taker.makers["m2"] = now
+	taker.cfg.MakerFeeCurrency = "BSQ"
+	if list = taker.filter(offers, accnts, 30000, now); len(list) != 0 {
+		t.Fatalf("expected no candidates, got %d", len(list))
+	}
+}
+
+func TestTakerCandidates(t *testing.T) {
+	needDaemon(t)
+	taker := NewTaker(testClient, &TakerConfig{
+		Direction:    "SELL",
+		Currency:     "EUR",
+		MaxAmount:    1000000,
+		MaxDeviation: 10,
+		Budget:       1000000,
+	}, LargestAmount{})
+	list, err := taker.Candidates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range list {
+		t.Logf("Candidate#%d: %s @ %f (%.2f%%)\n", i, c.Offer.Id, c.Price, c.Deviation)
+	}
+}
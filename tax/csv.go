@@ -0,0 +1,161 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package tax
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatting helpers
+func btc(sats uint64) string {
+	return strconv.FormatFloat(float64(sats)/1e8, 'f', 8, 64)
+}
+
+func bsq(units uint64) string {
+	return strconv.FormatFloat(float64(units)/100, 'f', 2, 64)
+}
+
+func fiat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func date(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeCSV writes header and rows
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	wrt := csv.NewWriter(w)
+	if err := wrt.Write(header); err != nil {
+		return err
+	}
+	if err := wrt.WriteAll(rows); err != nil {
+		return err
+	}
+	wrt.Flush()
+	return wrt.Error()
+}
+
+// fee returns the trade fee in its currency
+func fee(r *Record) string {
+	if r.FeeCurrency == "BSQ" {
+		return bsq(r.TradeFee)
+	}
+	return btc(r.TradeFee)
+}
+
+// WriteGenericCSV exports trade records with all computed values.
+func WriteGenericCSV(w io.Writer, records []*Record) error {
+	rows := make([][]string, len(records))
+	for i, r := range records {
+		role := "taker"
+		if r.Maker {
+			role = "maker"
+		}
+		rows[i] = []string{
+			date(r.Time), r.TradeID, r.Status, r.Side, role,
+			btc(r.Amount), strconv.FormatFloat(r.Price, 'f', -1, 64), fiat(r.Volume), r.Currency,
+			fee(r), r.FeeCurrency, btc(r.TxFee), fiat(r.FeeValue), fiat(r.Basis),
+			strings.Join(r.TxIDs, " "),
+		}
+	}
+	return writeCSV(w, []string{
+		"date", "trade_id", "status", "side", "role",
+		"amount_btc", "price", "volume", "currency",
+		"trade_fee", "trade_fee_currency", "tx_fee_btc", "fee_value", "basis",
+		"tx_ids",
+	}, rows)
+}
+
+// WriteKoinlyCSV exports closed trades in the Koinly universal format.
+// Trade fees paid in BSQ are exported as separate "cost" entries.
+func WriteKoinlyCSV(w io.Writer, records []*Record) error {
+	var rows [][]string
+	for _, r := range records {
+		if r.Status != StatusClosed {
+			continue
+		}
+		ts := r.Time.UTC().Format("2006-01-02 15:04:05 UTC")
+		desc := "Bisq trade " + r.ShortID
+		txHash := ""
+		if len(r.TxIDs) > 0 {
+			txHash = r.TxIDs[len(r.TxIDs)-1]
+		}
+		fees := r.TxFee
+		if r.FeeCurrency == "BTC" {
+			fees += r.TradeFee
+		}
+		sent := []string{fiat(r.Volume), r.Currency}
+		recv := []string{btc(r.Amount), "BTC"}
+		if r.Side == SideSell {
+			sent, recv = recv, sent
+		}
+		row := []string{ts}
+		row = append(row, sent...)
+		row = append(row, recv...)
+		row = append(row, btc(fees), "BTC", fiat(r.Volume), r.Currency, "", desc, txHash)
+		rows = append(rows, row)
+		if r.FeeCurrency == "BSQ" && r.TradeFee > 0 {
+			rows = append(rows, []string{
+				ts, bsq(r.TradeFee), "BSQ", "", "", "", "", "", "",
+				"cost", desc + " (trade fee)", "",
+			})
+		}
+	}
+	return writeCSV(w, []string{
+		"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency",
+		"Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency",
+		"Label", "Description", "TxHash",
+	}, rows)
+}
+
+// WriteDisposalsCSV exports matched sales with gains.
+func WriteDisposalsCSV(w io.Writer, disposals []*Disposal) error {
+	rows := make([][]string, len(disposals))
+	for i, d := range disposals {
+		rows[i] = []string{
+			date(d.Time), d.TradeID, btc(d.Amount), fiat(d.Proceeds), fiat(d.Cost),
+			fiat(d.Gain), d.Currency, date(d.Acquired), btc(d.Unmatched),
+		}
+	}
+	return writeCSV(w, []string{
+		"date", "trade_id", "amount_btc", "proceeds", "cost", "gain", "currency", "acquired", "unmatched_btc",
+	}, rows)
+}
+
+// WriteTransactionsCSV exports wallet transactions not related to trades.
+func WriteTransactionsCSV(w io.Writer, txs []*Transaction) error {
+	rows := make([][]string, len(txs))
+	for i, tx := range txs {
+		rows[i] = []string{
+			tx.TxID, btc(tx.Input), btc(tx.Output), btc(tx.Fee),
+			strconv.FormatBool(tx.Pending), tx.Memo,
+		}
+	}
+	return writeCSV(w, []string{"tx_id", "input_btc", "output_btc", "fee_btc", "pending", "memo"}, rows)
+}
@@ -0,0 +1,125 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package tax
+
+import (
+	"time"
+)
+
+// Lot matching methods
+const (
+	FIFO = "fifo" // first in, first out
+	LIFO = "lifo" // last in, first out
+)
+
+// Lot is an amount of BTC acquired in a trade
+type Lot struct {
+	Time     time.Time `json:"time"`     // date of acquisition
+	TradeID  string    `json:"tradeId"`  // trade of acquisition
+	Amount   uint64    `json:"amount"`   // remaining amount (sats)
+	Cost     float64   `json:"cost"`     // cost of remaining amount
+	Currency string    `json:"currency"` // currency of cost
+}
+
+// Disposal is a sale matched against acquired lots
+type Disposal struct {
+	Time      time.Time `json:"time"`      // date of sale
+	TradeID   string    `json:"tradeId"`   // trade of sale
+	Amount    uint64    `json:"amount"`    // sold amount (sats)
+	Proceeds  float64   `json:"proceeds"`  // net proceeds
+	Cost      float64   `json:"cost"`      // cost basis of matched lots
+	Gain      float64   `json:"gain"`      // proceeds minus cost
+	Currency  string    `json:"currency"`  // currency of values
+	Acquired  time.Time `json:"acquired"`  // date of oldest matched lot
+	Unmatched uint64    `json:"unmatched"` // amount without lot (sats)
+}
+
+// Match closed trades against acquired lots. Lots are kept per counter
+// currency; sales without (enough) lots have an unmatched amount with a
+// cost basis of zero. Returns the disposals and the remaining lots.
+func Match(records []*Record, method string) ([]*Disposal, []*Lot, error) {
+	if method != FIFO && method != LIFO {
+		return nil, nil, ErrTaxMethod
+	}
+	lots := make(map[string][]*Lot)
+	var (
+		disposals []*Disposal
+		order     []string
+	)
+	for _, r := range records {
+		if r.Status != StatusClosed || r.Amount == 0 {
+			continue
+		}
+		if _, ok := lots[r.Currency]; !ok {
+			order = append(order, r.Currency)
+			lots[r.Currency] = nil
+		}
+		if r.Side == SideBuy {
+			lots[r.Currency] = append(lots[r.Currency], &Lot{
+				Time:     r.Time,
+				TradeID:  r.TradeID,
+				Amount:   r.Amount,
+				Cost:     r.Basis,
+				Currency: r.Currency,
+			})
+			continue
+		}
+		d := &Disposal{
+			Time:     r.Time,
+			TradeID:  r.TradeID,
+			Amount:   r.Amount,
+			Proceeds: r.Basis,
+			Currency: r.Currency,
+		}
+		rest := r.Amount
+		for rest > 0 && len(lots[r.Currency]) > 0 {
+			list := lots[r.Currency]
+			idx := 0
+			if method == LIFO {
+				idx = len(list) - 1
+			}
+			lot := list[idx]
+			take := rest
+			if lot.Amount < take {
+				take = lot.Amount
+			}
+			cost := lot.Cost * float64(take) / float64(lot.Amount)
+			d.Cost += cost
+			if d.Acquired.IsZero() || lot.Time.Before(d.Acquired) {
+				d.Acquired = lot.Time
+			}
+			lot.Cost -= cost
+			lot.Amount -= take
+			rest -= take
+			if lot.Amount == 0 {
+				lots[r.Currency] = append(list[:idx], list[idx+1:]...)
+			}
+		}
+		d.Unmatched = rest
+		d.Gain = d.Proceeds - d.Cost
+		disposals = append(disposals, d)
+	}
+	var remaining []*Lot
+	for _, curr := range order {
+		remaining = append(remaining, lots[curr]...)
+	}
+	return disposals, remaining, nil
+}
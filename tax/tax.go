@@ -0,0 +1,286 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+// Package tax exports the trade history of a Bisq node for tax reports:
+// closed and failed trades are merged with wallet transactions, the cost
+// basis (or proceeds) of each trade is computed in the fiat counter
+// currency and disposals are matched against acquired lots (FIFO or LIFO).
+package tax
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bfix/bisquit"
+)
+
+// Error codes
+var (
+	ErrTaxMethod  = fmt.Errorf("Unknown lot matching method")
+	ErrTaxNonFiat = fmt.Errorf("Not a fiat trade")
+)
+
+// Trade status
+const (
+	StatusClosed = "closed"
+	StatusFailed = "failed"
+)
+
+// Trade sides (from the perspective of the node)
+const (
+	SideBuy  = "buy"  // BTC bought
+	SideSell = "sell" // BTC sold
+)
+
+// Options for computing records
+type Options struct {
+	// BsqPrice is the price of BSQ in BTC used to value trade fees paid in
+	// BSQ; if zero, BSQ fees are listed but not included in cost basis.
+	BsqPrice float64
+}
+
+// Record is the tax-relevant summary of a trade
+type Record struct {
+	Time        time.Time `json:"time"`        // trade date
+	TradeID     string    `json:"tradeId"`     // trade identifier
+	ShortID     string    `json:"shortId"`     // short trade identifier
+	Status      string    `json:"status"`      // closed or failed
+	Side        string    `json:"side"`        // buy or sell (BTC)
+	Maker       bool      `json:"maker"`       // own offer?
+	Amount      uint64    `json:"amount"`      // BTC amount (sats)
+	Price       float64   `json:"price"`       // trade price (counter per BTC)
+	Volume      float64   `json:"volume"`      // counter currency volume
+	Currency    string    `json:"currency"`    // counter currency
+	Method      string    `json:"method"`      // payment method
+	TradeFee    uint64    `json:"tradeFee"`    // trade fee (sats or BSQ units)
+	FeeCurrency string    `json:"feeCurrency"` // currency of trade fee (BTC/BSQ)
+	TxFee       uint64    `json:"txFee"`       // mining fees paid (sats)
+	FeeValue    float64   `json:"feeValue"`    // value of fees in counter currency
+	Basis       float64   `json:"basis"`       // cost basis (buy) or net proceeds (sell)
+	TxIDs       []string  `json:"txIds"`       // related wallet transactions
+}
+
+// Transaction is a wallet transaction not related to a trade
+type Transaction struct {
+	TxID    string `json:"txId"`    // transaction identifier
+	Fee     uint64 `json:"fee"`     // mining fee (sats)
+	Input   uint64 `json:"input"`   // sum of inputs (sats)
+	Output  uint64 `json:"output"`  // sum of outputs (sats)
+	Memo    string `json:"memo"`    // memo of transaction
+	Pending bool   `json:"pending"` // unconfirmed?
+}
+
+// Skipped is a trade not covered by records: altcoin trades (BTC is the
+// counter currency) and BSQ swaps have no fiat value.
+type Skipped struct {
+	Time    time.Time `json:"time"`    // trade date
+	TradeID string    `json:"tradeId"` // trade identifier
+	ShortID string    `json:"shortId"` // short trade identifier
+	Status  string    `json:"status"`  // closed or failed
+	Market  string    `json:"market"`  // market (base/counter)
+	Amount  uint64    `json:"amount"`  // BTC amount (sats)
+	Volume  string    `json:"volume"`  // volume (as reported)
+	TxIDs   []string  `json:"txIds"`   // related wallet transactions
+}
+
+// History of trades and wallet transactions
+type History struct {
+	Records      []*Record      `json:"records"`      // fiat trades (sorted by time)
+	Skipped      []*Skipped     `json:"skipped"`      // non-fiat trades (sorted by time)
+	Transactions []*Transaction `json:"transactions"` // other wallet transactions
+}
+
+// fiatTrade returns true if BTC is traded against a fiat currency. For
+// altcoins the counter currency is BTC and the volume is in the altcoin.
+func fiatTrade(t *bisquit.TradeInfo) bool {
+	if t.Offer.GetIsBsqSwapOffer() || t.BsqSwapTradeInfo != nil {
+		return false
+	}
+	curr := t.Offer.GetCounterCurrencyCode()
+	base := t.Offer.GetBaseCurrencyCode()
+	return len(curr) > 0 && curr != "BTC" && (len(base) == 0 || base == "BTC")
+}
+
+// Collect closed and failed trades and wallet transactions from the daemon.
+func Collect(ctx context.Context, c *bisquit.Client, opts *Options) (*History, error) {
+	closed, err := c.GetTrades(ctx, int(bisquit.GetTradesRequest_CLOSED))
+	if err != nil {
+		return nil, err
+	}
+	failed, err := c.GetTrades(ctx, int(bisquit.GetTradesRequest_FAILED))
+	if err != nil {
+		return nil, err
+	}
+	txs, err := c.GetTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Build(closed, failed, txs, opts)
+}
+
+// Build the history from lists of trades and wallet transactions.
+func Build(closed, failed []*bisquit.TradeInfo, txs []*bisquit.TxInfo, opts *Options) (*History, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	h := new(History)
+	used := make(map[string]bool)
+	for _, list := range []struct {
+		status string
+		trades []*bisquit.TradeInfo
+	}{
+		{StatusClosed, closed},
+		{StatusFailed, failed},
+	} {
+		for _, t := range list.trades {
+			// merge wallet transactions
+			var txIDs []string
+			ids := []string{t.Offer.GetOfferFeePaymentTxId(), t.TakerFeeTxId, t.DepositTxId, t.PayoutTxId}
+			for _, id := range ids {
+				if len(id) == 0 || used[id] {
+					continue
+				}
+				for _, tx := range txs {
+					if tx.TxId == id {
+						used[id] = true
+						txIDs = append(txIDs, id)
+						break
+					}
+				}
+			}
+			if !fiatTrade(t) {
+				h.Skipped = append(h.Skipped, &Skipped{
+					Time:    time.UnixMilli(int64(t.Date)).UTC(),
+					TradeID: t.TradeId,
+					ShortID: t.ShortId,
+					Status:  list.status,
+					Market:  t.Offer.GetBaseCurrencyCode() + "/" + t.Offer.GetCounterCurrencyCode(),
+					Amount:  t.TradeAmountAsLong,
+					Volume:  t.TradeVolume,
+					TxIDs:   txIDs,
+				})
+				continue
+			}
+			r, err := NewRecord(t, list.status, opts)
+			if err != nil {
+				return nil, err
+			}
+			r.TxIDs = txIDs
+			h.Records = append(h.Records, r)
+		}
+	}
+	sort.SliceStable(h.Records, func(i, j int) bool {
+		return h.Records[i].Time.Before(h.Records[j].Time)
+	})
+	sort.SliceStable(h.Skipped, func(i, j int) bool {
+		return h.Skipped[i].Time.Before(h.Skipped[j].Time)
+	})
+	for _, tx := range txs {
+		if used[tx.TxId] {
+			continue
+		}
+		h.Transactions = append(h.Transactions, &Transaction{
+			TxID:    tx.TxId,
+			Fee:     tx.Fee,
+			Input:   tx.InputSum,
+			Output:  tx.OutputSum,
+			Memo:    tx.Memo,
+			Pending: tx.IsPending,
+		})
+	}
+	return h, nil
+}
+
+// NewRecord computes the record for a trade. The cost basis of a purchase
+// is the paid volume plus the value of fees; the net proceeds of a sale
+// are the received volume minus the value of fees. Only trades of BTC
+// against a fiat currency have a record (ErrTaxNonFiat).
+func NewRecord(t *bisquit.TradeInfo, status string, opts *Options) (*Record, error) {
+	if !fiatTrade(t) {
+		return nil, fmt.Errorf("trade %s: %w", t.ShortId, ErrTaxNonFiat)
+	}
+	price, err := bisquit.ParseAmount(t.TradePrice)
+	if err != nil {
+		return nil, fmt.Errorf("trade %s: price: %w", t.ShortId, err)
+	}
+	volume, err := bisquit.ParseAmount(t.TradeVolume)
+	if err != nil {
+		return nil, fmt.Errorf("trade %s: volume: %w", t.ShortId, err)
+	}
+	r := &Record{
+		Time:     time.UnixMilli(int64(t.Date)).UTC(),
+		TradeID:  t.TradeId,
+		ShortID:  t.ShortId,
+		Status:   status,
+		Side:     SideSell,
+		Maker:    bisquit.IsMaker(t),
+		Amount:   t.TradeAmountAsLong,
+		Price:    price,
+		Volume:   volume,
+		Currency: t.Offer.GetCounterCurrencyCode(),
+		Method:   t.Offer.GetPaymentMethodId(),
+	}
+	if bisquit.IsBuyer(t) {
+		r.Side = SideBuy
+	}
+	// fees paid by us
+	feeBtc := false
+	if r.Maker {
+		r.TradeFee = t.Offer.GetMakerFee()
+		r.TxFee = t.Offer.GetTxFee()
+		feeBtc = t.Offer.GetIsCurrencyForMakerFeeBtc()
+	} else {
+		r.TradeFee = t.TakerFeeAsLong
+		r.TxFee = t.TxFeeAsLong
+		feeBtc = t.IsCurrencyForTakerFeeBtc
+	}
+	fees := float64(r.TxFee) / 1e8
+	if feeBtc {
+		r.FeeCurrency = "BTC"
+		fees += float64(r.TradeFee) / 1e8
+	} else {
+		// BSQ has 2 decimals
+		r.FeeCurrency = "BSQ"
+		fees += float64(r.TradeFee) / 100 * opts.BsqPrice
+	}
+	r.FeeValue = fees * price
+
+	switch {
+	case status != StatusClosed:
+		r.Basis = 0
+	case r.Side == SideBuy:
+		r.Basis = r.Volume + r.FeeValue
+	default:
+		r.Basis = r.Volume - r.FeeValue
+	}
+	return r, nil
+}
+
+// Year returns the records of a year.
+func (h *History) Year(year int) (list []*Record) {
+	for _, r := range h.Records {
+		if r.Time.Year() == year {
+			list = append(list, r)
+		}
+	}
+	return
+}
@@ -0,0 +1,209 @@
+//----------------------------------------------------------------------
+// This file is part of bisquit.
+// Copyright (C) 2021 Bernd Fix >Y<
+//
+// bisquit is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// bisquit is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package tax
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bfix/bisquit"
+)
+
+// base time of test trades
+var t0 = time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// trade creates a test trade; we are the maker (paying the fee in BTC)
+// or taker (paying the fee in BSQ).
+func trade(id string, buy, maker bool, amount uint64, price, volume string, day int) *bisquit.TradeInfo {
+	t := &bisquit.TradeInfo{
+		TradeId:           id,
+		ShortId:           id,
+		Date:              uint64(t0.AddDate(0, 0, day).UnixMilli()),
+		TradeAmountAsLong: amount,
+		TradePrice:        price,
+		TradeVolume:       volume,
+		DepositTxId:       "dep-" + id,
+		PayoutTxId:        "pay-" + id,
+		TakerFeeAsLong:    500,  // 5 BSQ
+		TxFeeAsLong:       2000, // sats
+		Offer: &bisquit.OfferInfo{
+			IsMyOffer:                maker,
+			CounterCurrencyCode:      "EUR",
+			MakerFee:                 10000, // sats
+			TxFee:                    2000,  // sats
+			IsCurrencyForMakerFeeBtc: true,
+		},
+		// buyer is maker
+		Contract: &bisquit.ContractInfo{IsBuyerMakerAndSellerTaker: buy == maker},
+	}
+	return t
+}
+
+// xmrTrade creates a test trade selling XMR for BTC: the counter currency
+// is BTC and the volume is in XMR.
+func xmrTrade(id string, day int) *bisquit.TradeInfo {
+	t := trade(id, true, true, 10000000, "0.00600000", "16.666666666666", day)
+	t.Offer.BaseCurrencyCode = "XMR"
+	t.Offer.CounterCurrencyCode = "BTC"
+	return t
+}
+
+func TestRecord(t *testing.T) {
+	r, err := NewRecord(trade("t1", true, true, 10000000, "30000.0000", "3000.00", 0), StatusClosed, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fees: 12000 sats = 3.60 EUR
+	if r.Side != SideBuy || !r.Maker || r.FeeCurrency != "BTC" ||
+		math.Abs(r.FeeValue-3.6) > 1e-9 || math.Abs(r.Basis-3003.6) > 1e-9 {
+		t.Fatalf("wrong record: %+v", r)
+	}
+	opts := &Options{BsqPrice: 0.00002}
+	r, err = NewRecord(trade("t2", false, false, 10000000, "35.000,0000", "3.500,00", 1), StatusClosed, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fees: 2000 sats + 5 BSQ (10000 sats) = 4.20 EUR
+	if r.Side != SideSell || r.Maker || r.FeeCurrency != "BSQ" || r.Price != 35000 ||
+		math.Abs(r.FeeValue-4.2) > 1e-9 || math.Abs(r.Basis-3495.8) > 1e-9 {
+		t.Fatalf("wrong record: %+v", r)
+	}
+	if _, err = NewRecord(trade("t3", true, true, 1, "n/a", "1", 0), StatusClosed, nil); err == nil {
+		t.Fatal("invalid price accepted")
+	}
+	if _, err = NewRecord(xmrTrade("x1", 0), StatusClosed, nil); !errors.Is(err, ErrTaxNonFiat) {
+		t.Fatalf("altcoin trade accepted: %v", err)
+	}
+	swap := trade("x2", true, true, 10000000, "0.00002500", "4000.00", 0)
+	swap.Offer.IsBsqSwapOffer = true
+	if _, err = NewRecord(swap, StatusClosed, nil); !errors.Is(err, ErrTaxNonFiat) {
+		t.Fatalf("BSQ swap accepted: %v", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	closed := []*bisquit.TradeInfo{
+		trade("s1", false, true, 15000000, "40000", "6000", 20),
+		trade("b1", true, true, 10000000, "30000", "3000", 0),
+		trade("b2", true, true, 10000000, "35000", "3500", 10),
+		xmrTrade("x1", 15),
+	}
+	failed := []*bisquit.TradeInfo{
+		trade("f1", true, false, 10000000, "30000", "3000", 5),
+	}
+	txs := []*bisquit.TxInfo{
+		{TxId: "dep-b1", Fee: 2000},
+		{TxId: "pay-b1", Fee: 1000},
+		{TxId: "dep-f1", Fee: 2000},
+		{TxId: "dep-x1", Fee: 2000},
+		{TxId: "other", Fee: 500, Memo: "withdrawal"},
+	}
+	h, err := Build(closed, failed, txs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Records) != 4 || h.Records[0].TradeID != "b1" || h.Records[1].Status != StatusFailed {
+		t.Fatalf("wrong records: %v", h.Records)
+	}
+	// altcoin trades are listed separately
+	if len(h.Skipped) != 1 || h.Skipped[0].TradeID != "x1" || h.Skipped[0].Market != "XMR/BTC" ||
+		len(h.Skipped[0].TxIDs) != 1 || h.Skipped[0].TxIDs[0] != "dep-x1" {
+		t.Fatalf("wrong skipped trades: %v", h.Skipped)
+	}
+	if ids := h.Records[0].TxIDs; len(ids) != 2 || ids[1] != "pay-b1" {
+		t.Fatalf("wrong tx ids: %v", ids)
+	}
+	if len(h.Transactions) != 1 || h.Transactions[0].Memo != "withdrawal" {
+		t.Fatalf("wrong transactions: %v", h.Transactions)
+	}
+	if len(h.Year(2023)) != 4 || len(h.Year(2022)) != 0 {
+		t.Fatal("wrong year filter")
+	}
+
+	// fee per trade: 12000 sats at trade price
+	check := func(method string, cost float64) {
+		ds, lots, err := Match(h.Records, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ds) != 1 || math.Abs(ds[0].Cost-cost) > 1e-6 || ds[0].Unmatched != 0 {
+			t.Fatalf("%s: wrong disposals: %+v", method, ds[0])
+		}
+		if len(lots) != 1 || lots[0].Amount != 5000000 {
+			t.Fatalf("%s: wrong lots: %+v", method, lots)
+		}
+		if math.Abs(ds[0].Gain-(ds[0].Proceeds-ds[0].Cost)) > 1e-9 {
+			t.Fatalf("%s: wrong gain", method)
+		}
+	}
+	check(FIFO, 3003.6+(3504.2/2))
+	check(LIFO, 3504.2+(3003.6/2))
+	if _, _, err = Match(h.Records, "hifo"); err != ErrTaxMethod {
+		t.Fatal("unknown method accepted")
+	}
+
+	// sale without lot
+	ds, _, _ := Match(h.Records[3:], FIFO)
+	if len(ds) != 1 || ds[0].Unmatched != 15000000 || ds[0].Cost != 0 {
+		t.Fatalf("wrong disposal: %+v", ds)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	h, err := Build(
+		[]*bisquit.TradeInfo{
+			trade("b1", true, true, 10000000, "30000", "3000", 0),
+			trade("s1", false, false, 10000000, "35000", "3500", 1),
+		},
+		[]*bisquit.TradeInfo{trade("f1", true, false, 10000000, "30000", "3000", 2)},
+		[]*bisquit.TxInfo{{TxId: "pay-s1"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err = WriteGenericCSV(buf, h.Records); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[1] != "2023-03-01T12:00:00Z,b1,closed,buy,maker,0.10000000,30000,3000.00,EUR,0.00010000,BTC,0.00002000,3.60,3003.60," {
+		t.Fatalf("wrong CSV: %s", buf.String())
+	}
+	buf.Reset()
+	if err = WriteKoinlyCSV(buf, h.Records); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 ||
+		lines[1] != "2023-03-01 12:00:00 UTC,3000.00,EUR,0.10000000,BTC,0.00012000,BTC,3000.00,EUR,,Bisq trade b1," ||
+		lines[2] != "2023-03-02 12:00:00 UTC,0.10000000,BTC,3500.00,EUR,0.00002000,BTC,3500.00,EUR,,Bisq trade s1,pay-s1" ||
+		lines[3] != "2023-03-02 12:00:00 UTC,5.00,BSQ,,,,,,,cost,Bisq trade s1 (trade fee)," {
+		t.Fatalf("wrong CSV: %s", buf.String())
+	}
+	ds, _, _ := Match(h.Records, FIFO)
+	buf.Reset()
+	if err = WriteDisposalsCSV(buf, ds); err != nil || !strings.Contains(buf.String(), "s1,0.10000000,3499.30,3003.60,495.70,EUR,2023-03-01T12:00:00Z,0.00000000") {
+		t.Fatalf("wrong CSV: %s", buf.String())
+	}
+}
@@ -22,6 +22,7 @@ package bisquit
 
 import (
 	"context"
+	"strings"
 )
 
 // GetMarketPrice returns the price of Bitcoin in the given currency
@@ -171,6 +172,16 @@ func (c *Client) WithdrawFunds(ctx context.Context, tradeID, address, memo strin
 	if c.conn == nil {
 		return ErrClientNotConnected
 	}
+	var spend *policySpend
+	if c.policy != nil {
+		trade, err := c.GetTrade(ctx, tradeID)
+		if err != nil {
+			return err
+		}
+		if spend, err = c.policyCheck(ctx, AssetBTC, address, Payout(trade), "", memo, true); err != nil {
+			return err
+		}
+	}
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 	req := &WithdrawFundsRequest{
@@ -178,6 +189,29 @@ func (c *Client) WithdrawFunds(ctx context.Context, tradeID, address, memo strin
 		Address: address,
 		Memo:    memo,
 	}
-	_, err := c.tc.WithdrawFunds(ctx, req)
-	return err
+	if _, err := c.tc.WithdrawFunds(ctx, req); err != nil {
+		return c.policyRelease(spend, err)
+	}
+	return nil
+}
+
+// IsMaker returns true if we created the offer of the trade
+func IsMaker(trade *TradeInfo) bool {
+	return trade.Offer.GetIsMyOffer() ||
+		strings.Contains(strings.ToLower(trade.Role), "as maker")
+}
+
+// IsBuyer returns true if we are the BTC buyer in the trade
+func IsBuyer(trade *TradeInfo) bool {
+	return trade.Contract.GetIsBuyerMakerAndSellerTaker() == IsMaker(trade)
+}
+
+// Payout returns our share of the payout of a trade (satoshis): the buyer
+// receives the trade amount and its security deposit, the seller gets its
+// security deposit back.
+func Payout(trade *TradeInfo) uint64 {
+	if IsBuyer(trade) {
+		return trade.TradeAmountAsLong + trade.Offer.GetBuyerSecurityDeposit()
+	}
+	return trade.Offer.GetSellerSecurityDeposit()
 }
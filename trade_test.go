@@ -26,6 +26,7 @@ import (
 )
 
 func TestGetMarketPrice(t *testing.T) {
+	needDaemon(t)
 	ctx := context.Background()
 	price, err := testClient.GetMarketPrice(ctx, "EUR")
 	if err != nil {
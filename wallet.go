@@ -77,6 +77,16 @@ func (c *Client) SendBsq(ctx context.Context, address, amount, txFeeRate string)
 	if c.conn == nil {
 		return nil, ErrClientNotConnected
 	}
+	var spend *policySpend
+	if c.policy != nil {
+		units, err := ParseUnits(amount, 2)
+		if err != nil {
+			return nil, err
+		}
+		if spend, err = c.policyCheck(ctx, AssetBSQ, address, units, txFeeRate, "", false); err != nil {
+			return nil, err
+		}
+	}
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 	req := &SendBsqRequest{
@@ -86,7 +96,7 @@ func (c *Client) SendBsq(ctx context.Context, address, amount, txFeeRate string)
 	}
 	resp, err := c.wc.SendBsq(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, c.policyRelease(spend, err)
 	}
 	return resp.TxInfo, nil
 }
@@ -96,6 +106,16 @@ func (c *Client) SendBtc(ctx context.Context, address, amount, txFeeRate, memo s
 	if c.conn == nil {
 		return nil, ErrClientNotConnected
 	}
+	var spend *policySpend
+	if c.policy != nil {
+		sats, err := ParseUnits(amount, 8)
+		if err != nil {
+			return nil, err
+		}
+		if spend, err = c.policyCheck(ctx, AssetBTC, address, sats, txFeeRate, memo, true); err != nil {
+			return nil, err
+		}
+	}
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 	req := &SendBtcRequest{
@@ -106,7 +126,7 @@ func (c *Client) SendBtc(ctx context.Context, address, amount, txFeeRate, memo s
 	}
 	resp, err := c.wc.SendBtc(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, c.policyRelease(spend, err)
 	}
 	return resp.TxInfo, nil
 }
@@ -173,6 +193,20 @@ func (c *Client) GetTransaction(ctx context.Context, txID string) (*TxInfo, erro
 	return resp.TxInfo, nil
 }
 
+// GetTransactions returns all transactions of the wallet
+func (c *Client) GetTransactions(ctx context.Context) ([]*TxInfo, error) {
+	if c.conn == nil {
+		return nil, ErrClientNotConnected
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp, err := c.wc.GetTransactions(ctx, &GetTransactionsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.TxInfo, nil
+}
+
 // GetFundingAddresses returns a list of available funding addresses
 func (c *Client) GetFundingAddresses(ctx context.Context) ([]*AddressBalanceInfo, error) {
 	if c.conn == nil {
@@ -241,3 +275,22 @@ func (c *Client) UnlockWallet(ctx context.Context, passwd string, timeout uint64
 	_, err := c.wc.UnlockWallet(ctx, req)
 	return err
 }
+
+// VerifyBsqSentToAddress checks if the given amount of BSQ was received
+// by a BSQ wallet address
+func (c *Client) VerifyBsqSentToAddress(ctx context.Context, address, amount string) (bool, error) {
+	if c.conn == nil {
+		return false, ErrClientNotConnected
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req := &VerifyBsqSentToAddressRequest{
+		Address: address,
+		Amount:  amount,
+	}
+	resp, err := c.wc.VerifyBsqSentToAddress(ctx, req)
+	if err != nil {
+		return false, err
+	}
+	return resp.IsAmountReceived, nil
+}
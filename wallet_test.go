@@ -27,6 +27,7 @@ import (
 )
 
 func TestGetBalances(t *testing.T) {
+	needDaemon(t)
 	ctx := context.Background()
 	balances, err := testClient.GetBalances(ctx, "BTC")
 	if err != nil {
@@ -40,6 +41,7 @@ func TestGetBalances(t *testing.T) {
 }
 
 func TestGetUnusedBsqAddress(t *testing.T) {
+	needDaemon(t)
 	ctx := context.Background()
 	addr, err := testClient.GetUnusedBsqAddress(ctx)
 	if err != nil {
@@ -49,6 +51,7 @@ func TestGetUnusedBsqAddress(t *testing.T) {
 }
 
 func TestGetTxFeeRate(t *testing.T) {
+	needDaemon(t)
 	ctx := context.Background()
 	fee, err := testClient.GetTxFeeRate(ctx)
 	if err != nil {
@@ -58,6 +61,7 @@ func TestGetTxFeeRate(t *testing.T) {
 }
 
 func TestGetFundingAddresses(t *testing.T) {
+	needDaemon(t)
 	ctx := context.Background()
 	addrs, err := testClient.GetFundingAddresses(ctx)
 	if err != nil {
@@ -67,3 +71,15 @@ func TestGetFundingAddresses(t *testing.T) {
 		t.Logf("Funding addr#%d: %v\n", i, addr)
 	}
 }
+
+func TestGetTransactions(t *testing.T) {
+	needDaemon(t)
+	ctx := context.Background()
+	txs, err := testClient.GetTransactions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tx := range txs {
+		t.Logf("Tx#%d: %v\n", i, tx)
+	}
+}